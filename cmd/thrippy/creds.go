@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"maps"
-	"net/url"
 	"os"
 	"slices"
 	"sort"
+	"time"
 
 	"github.com/pkg/browser"
 	altsrc "github.com/urfave/cli-altsrc/v3"
@@ -16,6 +16,8 @@ import (
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
 	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/oauth"
+	"github.com/tzrikka/thrippy/pkg/secrets"
 )
 
 // startOAuthCommand is a function rather than a var because it
@@ -27,15 +29,7 @@ func startOAuthCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 		UsageText: "thrippy start-oauth [--base-url <http[s]://host:port>] <link ID>",
 		Category:  "link credentials",
 		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "base-url",
-				Aliases: []string{"u"},
-				Usage:   "Thrippy HTTP server's base URL",
-				Value:   fmt.Sprintf("http://localhost:%d", DefaultHTTPPort),
-				Sources: cli.NewValueSourceChain(
-					toml.TOML("client.webhook_base_url", configFilePath),
-				),
-			},
+			baseURLFlag(configFilePath),
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			if err := checkLinkIDArg(cmd); err != nil {
@@ -61,21 +55,38 @@ func startOAuthCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 				return fmt.Errorf("link %q does not have OAuth configured", id)
 			}
 
-			// Construct the OAuth start URL and open it in a browser.
-			u, err := url.JoinPath(cmd.String("base-url"), "start")
-			if err != nil {
-				return err
-			}
+			return openOAuthStartURL(cmd, nonce, oauth.StartParams{LinkID: id})
+		},
+	}
+}
 
-			u = fmt.Sprintf("%s?id=%s&nonce=%s", u, id, nonce)
-			fmt.Println("Opening a browser with this URL:", u)
+// baseURLFlag is a function rather than a var because it
+// depends on the runtime return value of [configFile].
+func baseURLFlag(configFilePath altsrc.StringSourcer) cli.Flag {
+	return &cli.StringFlag{
+		Name:    "base-url",
+		Aliases: []string{"u"},
+		Usage:   "Thrippy HTTP server's base URL",
+		Value:   fmt.Sprintf("http://localhost:%d", DefaultHTTPPort),
+		Sources: cli.NewValueSourceChain(
+			toml.TOML("client.webhook_base_url", configFilePath),
+		),
+	}
+}
 
-			if err := browser.OpenURL(u); err != nil {
-				return err
-			}
-			return nil
-		},
+// openOAuthStartURL constructs the OAuth start URL of a specific link,
+// signed with its nonce and valid for a limited time, and opens it in a browser.
+func openOAuthStartURL(cmd *cli.Command, nonce string, p oauth.StartParams) error {
+	p.Namespace = cmd.String("namespace")
+	p.Expires = time.Now().Add(oauth.DefaultStartURLTTL)
+	u, err := oauth.StartURL(cmd.String("base-url"), nonce, p)
+	if err != nil {
+		return err
 	}
+
+	fmt.Printf("Opening a browser with this URL (valid for %s):\n%s\n", oauth.DefaultStartURLTTL, u)
+
+	return browser.OpenURL(u)
 }
 
 var setCredsCommand = &cli.Command{
@@ -159,6 +170,95 @@ var getCredsCommand = &cli.Command{
 	},
 }
 
+var credsHistoryCommand = &cli.Command{
+	Name:      "creds-history",
+	Usage:     "Lists the retained versions of a specific link's credentials",
+	UsageText: "thrippy creds-history [global options] <link ID>",
+	Description: "This command accesses the secrets provider directly (not the Thrippy server),\n" +
+		"so it requires the same secrets configuration as the Thrippy server",
+	Category: "link credentials",
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		if err := checkLinkIDArg(cmd); err != nil {
+			return err
+		}
+
+		sm, err := secrets.NewManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		v, ok := sm.(secrets.Versioner)
+		if !ok {
+			return secrets.ErrVersionsNotSupported
+		}
+
+		id := cmd.Args().First()
+		h, err := v.History(ctx, id+"/creds")
+		if err != nil {
+			return err
+		}
+		if len(h) == 0 {
+			return fmt.Errorf("link %q does not have credentials", id)
+		}
+
+		for i, ver := range h {
+			created := "unknown time"
+			if !ver.CreatedAt.IsZero() {
+				created = ver.CreatedAt.Local().Format(time.RFC3339)
+			}
+
+			var notes string
+			switch {
+			case ver.Deleted:
+				notes = "  (deleted)"
+			case i == len(h)-1:
+				notes = "  (current)"
+			}
+
+			fmt.Printf("- Version %d  %s%s\n", ver.Number, created, notes)
+		}
+
+		return nil
+	},
+}
+
+var rollbackCredsCommand = &cli.Command{
+	Name:      "rollback-creds",
+	Usage:     "Restores a previous version of a specific link's credentials",
+	UsageText: "thrippy rollback-creds [global options] <link ID> --version <N>",
+	Description: "The restored credentials are saved as a new version, so this is reversible.\n" +
+		"This command accesses the secrets provider directly (not the Thrippy server),\n" +
+		"so it requires the same secrets configuration as the Thrippy server.\n" +
+		"Note that this does not restore the link's metadata",
+	Category: "link credentials",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:     "version",
+			Usage:    `version number to restore (see the "creds-history" command)`,
+			Required: true,
+		},
+	},
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		if err := checkLinkIDArg(cmd); err != nil {
+			return err
+		}
+
+		sm, err := secrets.NewManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		id := cmd.Args().First()
+		version := cmd.Int("version")
+		if err := secrets.Rollback(ctx, sm, id+"/creds", version); err != nil {
+			return fmt.Errorf("failed to restore version %d: %w", version, err)
+		}
+
+		fmt.Printf("Restored version %d of the credentials of link %q\n", version, id)
+		return nil
+	},
+}
+
 // readFiles converts the values of keys that reference
 // file paths ("@path") into the contents of these files.
 func readFiles(m map[string]string) (map[string]string, error) {
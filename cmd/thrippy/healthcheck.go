@@ -2,31 +2,51 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
 	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"github.com/tzrikka/thrippy/pkg/client"
 )
 
 const (
 	maxHealthzResponseSize = 1024 // 1 KiB.
+	grpcHealthTimeout      = 3 * time.Second
 )
 
 func healthCheckCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 	return &cli.Command{
-		Name:     "health-check",
-		Usage:    "Sends a single GET request to http://localhost:port/healthz",
+		Name:  "health-check",
+		Usage: "Sends a single GET request to http://localhost:port/healthz",
+		Description: "With the --https flag, this uses HTTPS instead of HTTP, without verifying the server's\n" +
+			"cert (which is usually issued for a public domain name, not localhost)\n\n" +
+			"With the --grpc flag, this sends a standard gRPC health check request instead,\n" +
+			"using the same gRPC address and TLS/mTLS settings as all the other client commands",
 		Category: "server monitoring",
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return sendHealthzRequest(ctx, cmd.Int("webhook-port"))
+			if cmd.Bool("grpc") {
+				return sendGRPCHealthRequest(ctx, cmd.String("grpc-addr"), client.GRPCCreds(ctx, cmd))
+			}
+			return sendHealthzRequest(ctx, cmd.Int("webhook-port"), cmd.Bool("https"))
 		},
 		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "grpc",
+				Usage: "check the gRPC server and its secrets manager, instead of HTTP",
+			},
+			&cli.BoolFlag{
+				Name:  "https",
+				Usage: "use HTTPS, if the webhook server is configured with TLS",
+			},
 			&cli.IntFlag{
 				Name:    "webhook-port",
 				Aliases: []string{"p"},
@@ -42,15 +62,23 @@ func healthCheckCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 	}
 }
 
-func sendHealthzRequest(ctx context.Context, port int) error {
-	url := fmt.Sprintf("http://localhost:%d/healthz", port)
+func sendHealthzRequest(ctx context.Context, port int, https bool) error {
+	scheme, hc := "http", http.DefaultClient
+	if https {
+		scheme = "https"
+		hc = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //gosec:disable G402 // Liveness check of localhost.
+		}}
+	}
+
+	url := fmt.Sprintf("%s://localhost:%d/healthz", scheme, port)
 	req, cancel, err := client.ConstructRequest(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return err
 	}
 	defer cancel()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := hc.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send HTTP request: %w", err)
 	}
@@ -70,3 +98,26 @@ func sendHealthzRequest(ctx context.Context, port int) error {
 
 	return nil
 }
+
+// sendGRPCHealthRequest checks the overall serving status of the gRPC server,
+// which also reflects the status of the server's secrets manager.
+func sendGRPCHealthRequest(ctx context.Context, addr string, creds credentials.TransportCredentials) error {
+	conn, err := client.Connection(addr, creds)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, grpcHealthTimeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("gRPC health check failed: %w", err)
+	}
+
+	if st := resp.GetStatus(); st != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("gRPC server status: %s", st)
+	}
+	return nil
+}
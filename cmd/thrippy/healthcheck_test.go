@@ -1,10 +1,24 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestSendHealthzRequest(t *testing.T) {
@@ -12,12 +26,18 @@ func TestSendHealthzRequest(t *testing.T) {
 		name       string
 		statusCode int
 		body       string
+		https      bool
 		wantErr    bool
 	}{
 		{
 			name:       "success_200_ok",
 			statusCode: http.StatusOK,
 		},
+		{
+			name:       "success_200_ok_https",
+			statusCode: http.StatusOK,
+			https:      true,
+		},
 		{
 			name:       "success_204_no_content",
 			statusCode: http.StatusNoContent,
@@ -43,10 +63,15 @@ func TestSendHealthzRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 				w.WriteHeader(tt.statusCode)
 				_, _ = w.Write([]byte(tt.body))
 			}))
+			if tt.https {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
 			defer server.Close()
 
 			addr, ok := server.Listener.Addr().(*net.TCPAddr)
@@ -54,10 +79,92 @@ func TestSendHealthzRequest(t *testing.T) {
 				t.Fatalf("failed to get TCP address from listener")
 			}
 
-			gotErr := sendHealthzRequest(t.Context(), addr.Port)
+			gotErr := sendHealthzRequest(t.Context(), addr.Port, tt.https)
 			if (gotErr != nil) != tt.wantErr {
 				t.Errorf("sendHealthzRequest() = %v, wantErr %v", gotErr, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestSendGRPCHealthRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  healthpb.HealthCheckResponse_ServingStatus
+		tls     bool
+		wantErr bool
+	}{
+		{
+			name:   "serving",
+			status: healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name:   "serving_with_tls",
+			status: healthpb.HealthCheckResponse_SERVING,
+			tls:    true,
+		},
+		{
+			name:    "not_serving",
+			status:  healthpb.HealthCheckResponse_NOT_SERVING,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverCreds, clientCreds := insecure.NewCredentials(), insecure.NewCredentials()
+			if tt.tls {
+				serverCreds, clientCreds = selfSignedTLSCreds(t)
+			}
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv := grpc.NewServer(grpc.Creds(serverCreds))
+			hs := health.NewServer()
+			hs.SetServingStatus("", tt.status)
+			healthpb.RegisterHealthServer(srv, hs)
+			go func() { _ = srv.Serve(lis) }()
+			defer srv.Stop()
+
+			gotErr := sendGRPCHealthRequest(t.Context(), lis.Addr().String(), clientCreds)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("sendGRPCHealthRequest() = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func selfSignedTLSCreds(t *testing.T) (server, client credentials.TransportCredentials) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server = credentials.NewServerTLSFromCert(&tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key})
+	client = credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS13})
+	return server, client
+}
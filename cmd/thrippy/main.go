@@ -43,11 +43,16 @@ func main() {
 			getLinkCommand,
 			setCredsCommand,
 			startOAuthCommand(path),
+			addScopesCommand(path),
 			getCredsCommand,
+			credsHistoryCommand,
+			rollbackCredsCommand,
 			getMetaCommand,
 			healthCheckCommand(path),
+			reencryptSecretsCommand,
 		},
 		Flags:                 flags(path),
+		Before:                withNamespace,
 		EnableShellCompletion: true,
 		Suggest:               true,
 	}
@@ -67,23 +72,48 @@ func flags(path altsrc.StringSourcer) []cli.Flag {
 		&cli.StringFlag{
 			Name:    "grpc-addr",
 			Aliases: []string{"a"},
-			Usage:   "gRPC server address and port",
+			Usage:   "gRPC server address and port, or Unix socket (unix:///path)",
 			Value:   net.JoinHostPort("", strconv.Itoa(DefaultGRPCPort)),
 			Sources: cli.NewValueSourceChain(
 				cli.EnvVar("THRIPPY_GRPC_ADDRESS"),
 				toml.TOML("grpc.address", path),
 			),
 		},
+		&cli.StringFlag{
+			Name:    "namespace",
+			Aliases: []string{"n"},
+			Usage:   "secrets namespace of links (default: the server's)",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_NAMESPACE"),
+				toml.TOML("client.namespace", path),
+			),
+			Validator: secrets.ValidateNamespace,
+		},
 	}
 
 	flags = append(flags, client.GRPCFlags(path)...)
 	flags = append(flags, server.GRPCFlags(path)...)
+	flags = append(flags, server.APIFlags(path)...)
 	flags = append(flags, secrets.ManagerFlags(path)...)
+	flags = append(flags, secrets.CacheFlags(path)...)
+	flags = append(flags, secrets.EncryptionFlags(path)...)
 	flags = append(flags, secrets.AWSFlags(path)...)
+	flags = append(flags, secrets.KubernetesFlags(path)...)
+	flags = append(flags, secrets.SQLFlags(path)...)
 	flags = append(flags, secrets.VaultFlags(path)...)
 	return flags
 }
 
+// withNamespace applies the "--namespace" flag to all gRPC requests, and
+// to commands which access the secrets manager directly, if it's specified.
+func withNamespace(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	ns := cmd.String("namespace")
+	if ns == "" {
+		return ctx, nil
+	}
+	return secrets.WithNamespace(client.WithNamespace(ctx, ns), ns), nil
+}
+
 // configFile returns the path to the app's configuration file.
 // It also creates an empty file if it doesn't already exist.
 func configFile() altsrc.StringSourcer {
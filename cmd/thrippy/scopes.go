@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli/v3"
+
+	intlinks "github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/links"
+	"github.com/tzrikka/thrippy/pkg/oauth"
+)
+
+// addScopesCommand is a function rather than a var because it
+// depends on the runtime return value of [configDir] and [configFile].
+func addScopesCommand(configFilePath altsrc.StringSourcer) *cli.Command {
+	return &cli.Command{
+		Name:      "add-scopes",
+		Usage:     "Starts a new OAuth 2.0 flow for a specific link, with additional scopes",
+		UsageText: "thrippy add-scopes [global options] <link ID> [--scopes <...>] [--user-scopes <...>]",
+		Description: "The link keeps its ID, and its current scopes and credentials remain in use\n" +
+			"until the new OAuth flow is completed, and the new token is checked successfully.\n" +
+			"Only then does the Thrippy server add the new scopes to the link's configuration",
+		Category: "link credentials",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "scopes",
+				Usage: "OAuth 2.0 scopes to add (comma delimited / multiple flags)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "user-scopes",
+				Usage: "Slack user scopes to add (comma delimited / multiple flags)",
+			},
+			baseURLFlag(configFilePath),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := checkLinkIDArg(cmd); err != nil {
+				return err
+			}
+
+			scopes := trimScopes(cmd.StringSlice("scopes"))
+			userScopes := trimScopes(cmd.StringSlice("user-scopes"))
+			if len(scopes) == 0 && len(userScopes) == 0 {
+				return errors.New("missing scopes to add")
+			}
+
+			id := cmd.Args().First()
+			t, o, err := client.LinkTemplateAndOAuthConfig(ctx, cmd.String("grpc-addr"), client.GRPCCreds(ctx, cmd), id)
+			if err != nil {
+				return err
+			}
+
+			if err := checkScopes(id, t, o, scopes, userScopes); err != nil {
+				return err
+			}
+
+			return openOAuthStartURL(cmd, o.Nonce, oauth.StartParams{LinkID: id, Scopes: scopes, UserScopes: userScopes})
+		},
+	}
+}
+
+// checkScopes checks that the given scopes can be added to the OAuth configuration
+// of an existing link, based on its template. It doesn't modify the link: the Thrippy
+// server adds the scopes only when the new OAuth flow is completed successfully.
+func checkScopes(id, t string, o *oauth.Config, scopes, userScopes []string) error {
+	if o == nil {
+		return fmt.Errorf("link %q not found, or does not have OAuth configured", id)
+	}
+
+	templ, ok := links.Templates[t]
+	if !ok {
+		return fmt.Errorf("link %q has an unrecognized template: %s", id, t)
+	}
+
+	if err := intlinks.AddScopesByTemplate(o, templ, scopes, userScopes); err != nil {
+		return fmt.Errorf("link %q: %w", id, err)
+	}
+
+	return nil
+}
+
+// trimScopes removes whitespaces and empty values from the given list of scopes.
+func trimScopes(scopes []string) []string {
+	var trimmed []string
+	for _, s := range scopes {
+		if s = strings.TrimSpace(s); s != "" {
+			trimmed = append(trimmed, s)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/oauth"
+)
+
+func TestCheckScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		oauth      string
+		scopes     []string
+		userScopes []string
+		wantErr    bool
+	}{
+		{
+			name:    "link_not_found",
+			scopes:  []string{"a"},
+			wantErr: true,
+		},
+		{
+			name:     "non_oauth_link",
+			template: "slack-bot-token",
+			oauth:    `{}`,
+			scopes:   []string{"a"},
+			wantErr:  true,
+		},
+		{
+			name:     "unrecognized_template",
+			template: "foo",
+			oauth:    `{"client_id":"id"}`,
+			scopes:   []string{"a"},
+			wantErr:  true,
+		},
+		{
+			name:     "generic",
+			template: "generic-oauth",
+			oauth:    `{"client_id":"id","scopes":["b"]}`,
+			scopes:   []string{"a", "b"},
+		},
+		{
+			name:       "generic_user_scopes",
+			template:   "generic-oauth",
+			oauth:      `{"client_id":"id"}`,
+			userScopes: []string{"a"},
+			wantErr:    true,
+		},
+		{
+			name:     "google",
+			template: "google-user-oauth",
+			oauth:    `{"client_id":"id","scopes":["openid"],"auth_codes":{"access_type":"offline"}}`,
+			scopes:   []string{"https://www.googleapis.com/auth/calendar.readonly"},
+		},
+		{
+			name:       "slack",
+			template:   "slack-oauth",
+			oauth:      `{"client_id":"id","scopes":["users:read"],"auth_codes":{"user_scope":"search:read,chat:write"}}`,
+			scopes:     []string{"channels:read"},
+			userScopes: []string{"chat:write", "users:read"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o *oauth.Config
+			if tt.oauth != "" {
+				p := &thrippypb.OAuthConfig{}
+				if err := protojson.Unmarshal([]byte(tt.oauth), p); err != nil {
+					t.Fatal(err)
+				}
+				o = oauth.FromProto(p)
+			}
+
+			err := checkScopes("Lpab3Rf2SQCMBhK6UnBELi", tt.template, o, tt.scopes, tt.userScopes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrimScopes(t *testing.T) {
+	got := trimScopes([]string{" a ", "", "b", "  "})
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trimScopes() = %v, want %v", got, want)
+	}
+}
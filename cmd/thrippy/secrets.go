@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+var reencryptSecretsCommand = &cli.Command{
+	Name:      "reencrypt-secrets",
+	Usage:     "Re-encrypts all stored secrets with the current encryption key",
+	UsageText: "thrippy reencrypt-secrets [global options]",
+	Description: "Run this after adding a new key encryption key (KEK) as the first one in the list,\n" +
+		"and before removing old KEKs from it. This also encrypts existing plaintext secrets.\n\n" +
+		"With AWS Parameter Store or Vault KV v2, previous versions of link credentials\n" +
+		"can't be re-encrypted, so keep the old KEKs as long as they may be rolled back to",
+	Category: "server maintenance",
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		sm, err := secrets.NewManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		n, err := secrets.ReEncrypt(ctx, sm)
+		if err != nil {
+			return fmt.Errorf("re-encryption failed after %d secrets: %w", n, err)
+		}
+
+		fmt.Println("Re-encrypted secrets:", n)
+		return nil
+	},
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"path/filepath"
+	"time"
 
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
@@ -28,6 +30,32 @@ func serverCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 				),
 				Validator: validatePort,
 			},
+			&cli.IntFlag{
+				Name:  "api-port",
+				Usage: "local port number for the REST/JSON API (default: disabled)",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_API_PORT"),
+					toml.TOML("server.api_port", configFilePath),
+				),
+				Validator: validatePort,
+			},
+			&cli.BoolFlag{
+				Name:  "grpc-reflection",
+				Usage: "enable the gRPC server reflection service",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_GRPC_REFLECTION"),
+					toml.TOML("server.grpc_reflection", configFilePath),
+				),
+			},
+			&cli.DurationFlag{
+				Name:  "shutdown-timeout",
+				Usage: "maximum time to wait for in-flight requests when stopping",
+				Value: server.DefaultShutdownTimeout,
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_SHUTDOWN_TIMEOUT"),
+					toml.TOML("server.shutdown_timeout", configFilePath),
+				),
+			},
 			&cli.StringFlag{
 				Name:    "webhook-addr",
 				Aliases: []string{"w"},
@@ -37,6 +65,99 @@ func serverCommand(configFilePath altsrc.StringSourcer) *cli.Command {
 					toml.TOML("server.webhook_address", configFilePath),
 				),
 			},
+			&cli.StringFlag{
+				Name:  "webhook-tls-cert",
+				Usage: "TLS cert file for HTTP webhooks (default: plain HTTP)",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_TLS_CERT"),
+					toml.TOML("server.webhook_tls.cert", configFilePath),
+				),
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:  "webhook-tls-key",
+				Usage: "TLS private key file for HTTP webhooks",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_TLS_KEY"),
+					toml.TOML("server.webhook_tls.key", configFilePath),
+				),
+				TakesFile: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "webhook-acme-domains",
+				Usage: "obtain TLS certs for HTTP webhooks from an ACME CA for these domains",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_ACME_DOMAINS"),
+					toml.TOML("server.webhook_tls.acme_domains", configFilePath),
+				),
+			},
+			&cli.StringFlag{
+				Name:  "webhook-acme-cache-dir",
+				Usage: "directory for ACME certs and account key",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_ACME_CACHE_DIR"),
+					toml.TOML("server.webhook_tls.acme_cache_dir", configFilePath),
+				),
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:  "webhook-acme-email",
+				Usage: "optional contact email for the ACME account",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_ACME_EMAIL"),
+					toml.TOML("server.webhook_tls.acme_email", configFilePath),
+				),
+			},
+			&cli.StringFlag{
+				Name:  "webhook-acme-directory",
+				Usage: "ACME directory URL (default: Let's Encrypt)",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_WEBHOOK_ACME_DIRECTORY"),
+					toml.TOML("server.webhook_tls.acme_directory", configFilePath),
+				),
+			},
+			&cli.DurationFlag{
+				Name:  "oauth-state-ttl",
+				Usage: "time limit for users to complete OAuth flows",
+				Value: 10 * time.Minute,
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_OAUTH_STATE_TTL"),
+					toml.TOML("server.oauth_state_ttl", configFilePath),
+				),
+			},
+			&cli.StringFlag{
+				Name: "oauth-state-key", // Optional HMAC key, at least 32 bytes.
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_OAUTH_STATE_KEY"),
+				),
+				Hidden: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "return-to-allowlist",
+				Usage: "URLs to which users may return after OAuth flows (see the \"return_to\" parameter)",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_RETURN_TO_ALLOWLIST"),
+					toml.TOML("server.return_to_allowlist", configFilePath),
+				),
+			},
+			&cli.StringFlag{
+				Name:  "pages-dir",
+				Usage: "directory with custom HTML page templates (start.html, success.html, error.html)",
+				Value: filepath.Join(filepath.Dir(configFilePath.SourceURI()), "pages"),
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_PAGES_DIR"),
+					toml.TOML("server.pages_dir", configFilePath),
+				),
+				TakesFile: true,
+			},
+			&cli.BoolFlag{
+				Name:  "oauth-start-page",
+				Usage: "show a start page before redirecting users to third-party services",
+				Sources: cli.NewValueSourceChain(
+					cli.EnvVar("THRIPPY_OAUTH_START_PAGE"),
+					toml.TOML("server.oauth_start_page", configFilePath),
+				),
+			},
 			&cli.StringFlag{
 				Name:    "fallback-url",
 				Aliases: []string{"u"},
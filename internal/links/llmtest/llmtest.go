@@ -0,0 +1,56 @@
+// Package llmtest provides an [httptest] stand-in for the APIs of
+// LLM providers, to test the credential checkers of their link templates.
+package llmtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Auth is the HTTP header which is expected to contain
+// the API key in requests, e.g. "Authorization: Bearer <key>".
+type Auth struct {
+	Header string
+	Value  string
+}
+
+// Response is the response to a request for a specific URL path and query.
+type Response struct {
+	Header map[string]string
+	Body   string
+}
+
+// NewServer starts an [httptest.Server] that checks the API key in each request,
+// and responds with the response which matches the request's URL path and query
+// (e.g. "/v1/models?limit=1000"), or an error if there's no such response.
+// The caller should call Close when finished, to shut it down.
+func NewServer(t *testing.T, auth Auth, responses map[string]Response) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			t.Errorf("HTTP method = %q, want %q", r.Method, http.MethodGet)
+		}
+		if got := r.Header.Get(auth.Header); got != auth.Value {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"message": "invalid API key"}}`))
+			return
+		}
+
+		resp, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected request: %s", r.URL.RequestURI())
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"message": "not found"}}`))
+			return
+		}
+
+		for k, v := range resp.Header {
+			w.Header().Set(k, v)
+		}
+		_, _ = w.Write([]byte(resp.Body))
+	}))
+}
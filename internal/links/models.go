@@ -0,0 +1,45 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// maxModelPages limits the number of requests to list models (see [ListModels]).
+const maxModelPages = 10
+
+// ListModels collects the models which are available to an API key of an LLM service,
+// by calling the given function for each page of the service's paginated list. The
+// function receives the cursor of the next page (empty in the first call), and returns
+// the page's models along with the cursor of the following page (empty in the last one).
+func ListModels[M any](ctx context.Context, page func(ctx context.Context, cursor string) ([]M, string, error)) ([]M, error) {
+	var models []M
+	cursor := ""
+
+	for range maxModelPages {
+		ms, next, err := page(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		models = append(models, ms...)
+		if next == "" {
+			return models, nil
+		}
+		cursor = next
+	}
+
+	return nil, errors.New("too many pages of models")
+}
+
+// ModelIDs returns the sorted and comma-separated IDs of the given models.
+func ModelIDs[M any](models []M, id func(M) string) string {
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		ids = append(ids, id(m))
+	}
+	slices.Sort(ids)
+	return strings.Join(slices.Compact(ids), ",")
+}
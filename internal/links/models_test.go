@@ -0,0 +1,75 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestListModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   int
+		err     error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "single_page",
+			pages: 1,
+			want:  []string{"0"},
+		},
+		{
+			name:  "multiple_pages",
+			pages: 3,
+			want:  []string{"0", "1", "2"},
+		},
+		{
+			name:    "too_many_pages",
+			pages:   maxModelPages + 1,
+			wantErr: true,
+		},
+		{
+			name:    "page_error",
+			pages:   2,
+			err:     errors.New("error"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ListModels(t.Context(), func(_ context.Context, cursor string) ([]string, string, error) {
+				i := 0
+				if cursor != "" {
+					if tt.err != nil {
+						return nil, "", tt.err
+					}
+					i, _ = strconv.Atoi(cursor)
+				}
+
+				next := ""
+				if i+1 < tt.pages {
+					next = strconv.Itoa(i + 1)
+				}
+				return []string{strconv.Itoa(i)}, next, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListModels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListModels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelIDs(t *testing.T) {
+	type model struct{ id string }
+	got := ModelIDs([]model{{"b"}, {"a"}, {"b"}}, func(m model) string { return m.id })
+	if want := "a,b"; got != want {
+		t.Errorf("ModelIDs() = %q, want %q", got, want)
+	}
+}
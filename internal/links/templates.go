@@ -23,12 +23,34 @@ type OAuthFunc func(*oauth.Config)
 
 type CheckerFunc func(context.Context, map[string]string, *oauth.Config, *oauth2.Token) (string, error)
 
+type ScopesFunc func(o *oauth.Config, scopes, userScopes []string) error
+
+// TokenFunc mints a short-lived access token based on the given static
+// credentials. It returns nil without an error if the link's
+// credentials aren't configured for minting tokens.
+type TokenFunc func(ctx context.Context, creds map[string]string) (*oauth2.Token, error)
+
+// RefreshFunc refreshes an OAuth token, for third-party services
+// with non-standard token refresh requests or responses.
+type RefreshFunc func(ctx context.Context, o *oauth.Config, t *oauth2.Token) (*oauth2.Token, error)
+
+// ExtrasFunc extracts extra details from a new or refreshed OAuth token
+// (e.g. non-standard fields in token responses), to store them with
+// the token in its "raw" map. Non-string values should be JSON-encoded.
+type ExtrasFunc func(t *oauth2.Token) map[string]string
+
 type Template struct {
 	description string
 	links       []string
 	credFields  []string
 	oauthFunc   OAuthFunc
 	checkerFunc CheckerFunc
+	scopesFunc  ScopesFunc
+	tokenFunc   TokenFunc
+	refreshFunc RefreshFunc
+	extrasFunc  ExtrasFunc
+
+	clientCredentials bool
 }
 
 // NewTemplate defines the authentication details of a well-known third-party service.
@@ -42,6 +64,101 @@ func NewTemplate(description string, links, credFields []string, of OAuthFunc, c
 	}
 }
 
+// WithScopesFunc returns a copy of the template, with a function that adds OAuth
+// scopes to the configurations of existing links (see [AddScopesByTemplate]).
+func (t Template) WithScopesFunc(sf ScopesFunc) Template {
+	t.scopesFunc = sf
+	return t
+}
+
+// WithClientCredentialsGrant returns a copy of the template, for machine-to-machine
+// links which use the OAuth 2.0 client credentials grant instead of 3-legged OAuth
+// flows: Thrippy fetches (and caches) their tokens on demand, without any user
+// interaction (see [oauth.Config.ClientCredentialsToken]).
+func (t Template) WithClientCredentialsGrant() Template {
+	t.clientCredentials = true
+	return t
+}
+
+// ClientCredentialsGrant reports whether links based on this template
+// use the OAuth 2.0 client credentials grant (see [Template.WithClientCredentialsGrant]).
+func (t Template) ClientCredentialsGrant() bool {
+	return t.clientCredentials
+}
+
+// WithTokenFunc returns a copy of the template, for links with static
+// credentials that can also mint short-lived access tokens on demand.
+// Thrippy caches these tokens until they expire, and returns only them
+// in the link's credentials, so the static ones stay on the server.
+func (t Template) WithTokenFunc(tf TokenFunc) Template {
+	t.tokenFunc = tf
+	return t
+}
+
+// MintsTokens reports whether links based on this template can
+// mint short-lived access tokens (see [Template.WithTokenFunc]).
+func (t Template) MintsTokens() bool {
+	return t.tokenFunc != nil
+}
+
+// MintToken mints a short-lived access token based on the given static
+// credentials, if the template supports it (see [Template.WithTokenFunc])
+// and the credentials are configured for it. Otherwise, it returns nil.
+func (t Template) MintToken(ctx context.Context, creds map[string]string) (*oauth2.Token, error) {
+	if t.tokenFunc == nil {
+		return nil, nil
+	}
+	return t.tokenFunc(ctx, creds)
+}
+
+// WithRefreshFunc returns a copy of the template, with a function that refreshes
+// OAuth tokens instead of the standard OAuth 2.0 flow (see [Template.RefreshToken]).
+func (t Template) WithRefreshFunc(rf RefreshFunc) Template {
+	t.refreshFunc = rf
+	return t
+}
+
+// WithTokenExtras returns a copy of the template, with a function that
+// extracts extra details from OAuth tokens (see [Template.TokenExtras]).
+func (t Template) WithTokenExtras(ef ExtrasFunc) Template {
+	t.extrasFunc = ef
+	return t
+}
+
+// RefreshToken refreshes the given OAuth token, with the template's [RefreshFunc]
+// if it has one, or else with the standard OAuth 2.0 flow. It returns the new token
+// as a map, for storage in the secrets manager, including its extra details (see
+// [Template.TokenExtras]) in a "raw" map.
+func (t Template) RefreshToken(ctx context.Context, o *oauth.Config, ot *oauth2.Token) (map[string]any, error) {
+	if t.refreshFunc == nil {
+		return o.RefreshToken(ctx, ot, false)
+	}
+
+	nt, err := t.refreshFunc(ctx, o, ot)
+	if err != nil {
+		return nil, err
+	}
+
+	m := oauth.TokenToMap(nt)
+	if extras := t.TokenExtras(nt); len(extras) > 0 {
+		raw := make(map[string]any, len(extras))
+		for k, v := range extras {
+			raw[k] = v
+		}
+		m["raw"] = raw
+	}
+	return m, nil
+}
+
+// TokenExtras returns the extra details of the given OAuth token which
+// are worth storing with it, if the template defines any (see [ExtrasFunc]).
+func (t Template) TokenExtras(ot *oauth2.Token) map[string]string {
+	if t.extrasFunc == nil || ot == nil {
+		return nil
+	}
+	return t.extrasFunc(ot)
+}
+
 func (t Template) Description() string {
 	return t.description
 }
@@ -82,6 +199,11 @@ func (t Template) Check(ctx context.Context, m map[string]string, oc *oauth.Conf
 // OAuthCredFields is a reusable standard based on [oauth2.Token].
 var OAuthCredFields = []string{"access_token", "expiry", "refresh_token", "token_type"}
 
+// ClientCredsFields is similar to [OAuthCredFields], for the client credentials
+// grant, which doesn't issue refresh tokens. The private key is optional,
+// for signing JWT assertions (see [oauth.PrivateKeyCred]).
+var ClientCredsFields = []string{"access_token", "expiry", "token_type", "private_key_manual_optional"}
+
 // ModifyOAuthByTemplate fills in all the missing OAuth
 // configuration details, based on the given link template.
 // It also normalizes (i.e. sorts and compacts) OAuth scopes.
@@ -98,6 +220,32 @@ func ModifyOAuthByTemplate(o *oauth.Config, t Template, found bool) {
 	o.Config.Scopes = slices.Compact(o.Config.Scopes)
 }
 
+// AddScopesByTemplate adds OAuth scopes to the configuration of an existing
+// link, for incremental authorization, based on the given link template.
+// By default, it only merges the given scopes into the existing ones, and
+// rejects user scopes (which only some third-party services distinguish).
+// It also normalizes (i.e. sorts and compacts) OAuth scopes.
+func AddScopesByTemplate(o *oauth.Config, t Template, scopes, userScopes []string) error {
+	if !o.IsUsable() {
+		return errors.New("link does not have OAuth configured")
+	}
+
+	switch {
+	case t.scopesFunc != nil:
+		if err := t.scopesFunc(o, scopes, userScopes); err != nil {
+			return err
+		}
+	case len(userScopes) > 0:
+		return errors.New("link template does not support user scopes")
+	default:
+		o.Config.Scopes = append(o.Config.Scopes, scopes...)
+	}
+
+	slices.Sort(o.Config.Scopes)
+	o.Config.Scopes = slices.Compact(o.Config.Scopes)
+	return nil
+}
+
 // EncodeMetadataAsJSON converts the given struct into a JSON string.
 func EncodeMetadataAsJSON(v any) (string, error) {
 	sb := new(strings.Builder)
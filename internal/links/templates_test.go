@@ -1,10 +1,14 @@
 package links
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
+	"golang.org/x/oauth2"
+
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
 func TestTemplateCredFields(t *testing.T) {
@@ -81,6 +85,76 @@ func TestTemplateCredFields(t *testing.T) {
 	}
 }
 
+func TestAddScopesByTemplate(t *testing.T) {
+	custom := func(o *oauth.Config, scopes, userScopes []string) error {
+		if len(userScopes) > 1 {
+			return errors.New("too many user scopes")
+		}
+		o.Config.Scopes = append(o.Config.Scopes, scopes...)
+		o.Config.Scopes = append(o.Config.Scopes, userScopes...)
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		o          *oauth.Config
+		template   Template
+		scopes     []string
+		userScopes []string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:    "nil_oauth",
+			scopes:  []string{"a"},
+			wantErr: true,
+		},
+		{
+			name:   "default_merge",
+			o:      &oauth.Config{Config: &oauth2.Config{ClientID: "id", Scopes: []string{"b", "c"}}},
+			scopes: []string{"c", "a"},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:       "default_user_scopes",
+			o:          &oauth.Config{Config: &oauth2.Config{ClientID: "id"}},
+			userScopes: []string{"a"},
+			wantErr:    true,
+		},
+		{
+			name:       "custom_func",
+			o:          &oauth.Config{Config: &oauth2.Config{ClientID: "id", Scopes: []string{"b"}}},
+			template:   NewTemplate("", nil, nil, nil, nil).WithScopesFunc(custom),
+			scopes:     []string{"a"},
+			userScopes: []string{"b"},
+			want:       []string{"a", "b"},
+		},
+		{
+			name:       "custom_func_error",
+			o:          &oauth.Config{Config: &oauth2.Config{ClientID: "id"}},
+			template:   NewTemplate("", nil, nil, nil, nil).WithScopesFunc(custom),
+			userScopes: []string{"a", "b"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AddScopesByTemplate(tt.o, tt.template, tt.scopes, tt.userScopes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AddScopesByTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(tt.o.Config.Scopes, tt.want) {
+				t.Errorf("AddScopesByTemplate() scopes = %v, want %v", tt.o.Config.Scopes, tt.want)
+			}
+		})
+	}
+}
+
 func TestEncodeMetadataAsJSON(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -12,6 +12,7 @@ import (
 	"github.com/urfave/cli/v3"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/local"
 
 	"github.com/tzrikka/thrippy/internal/logger"
 )
@@ -71,8 +72,15 @@ func GRPCFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 // Errors here will abort the application with a log message.
 // See also [server.GRPCCreds].
 //
+// Unix domain sockets don't use TLS: access to them is controlled by the
+// socket file's permissions, and the server authenticates clients based
+// on their OS-level peer credentials (user and group IDs).
+//
 // [server.GRPCCreds]: https://pkg.go.dev/github.com/tzrikka/thrippy/pkg/server#GRPCCreds
 func GRPCCreds(ctx context.Context, cmd *cli.Command) credentials.TransportCredentials {
+	if _, ok := UnixSocketPath(cmd.String("grpc-addr")); ok {
+		return local.NewCredentials()
+	}
 	if cmd.Bool("dev") {
 		return insecureCreds()
 	}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
@@ -19,9 +21,57 @@ import (
 
 const (
 	timeout = 3 * time.Second
+
+	// NamespaceMetadataKey is the gRPC metadata key which selects the secrets
+	// namespace of a request, instead of the server's default one. The server
+	// allows this only for authorized callers (see [server.GRPCFlags]).
+	//
+	// [server.GRPCFlags]: https://pkg.go.dev/github.com/tzrikka/thrippy/pkg/server#GRPCFlags
+	NamespaceMetadataKey = "thrippy-namespace"
+
+	// ScopesMetadataKey and UserScopesMetadataKey are gRPC metadata keys which add
+	// OAuth scopes to the configuration of a link, when setting its credentials
+	// with an OAuth token (see [WithAddedScopes]). Values are comma-separated.
+	ScopesMetadataKey     = "thrippy-add-scopes"
+	UserScopesMetadataKey = "thrippy-add-user-scopes"
 )
 
-// Connection creates a gRPC client connection to the given address.
+// WithNamespace returns a copy of the given context which selects the given secrets
+// namespace in all the gRPC requests that use it. An empty namespace is a no-op.
+func WithNamespace(ctx context.Context, ns string) context.Context {
+	if ns == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, NamespaceMetadataKey, ns)
+}
+
+// WithAddedScopes returns a copy of the given context which adds the given OAuth
+// scopes to the configuration of a link, but only when the gRPC server saves a new
+// OAuth token for it successfully. Empty scopes are a no-op.
+func WithAddedScopes(ctx context.Context, scopes, userScopes []string) context.Context {
+	if len(scopes) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, ScopesMetadataKey, strings.Join(scopes, ","))
+	}
+	if len(userScopes) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, UserScopesMetadataKey, strings.Join(userScopes, ","))
+	}
+	return ctx
+}
+
+// UnixSocketPath returns the file path of the given gRPC address, if it's a
+// Unix domain socket address ("unix:///absolute/path" or "unix:relative/path").
+func UnixSocketPath(addr string) (string, bool) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		return path, path != ""
+	}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return path, path != ""
+	}
+	return "", false
+}
+
+// Connection creates a gRPC client connection to the given address, which may be
+// a "host:port" TCP address or a Unix domain socket address (see [UnixSocketPath]).
 // It supports both secure and insecure connections, based on the given credentials.
 func Connection(addr string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
 	return grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
@@ -31,12 +81,19 @@ func Connection(addr string, creds credentials.TransportCredentials) (*grpc.Clie
 // This function reports gRPC errors, and invalid OAuth configurations,
 // but if the link or its OAuth configuration are not found it returns nil.
 func LinkOAuthConfig(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string) (*oauth.Config, error) {
+	_, o, err := LinkTemplateAndOAuthConfig(ctx, grpcAddr, creds, linkID)
+	return o, err
+}
+
+// LinkTemplateAndOAuthConfig is similar to [LinkOAuthConfig],
+// but it also returns the template name of the link.
+func LinkTemplateAndOAuthConfig(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string) (string, *oauth.Config, error) {
 	l := logger.FromContext(ctx)
 
 	conn, err := Connection(grpcAddr, creds)
 	if err != nil {
 		l.Error("gRPC connection error", slog.Any("error", err))
-		return nil, err
+		return "", nil, err
 	}
 	defer conn.Close()
 
@@ -48,18 +105,18 @@ func LinkOAuthConfig(ctx context.Context, grpcAddr string, creds credentials.Tra
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
 			l.Error("bad response from gRPC service", slog.Any("error", err), slog.String("client_method", "GetLink"))
-			return nil, err
+			return "", nil, err
 		}
-		return nil, nil
+		return "", nil, nil
 	}
 
 	o := oauth.FromProto(resp.GetOauthConfig())
 	if o != nil && o.Config.ClientID == "" {
 		l.Error("empty OAuth client ID")
-		return nil, errors.New("empty OAuth client ID")
+		return "", nil, errors.New("empty OAuth client ID")
 	}
 
-	return o, nil
+	return resp.GetTemplate(), o, nil
 }
 
 // AddGitHubCreds adds the given GitHub base URL and app installation ID to the given
@@ -99,7 +156,8 @@ func AddGitHubCreds(ctx context.Context, grpcAddr string, creds credentials.Tran
 
 // SetOAuthCreds checks and saves the given OAuth token as the credentials
 // of the given link. This also includes settings new metadata for the link.
-func SetOAuthCreds(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string, t *oauth2.Token) error {
+// The raw map (optional) contains extra details to store with the token.
+func SetOAuthCreds(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials, linkID string, t *oauth2.Token, raw map[string]string) error {
 	l := logger.FromContext(ctx)
 
 	conn, err := Connection(grpcAddr, creds)
@@ -113,7 +171,12 @@ func SetOAuthCreds(ctx context.Context, grpcAddr string, creds credentials.Trans
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	req := thrippypb.SetCredentialsRequest_builder{LinkId: new(linkID), Token: oauth.TokenToProto(t)}.Build()
+	token := oauth.TokenToProto(t)
+	if len(raw) > 0 {
+		token.SetRaw(raw)
+	}
+
+	req := thrippypb.SetCredentialsRequest_builder{LinkId: new(linkID), Token: token}.Build()
 	if _, err = c.SetCredentials(ctx, req); err != nil {
 		l.Error("bad response from gRPC service", slog.Any("error", err), slog.String("client_method", "SetCredentials"))
 		return err
@@ -103,3 +103,42 @@ func TestLinkOAuthConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestUnixSocketPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		wantPath string
+		wantOK   bool
+	}{
+		{
+			name: "tcp",
+			addr: "localhost:14460",
+		},
+		{
+			name:     "absolute",
+			addr:     "unix:///run/thrippy.sock",
+			wantPath: "/run/thrippy.sock",
+			wantOK:   true,
+		},
+		{
+			name:     "relative",
+			addr:     "unix:thrippy.sock",
+			wantPath: "thrippy.sock",
+			wantOK:   true,
+		},
+		{
+			name: "empty_path",
+			addr: "unix://",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := UnixSocketPath(tt.addr)
+			if path != tt.wantPath || ok != tt.wantOK {
+				t.Errorf("UnixSocketPath() = %q, %v, want %q, %v", path, ok, tt.wantPath, tt.wantOK)
+			}
+		})
+	}
+}
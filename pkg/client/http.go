@@ -20,31 +20,38 @@ func HTTPRequest(ctx context.Context, httpMethod, url, authToken string) ([]byte
 }
 
 func HTTPRequestWithHeaders(ctx context.Context, httpMethod, url, authToken string, headers map[string]string) ([]byte, error) {
+	body, _, err := HTTPRequestWithRespHeaders(ctx, httpMethod, url, authToken, headers)
+	return body, err
+}
+
+// HTTPRequestWithRespHeaders is similar to [HTTPRequestWithHeaders],
+// but it also returns the headers of successful responses.
+func HTTPRequestWithRespHeaders(ctx context.Context, httpMethod, url, authToken string, headers map[string]string) ([]byte, http.Header, error) {
 	req, cancel, err := ConstructRequest(ctx, httpMethod, url, authToken, headers)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer cancel()
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+		return nil, nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+		return nil, nil, fmt.Errorf("failed to read HTTP response body: %w", err)
 	}
 
 	if resp.StatusCode >= http.StatusBadRequest {
 		if len(body) == 0 {
-			return nil, errors.New(resp.Status)
+			return nil, nil, errors.New(resp.Status)
 		}
-		return nil, fmt.Errorf("%s: %s", resp.Status, string(body))
+		return nil, nil, fmt.Errorf("%s: %s", resp.Status, string(body))
 	}
 
-	return body, nil
+	return body, resp.Header, nil
 }
 
 func ConstructRequest(ctx context.Context, method, url, token string, headers map[string]string) (*http.Request, context.CancelFunc, error) {
@@ -9,17 +9,47 @@ import (
 )
 
 const (
-	modelsURL = "https://api.openai.com/v1/models"
+	baseURL = "https://api.openai.com"
 )
 
-// get is a ChatGPT-specific HTTP GET wrapper for [client.HTTPRequest].
+// https://platform.openai.com/docs/api-reference/models/list
+type listModelsResponse struct {
+	Data []model `json:"data"`
+}
+
+// https://platform.openai.com/docs/api-reference/models/object
+type model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by,omitempty"`
+}
+
+// listModels lists the models which are available to a regular API key.
+// Based on https://platform.openai.com/docs/api-reference/models/list.
+func listModels(ctx context.Context, baseURL, apiKey string) ([]model, http.Header, error) {
+	resp := new(listModelsResponse)
+	h, err := get(ctx, baseURL+"/v1/models", apiKey, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Data, h, nil
+}
+
+// listProjects checks an admin API key, which can't list models.
+// Based on https://platform.openai.com/docs/api-reference/projects/list.
+func listProjects(ctx context.Context, baseURL, apiKey string) (http.Header, error) {
+	var resp map[string]any
+	return get(ctx, baseURL+"/v1/organization/projects?limit=1", apiKey, &resp)
+}
+
+// get is a ChatGPT-specific HTTP GET wrapper for [client.HTTPRequestWithRespHeaders].
 // Based on https://platform.openai.com/docs/api-reference/authentication.
-func get(ctx context.Context, url, apiKey string) (map[string]any, error) {
-	resp, err := client.HTTPRequest(ctx, http.MethodGet, url, "Bearer "+apiKey)
+func get(ctx context.Context, url, apiKey string, jsonResp any) (http.Header, error) {
+	resp, h, err := client.HTTPRequestWithRespHeaders(ctx, http.MethodGet, url, "Bearer "+apiKey, map[string]string{
+		"Accept": "application/json",
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var m map[string]any
-	return m, json.Unmarshal(resp, &m)
+	return h, json.Unmarshal(resp, jsonResp)
 }
@@ -2,6 +2,9 @@ package chatgpt
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 
@@ -9,6 +12,10 @@ import (
 	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
+// adminKeyPrefix identifies admin API keys, which can access only the
+// Administration API: https://platform.openai.com/docs/api-reference/administration.
+const adminKeyPrefix = "sk-admin-"
+
 var Template = links.NewTemplate(
 	"ChatGPT using a static API key",
 	[]string{
@@ -21,8 +28,49 @@ var Template = links.NewTemplate(
 )
 
 func apiKeyChecker(ctx context.Context, m map[string]string, _ *oauth.Config, _ *oauth2.Token) (string, error) {
-	if _, err := get(ctx, modelsURL, m["api_key"]); err != nil {
+	return checkAPIKey(ctx, baseURL, m["api_key"])
+}
+
+// checkAPIKey checks the given OpenAI API key, and returns metadata about
+// it in JSON format: the key type, the organization and project of the key
+// (based on response headers), the IDs of the models which are accessible
+// with it, and its rate limits (which are based on the organization's tier).
+func checkAPIKey(ctx context.Context, baseURL, apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", errors.New("missing API key")
+	}
+
+	md := metadata{KeyType: "regular"}
+	var h http.Header
+	var err error
+
+	if strings.HasPrefix(apiKey, adminKeyPrefix) {
+		md.KeyType = "admin"
+		h, err = listProjects(ctx, baseURL, apiKey)
+	} else {
+		var models []model
+		models, h, err = listModels(ctx, baseURL, apiKey)
+		md.Models = links.ModelIDs(models, func(m model) string { return m.ID })
+	}
+	if err != nil {
 		return "", err
 	}
-	return "", nil
+
+	// https://platform.openai.com/docs/api-reference/debugging-requests
+	// https://platform.openai.com/docs/guides/rate-limits#rate-limits-in-headers
+	md.Organization = h.Get("Openai-Organization")
+	md.Project = h.Get("Openai-Project")
+	md.RateLimitRequests = h.Get("X-Ratelimit-Limit-Requests")
+	md.RateLimitTokens = h.Get("X-Ratelimit-Limit-Tokens")
+
+	return links.EncodeMetadataAsJSON(md)
+}
+
+type metadata struct {
+	KeyType           string `json:"key_type"`
+	Models            string `json:"models,omitempty"`
+	Organization      string `json:"organization,omitempty"`
+	Project           string `json:"project,omitempty"`
+	RateLimitRequests string `json:"rate_limit_requests,omitempty"`
+	RateLimitTokens   string `json:"rate_limit_tokens,omitempty"`
 }
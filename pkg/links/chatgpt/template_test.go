@@ -0,0 +1,72 @@
+package chatgpt
+
+import (
+	"testing"
+
+	"github.com/tzrikka/thrippy/internal/links/llmtest"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	header := map[string]string{
+		"Openai-Organization":        "org-1",
+		"Openai-Project":             "proj_1",
+		"X-Ratelimit-Limit-Requests": "10000",
+		"X-Ratelimit-Limit-Tokens":   "30000000",
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantKey string // Expected by the test server.
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "missing_key",
+			wantErr: true,
+		},
+		{
+			name:    "invalid_key",
+			apiKey:  "sk-proj-bad",
+			wantKey: "sk-proj-key",
+			wantErr: true,
+		},
+		{
+			name:    "regular_key",
+			apiKey:  "sk-proj-key",
+			wantKey: "sk-proj-key",
+			want: `{"key_type":"regular","models":"gpt-4o,gpt-5","organization":"org-1","project":"proj_1",` +
+				`"rate_limit_requests":"10000","rate_limit_tokens":"30000000"}` + "\n",
+		},
+		{
+			name:    "admin_key",
+			apiKey:  "sk-admin-key",
+			wantKey: "sk-admin-key",
+			want:    `{"key_type":"admin","organization":"org-1"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := llmtest.NewServer(t, llmtest.Auth{Header: "Authorization", Value: "Bearer " + tt.wantKey}, map[string]llmtest.Response{
+				"/v1/models": {
+					Header: header,
+					Body:   `{"object": "list", "data": [{"id": "gpt-5", "object": "model"}, {"id": "gpt-4o", "object": "model"}]}`,
+				},
+				"/v1/organization/projects?limit=1": {
+					Header: map[string]string{"Openai-Organization": "org-1"},
+					Body:   `{"object": "list", "data": [], "has_more": false}`,
+				},
+			})
+			defer s.Close()
+
+			got, err := checkAPIKey(t.Context(), s.URL, tt.apiKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkAPIKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
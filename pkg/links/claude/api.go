@@ -4,29 +4,90 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/url"
 
+	"github.com/tzrikka/thrippy/internal/links"
 	"github.com/tzrikka/thrippy/pkg/client"
 )
 
 const (
-	modelsURL = "https://api.anthropic.com/v1/models"
-	version   = "anthropic-version: 2023-06-01"
-	// X-api-key.
+	baseURL = "https://api.anthropic.com"
+	version = "2023-06-01"
 )
 
-// get is an Anthropic-specific HTTP GET wrapper for [client.HTTPRequest].
+// https://docs.anthropic.com/en/api/models-list
+type listModelsResponse struct {
+	Data    []model `json:"data"`
+	HasMore bool    `json:"has_more"`
+	LastID  string  `json:"last_id,omitempty"`
+}
+
+// https://docs.anthropic.com/en/api/models-list
+type model struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// https://docs.anthropic.com/en/api/admin-api/organization/get-me
+type organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// listModels lists the models which are available to a regular API key.
+// Based on https://docs.anthropic.com/en/api/models-list.
+func listModels(ctx context.Context, baseURL, apiKey string) ([]model, http.Header, error) {
+	var first http.Header
+	models, err := links.ListModels(ctx, func(ctx context.Context, afterID string) ([]model, string, error) {
+		q := url.Values{}
+		q.Set("limit", "1000")
+		if afterID != "" {
+			q.Set("after_id", afterID)
+		}
+
+		resp := new(listModelsResponse)
+		h, err := get(ctx, baseURL+"/v1/models?"+q.Encode(), apiKey, resp)
+		if err != nil {
+			return nil, "", err
+		}
+		if first == nil {
+			first = h
+		}
+
+		if !resp.HasMore {
+			return resp.Data, "", nil
+		}
+		return resp.Data, resp.LastID, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return models, first, nil
+}
+
+// getOrganization checks an admin API key, which can't list models.
+// Based on https://docs.anthropic.com/en/api/admin-api/organization/get-me.
+func getOrganization(ctx context.Context, baseURL, apiKey string) (*organization, http.Header, error) {
+	resp := new(organization)
+	h, err := get(ctx, baseURL+"/v1/organizations/me", apiKey, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, h, nil
+}
+
+// get is an Anthropic-specific HTTP GET wrapper for [client.HTTPRequestWithRespHeaders].
 // Based on https://docs.anthropic.com/en/api/overview and
-// https://docs.anthropic.com/en/api/versioning and
-// https://docs.anthropic.com/en/api/models-list.
-func get(ctx context.Context, url, apiKey string) (map[string]any, error) {
-	resp, err := client.HTTPRequestWithHeaders(ctx, http.MethodGet, url, "", map[string]string{
-		"anthropic-version": "2023-06-01",
+// https://docs.anthropic.com/en/api/versioning.
+func get(ctx context.Context, url, apiKey string, jsonResp any) (http.Header, error) {
+	resp, h, err := client.HTTPRequestWithRespHeaders(ctx, http.MethodGet, url, "", map[string]string{
+		"Accept":            "application/json",
+		"anthropic-version": version,
 		"x-api-key":         apiKey,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	var m map[string]any
-	return m, json.Unmarshal(resp, &m)
+	return h, json.Unmarshal(resp, jsonResp)
 }
@@ -2,6 +2,9 @@ package claude
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 
@@ -9,6 +12,10 @@ import (
 	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
+// adminKeyPrefix identifies admin API keys, which can access only
+// the Admin API: https://docs.anthropic.com/en/api/administration-api.
+const adminKeyPrefix = "sk-ant-admin"
+
 var Template = links.NewTemplate(
 	"Claude using a static API key",
 	[]string{
@@ -21,8 +28,55 @@ var Template = links.NewTemplate(
 )
 
 func apiKeyChecker(ctx context.Context, m map[string]string, _ *oauth.Config, _ *oauth2.Token) (string, error) {
-	if _, err := get(ctx, modelsURL, m["api_key"]); err != nil {
+	return checkAPIKey(ctx, baseURL, m["api_key"])
+}
+
+// checkAPIKey checks the given Anthropic API key, and returns metadata about
+// it in JSON format: the key type, the organization of the key, the IDs of
+// the models which are accessible with it, and its rate limits (which
+// are based on the organization's tier, and reported in response headers).
+func checkAPIKey(ctx context.Context, baseURL, apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", errors.New("missing API key")
+	}
+
+	md := metadata{KeyType: "regular"}
+	var h http.Header
+	var err error
+
+	if strings.HasPrefix(apiKey, adminKeyPrefix) {
+		md.KeyType = "admin"
+		var org *organization
+		if org, h, err = getOrganization(ctx, baseURL, apiKey); err == nil {
+			md.OrganizationID = org.ID
+			md.OrganizationName = org.Name
+		}
+	} else {
+		var models []model
+		models, h, err = listModels(ctx, baseURL, apiKey)
+		md.Models = links.ModelIDs(models, func(m model) string { return m.ID })
+	}
+	if err != nil {
 		return "", err
 	}
-	return "", nil
+
+	// https://docs.anthropic.com/en/api/rate-limits#response-headers
+	if md.OrganizationID == "" {
+		md.OrganizationID = h.Get("Anthropic-Organization-Id")
+	}
+	md.RateLimitRequests = h.Get("Anthropic-Ratelimit-Requests-Limit")
+	md.RateLimitInputTokens = h.Get("Anthropic-Ratelimit-Input-Tokens-Limit")
+	md.RateLimitOutputTokens = h.Get("Anthropic-Ratelimit-Output-Tokens-Limit")
+
+	return links.EncodeMetadataAsJSON(md)
+}
+
+type metadata struct {
+	KeyType               string `json:"key_type"`
+	Models                string `json:"models,omitempty"`
+	OrganizationID        string `json:"organization_id,omitempty"`
+	OrganizationName      string `json:"organization_name,omitempty"`
+	RateLimitRequests     string `json:"rate_limit_requests,omitempty"`
+	RateLimitInputTokens  string `json:"rate_limit_input_tokens,omitempty"`
+	RateLimitOutputTokens string `json:"rate_limit_output_tokens,omitempty"`
 }
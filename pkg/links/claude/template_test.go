@@ -0,0 +1,76 @@
+package claude
+
+import (
+	"testing"
+
+	"github.com/tzrikka/thrippy/internal/links/llmtest"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	header := map[string]string{
+		"Anthropic-Organization-Id":               "org-uuid",
+		"Anthropic-Ratelimit-Requests-Limit":      "4000",
+		"Anthropic-Ratelimit-Input-Tokens-Limit":  "2000000",
+		"Anthropic-Ratelimit-Output-Tokens-Limit": "400000",
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantKey string // Expected by the test server.
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "missing_key",
+			wantErr: true,
+		},
+		{
+			name:    "invalid_key",
+			apiKey:  "sk-ant-api03-bad",
+			wantKey: "sk-ant-api03-key",
+			wantErr: true,
+		},
+		{
+			name:    "regular_key",
+			apiKey:  "sk-ant-api03-key",
+			wantKey: "sk-ant-api03-key",
+			want: `{"key_type":"regular","models":"claude-haiku-4-5,claude-opus-4-1,claude-sonnet-4-5",` +
+				`"organization_id":"org-uuid","rate_limit_requests":"4000",` +
+				`"rate_limit_input_tokens":"2000000","rate_limit_output_tokens":"400000"}` + "\n",
+		},
+		{
+			name:    "admin_key",
+			apiKey:  "sk-ant-admin01-key",
+			wantKey: "sk-ant-admin01-key",
+			want:    `{"key_type":"admin","organization_id":"org-uuid","organization_name":"Org"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := llmtest.NewServer(t, llmtest.Auth{Header: "x-api-key", Value: tt.wantKey}, map[string]llmtest.Response{
+				"/v1/models?limit=1000": {
+					Header: header,
+					Body: `{"data": [{"id": "claude-sonnet-4-5", "type": "model"}, {"id": "claude-opus-4-1", "type": "model"}],
+						"has_more": true, "last_id": "claude-opus-4-1"}`,
+				},
+				"/v1/models?after_id=claude-opus-4-1&limit=1000": {
+					Body: `{"data": [{"id": "claude-haiku-4-5", "type": "model"}], "has_more": false}`,
+				},
+				"/v1/organizations/me": {
+					Body: `{"id": "org-uuid", "type": "organization", "name": "Org"}`,
+				},
+			})
+			defer s.Close()
+
+			got, err := checkAPIKey(t.Context(), s.URL, tt.apiKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkAPIKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
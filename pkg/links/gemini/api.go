@@ -0,0 +1,63 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/pkg/client"
+)
+
+const (
+	baseURL = "https://generativelanguage.googleapis.com"
+)
+
+// https://ai.google.dev/api/models#response-body_1
+type listModelsResponse struct {
+	Models        []model `json:"models"`
+	NextPageToken string  `json:"nextPageToken,omitempty"`
+}
+
+// https://ai.google.dev/api/models#Model
+type model struct {
+	Name                       string   `json:"name"`
+	BaseModelID                string   `json:"baseModelId,omitempty"`
+	Version                    string   `json:"version,omitempty"`
+	DisplayName                string   `json:"displayName,omitempty"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods,omitempty"`
+}
+
+// listModels lists the models which are available through the Gemini API.
+// Based on https://ai.google.dev/api/models#method:-models.list and
+// https://ai.google.dev/gemini-api/docs/api-key.
+func listModels(ctx context.Context, baseURL, apiKey string) ([]model, error) {
+	return links.ListModels(ctx, func(ctx context.Context, pageToken string) ([]model, string, error) {
+		q := url.Values{}
+		q.Set("pageSize", "1000")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+
+		resp, err := get(ctx, baseURL+"/v1beta/models?"+q.Encode(), apiKey)
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Models, resp.NextPageToken, nil
+	})
+}
+
+// get is a Gemini-specific HTTP GET wrapper for [client.HTTPRequestWithHeaders].
+func get(ctx context.Context, url, apiKey string) (*listModelsResponse, error) {
+	resp, err := client.HTTPRequestWithHeaders(ctx, http.MethodGet, url, "", map[string]string{
+		"Accept":         "application/json",
+		"x-goog-api-key": apiKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(listModelsResponse)
+	return m, json.Unmarshal(resp, m)
+}
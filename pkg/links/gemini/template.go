@@ -1,7 +1,16 @@
 package gemini
 
 import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/oauth2"
+
 	"github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
 var Template = links.NewTemplate(
@@ -13,5 +22,52 @@ var Template = links.NewTemplate(
 	},
 	[]string{"api_key_manual"},
 	nil,
-	nil,
+	apiKeyChecker,
 )
+
+func apiKeyChecker(ctx context.Context, m map[string]string, _ *oauth.Config, _ *oauth2.Token) (string, error) {
+	return checkAPIKey(ctx, baseURL, m["api_key"])
+}
+
+// checkAPIKey checks the given Gemini API key,
+// and returns metadata about it in JSON format.
+func checkAPIKey(ctx context.Context, baseURL, apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", errors.New("missing API key")
+	}
+
+	models, err := listModels(ctx, baseURL, apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	var families []string
+	for _, m := range models {
+		families = append(families, modelFamily(m.Name))
+	}
+	slices.Sort(families)
+
+	return links.EncodeMetadataAsJSON(metadata{
+		ModelCount:    len(models),
+		ModelFamilies: strings.Join(slices.Compact(families), ","),
+	})
+}
+
+// modelFamily returns the family of the given model, i.e. its name up to
+// and including its version number, e.g. "gemini-2.5" for "models/gemini-2.5-pro",
+// and "gemma-3" for "models/gemma-3-27b-it".
+func modelFamily(name string) string {
+	name = strings.TrimPrefix(name, "models/")
+	parts := strings.Split(name, "-")
+	for i, p := range parts {
+		if p != "" && unicode.IsDigit(rune(p[0])) {
+			return strings.Join(parts[:i+1], "-")
+		}
+	}
+	return name
+}
+
+type metadata struct {
+	ModelCount    int    `json:"model_count"`
+	ModelFamilies string `json:"model_families"`
+}
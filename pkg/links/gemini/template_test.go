@@ -0,0 +1,75 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/tzrikka/thrippy/internal/links/llmtest"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	s := llmtest.NewServer(t, llmtest.Auth{Header: "x-goog-api-key", Value: "key"}, map[string]llmtest.Response{
+		"/v1beta/models?pageSize=1000": {
+			Body: `{"models": [{"name": "models/gemini-2.5-pro"}, {"name": "models/gemini-2.5-flash"},
+				{"name": "models/embedding-001"}], "nextPageToken": "page2"}`,
+		},
+		"/v1beta/models?pageSize=1000&pageToken=page2": {
+			Body: `{"models": [{"name": "models/gemma-3-27b-it"}, {"name": "models/aqa"}]}`,
+		},
+	})
+	defer s.Close()
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "missing_key",
+			wantErr: true,
+		},
+		{
+			name:    "invalid_key",
+			apiKey:  "bad",
+			wantErr: true,
+		},
+		{
+			name:   "valid_key",
+			apiKey: "key",
+			want:   `{"model_count":5,"model_families":"aqa,embedding-001,gemini-2.5,gemma-3"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkAPIKey(t.Context(), s.URL, tt.apiKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkAPIKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "models/gemini-2.5-pro", want: "gemini-2.5"},
+		{name: "models/gemini-2.0-flash-001", want: "gemini-2.0"},
+		{name: "models/gemma-3-27b-it", want: "gemma-3"},
+		{name: "models/text-embedding-004", want: "text-embedding-004"},
+		{name: "models/aqa", want: "aqa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := modelFamily(tt.name); got != tt.want {
+				t.Errorf("modelFamily() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
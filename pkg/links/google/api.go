@@ -2,14 +2,21 @@ package google
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	googleoauth2 "google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
 
 	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
+const timeout = 3 * time.Second
+
 func oauthUserInfo(ctx context.Context, o *oauth.Config, t *oauth2.Token) (*googleoauth2.Userinfo, *googleoauth2.Tokeninfo, error) {
 	// https://github.com/googleapis/google-api-go-client
 	opt := option.WithTokenSource(o.Config.TokenSource(ctx, t))
@@ -48,3 +55,33 @@ func serviceAccountInfo(ctx context.Context, jsonKey string) (string, string, er
 
 	return ui.Email, ui.Id, nil
 }
+
+// serviceAccountToken mints a short-lived access token for the scopes which
+// are configured in the given link credentials (see [serviceAccountScopes]).
+// If there's also a subject (a Google Workspace user's email address), the
+// token impersonates that user, based on domain-wide delegation:
+// https://developers.google.com/identity/protocols/oauth2/service-account#delegatingauthority
+func serviceAccountToken(ctx context.Context, m map[string]string) (*oauth2.Token, error) {
+	scopes := serviceAccountScopes(m)
+	if len(scopes) == 0 {
+		if m["subject"] != "" {
+			return nil, errors.New("domain-wide delegation subject requires scopes")
+		}
+		return nil, nil
+	}
+
+	cfg, err := google.JWTConfigFromJSON([]byte(m["key"]), scopes...)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Subject = m["subject"]
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: timeout})
+	return cfg.TokenSource(ctx).Token()
+}
+
+// serviceAccountScopes parses the comma or space separated
+// scopes which are configured in the given link credentials.
+func serviceAccountScopes(m map[string]string) []string {
+	return strings.Fields(strings.ReplaceAll(m["scopes"], ",", " "))
+}
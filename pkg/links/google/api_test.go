@@ -0,0 +1,119 @@
+package google
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestServiceAccountToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotSub, gotScope string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(r.PostForm.Get("assertion"), claims, func(_ *jwt.Token) (any, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithIssuer("sa@project.iam.gserviceaccount.com"), jwt.WithExpirationRequired())
+		if err != nil {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		gotSub, _ = claims["sub"].(string)
+		gotScope, _ = claims["scope"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	jsonKey, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "kid",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "sa@project.iam.gserviceaccount.com",
+		"token_uri":      ts.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		scopes    string
+		subject   string
+		wantToken bool
+		wantScope string
+		wantErr   bool
+	}{
+		{
+			name: "no_scopes",
+		},
+		{
+			name:    "subject_without_scopes",
+			subject: "user@example.com",
+			wantErr: true,
+		},
+		{
+			name:      "scopes",
+			scopes:    "https://www.googleapis.com/auth/drive.readonly, https://www.googleapis.com/auth/gmail.readonly",
+			wantToken: true,
+			wantScope: "https://www.googleapis.com/auth/drive.readonly https://www.googleapis.com/auth/gmail.readonly",
+		},
+		{
+			name:      "domain_wide_delegation",
+			scopes:    "https://www.googleapis.com/auth/admin.directory.user.readonly",
+			subject:   "user@example.com",
+			wantToken: true,
+			wantScope: "https://www.googleapis.com/auth/admin.directory.user.readonly",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSub, gotScope = "", ""
+			m := map[string]string{"key": string(jsonKey), "scopes": tt.scopes, "subject": tt.subject}
+
+			got, err := serviceAccountToken(t.Context(), m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serviceAccountToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantToken {
+				t.Fatalf("serviceAccountToken() = %v, want token: %v", got, tt.wantToken)
+			}
+			if !tt.wantToken {
+				return
+			}
+
+			if got.AccessToken != "token" {
+				t.Errorf("serviceAccountToken() access token = %q, want %q", got.AccessToken, "token")
+			}
+			if gotSub != tt.subject {
+				t.Errorf("assertion subject = %q, want %q", gotSub, tt.subject)
+			}
+			if gotScope != tt.wantScope {
+				t.Errorf("assertion scope = %q, want %q", gotScope, tt.wantScope)
+			}
+		})
+	}
+}
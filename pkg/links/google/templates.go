@@ -5,6 +5,7 @@ import (
 	"errors"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -21,10 +22,10 @@ var ServiceAccountTemplate = links.NewTemplate(
 		"https://developers.google.com/identity/protocols/oauth2/service-account",
 		"https://console.cloud.google.com/iam-admin/serviceaccounts",
 	},
-	[]string{"key_manual"},
+	[]string{"key_manual", "scopes_manual_optional", "subject_manual_optional"},
 	nil,
 	serviceKeyChecker,
-)
+).WithTokenFunc(serviceAccountToken)
 
 var UserOAuthTemplate = links.NewTemplate(
 	"Google APIs using OAuth 2.0 to act on behalf of a user",
@@ -35,7 +36,7 @@ var UserOAuthTemplate = links.NewTemplate(
 	links.OAuthCredFields,
 	oauthModifier,
 	userTokenChecker,
-)
+).WithScopesFunc(addScopes)
 
 // oauthModifier adjusts the given [oauth.Config] for Google
 // OAuth 2.0 authorizations, to act on behalf of a user.
@@ -67,6 +68,24 @@ func oauthModifier(o *oauth.Config) {
 	}
 }
 
+// addScopes adjusts the given [oauth.Config] of an existing link to request
+// additional scopes, along with all the scopes that the user already granted
+// to the app (i.e. incremental authorization), based on:
+// https://developers.google.com/identity/protocols/oauth2/web-server#incrementalAuth
+func addScopes(o *oauth.Config, scopes, userScopes []string) error {
+	if len(userScopes) > 0 {
+		return errors.New("user scopes are not supported by Google")
+	}
+
+	o.Config.Scopes = append(o.Config.Scopes, scopes...)
+
+	if o.AuthCodes == nil {
+		o.AuthCodes = map[string]string{}
+	}
+	o.AuthCodes["include_granted_scopes"] = "true"
+	return nil
+}
+
 // userTokenChecker checks the given OAuth token,
 // and returns metadata about its owner in JSON format.
 func userTokenChecker(ctx context.Context, _ map[string]string, o *oauth.Config, t *oauth2.Token) (string, error) {
@@ -89,12 +108,18 @@ func userTokenChecker(ctx context.Context, _ map[string]string, o *oauth.Config,
 
 // serviceKeyChecker checks the given Google Cloud service
 // account key, and returns metadata about it in JSON format.
+// If the key is configured to mint access tokens, it also
+// checks that (including domain-wide delegation, if used).
 func serviceKeyChecker(ctx context.Context, m map[string]string, _ *oauth.Config, _ *oauth2.Token) (string, error) {
 	email, id, err := serviceAccountInfo(ctx, m["key"])
 	if err != nil {
 		return "", err
 	}
 
+	if _, err := serviceAccountToken(ctx, m); err != nil {
+		return "", err
+	}
+
 	matches := regexp.MustCompile(`"project_id":\s*"(.*?)"`).FindStringSubmatch(m["key"])
 	if len(matches) < 2 {
 		return "", errors.New("project ID not found in service account key")
@@ -103,7 +128,9 @@ func serviceKeyChecker(ctx context.Context, m map[string]string, _ *oauth.Config
 	return links.EncodeMetadataAsJSON(oauthMetadata{
 		Email:   email,
 		ID:      id,
+		Scopes:  strings.Join(serviceAccountScopes(m), " "),
 		Project: matches[1],
+		Subject: m["subject"],
 	})
 }
 
@@ -117,4 +144,5 @@ type oauthMetadata struct {
 	Scopes        string `json:"scopes,omitempty"`
 	VerifiedEmail string `json:"verified_email,omitempty"`
 	Project       string `json:"project,omitempty"`
+	Subject       string `json:"subject,omitempty"`
 }
@@ -26,6 +26,9 @@ var Templates = map[string]links.Template{
 	"confluence-app-oauth":  confluence.OAuthTemplate,
 	"confluence-user-token": confluence.APITokenTemplate,
 	"gemini":                gemini.Template,
+	"generic-client-credentials": links.NewTemplate(
+		"Generic link using the OAuth 2.0 client credentials or JWT bearer grant", nil, links.ClientCredsFields, nil, nil,
+	).WithClientCredentialsGrant(),
 	"generic-oauth": links.NewTemplate(
 		"Generic link", nil, nil, nil, nil,
 	),
@@ -5,9 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/oauth"
+)
+
+const (
+	timeout = 3 * time.Second
+	maxSize = 1 << 20 // 1 MiB.
 )
 
 // https://docs.slack.dev/reference/methods/auth.test/
@@ -43,6 +53,47 @@ type bot struct {
 	Updated int64  `json:"updated"`
 }
 
+// https://docs.slack.dev/reference/methods/oauth.v2.access
+type oauthV2AccessResponse struct {
+	response
+
+	AccessToken     string           `json:"access_token,omitempty"`
+	TokenType       string           `json:"token_type,omitempty"`
+	Scope           string           `json:"scope,omitempty"`
+	RefreshToken    string           `json:"refresh_token,omitempty"`
+	ExpiresIn       int64            `json:"expires_in,omitempty"`
+	BotUserID       string           `json:"bot_user_id,omitempty"`
+	AppID           string           `json:"app_id,omitempty"`
+	Team            *idName          `json:"team,omitempty"`
+	Enterprise      *idName          `json:"enterprise,omitempty"`
+	AuthedUser      *authedUser      `json:"authed_user,omitempty"`
+	IncomingWebhook *incomingWebhook `json:"incoming_webhook,omitempty"`
+}
+
+type idName struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// https://docs.slack.dev/authentication/tokens#user
+type authedUser struct {
+	ID           string `json:"id"`
+	Scope        string `json:"scope,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Expiry       string `json:"expiry,omitempty"` // Not in Slack responses, based on ExpiresIn.
+}
+
+// https://docs.slack.dev/messaging/sending-messages-using-incoming-webhooks
+type incomingWebhook struct {
+	Channel          string `json:"channel,omitempty"`
+	ChannelID        string `json:"channel_id,omitempty"`
+	ConfigurationURL string `json:"configuration_url,omitempty"`
+	URL              string `json:"url,omitempty"`
+}
+
 type response struct {
 	OK               bool              `json:"ok"`
 	Error            string            `json:"error,omitempty"`
@@ -116,6 +167,51 @@ func webSocketURL(ctx context.Context, baseURL, appLevelToken string) error {
 	return nil
 }
 
+// oauthV2Access exchanges a refresh token for a new access token (and a new
+// refresh token), when the Slack app has token rotation enabled. Based on
+// https://docs.slack.dev/reference/methods/oauth.v2.access/ and
+// https://docs.slack.dev/authentication/using-token-rotation/
+func oauthV2Access(ctx context.Context, o *oauth.Config, refreshToken string) (*oauthV2AccessResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Config.Endpoint.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(o.Config.ClientID, o.Config.ClientSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s: %s", resp.Status, string(body))
+	}
+
+	// Slack reports errors with "ok": false, not with standard OAuth 2.0 error responses.
+	r := new(oauthV2AccessResponse)
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, err
+	}
+	if !r.OK {
+		return nil, errors.New(r.Error)
+	}
+	return r, nil
+}
+
 // get is a Slack-specific HTTP GET wrapper for [client.HTTPRequest].
 func get(ctx context.Context, url, botToken string, jsonResp any) error {
 	resp, err := client.HTTPRequest(ctx, http.MethodGet, url, "Bearer "+botToken)
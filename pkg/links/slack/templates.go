@@ -2,13 +2,18 @@ package slack
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/internal/logger"
 	"github.com/tzrikka/thrippy/pkg/oauth"
 )
 
@@ -37,7 +42,7 @@ var OAuthTemplate = links.NewTemplate(
 	append(links.OAuthCredFields, "signing_secret_manual"),
 	oauthModifier(defaultBaseURL),
 	oauthChecker,
-)
+).WithScopesFunc(addScopes).WithRefreshFunc(refreshToken).WithTokenExtras(tokenExtras)
 
 var OAuthGovTemplate = links.NewTemplate(
 	"GovSlack app using OAuth v2",
@@ -48,7 +53,7 @@ var OAuthGovTemplate = links.NewTemplate(
 	append(links.OAuthCredFields, "signing_secret_manual_optional"),
 	oauthModifier(govBaseURL),
 	govOAuthChecker,
-)
+).WithScopesFunc(addScopes).WithRefreshFunc(refreshToken).WithTokenExtras(tokenExtras)
 
 var SocketModeTemplate = links.NewTemplate(
 	`Private Slack "Socket Mode" app using a static app-level token`,
@@ -86,22 +91,235 @@ func oauthModifier(baseURL string) func(*oauth.Config) {
 	}
 }
 
+// addScopes adjusts the given [oauth.Config] of an existing link to request
+// additional bot scopes and/or user scopes. Slack apps request user scopes
+// with a separate, comma-separated URL parameter, which is merged too, see:
+// https://docs.slack.dev/authentication/installing-with-oauth#asking
+func addScopes(o *oauth.Config, scopes, userScopes []string) error {
+	o.Config.Scopes = append(o.Config.Scopes, scopes...)
+	if len(userScopes) == 0 {
+		return nil
+	}
+
+	if o.AuthCodes == nil {
+		o.AuthCodes = map[string]string{}
+	}
+
+	var us []string
+	if v := o.AuthCodes["user_scope"]; v != "" {
+		us = strings.Split(v, ",")
+	}
+	us = append(us, userScopes...)
+	slices.Sort(us)
+	o.AuthCodes["user_scope"] = strings.Join(slices.Compact(us), ",")
+	return nil
+}
+
 // botTokenChecker checks the given static bot token for
 // Slack, and returns metadata about it in JSON format.
 func botTokenChecker(ctx context.Context, m map[string]string, _ *oauth.Config, _ *oauth2.Token) (string, error) {
 	return genericChecker(ctx, m["bot_token"], defaultBaseURL)
 }
 
-// oauthChecker checks the given static bot token for
+// refreshToken rotates the given Slack OAuth token, when the Slack app has token
+// rotation enabled, based on https://docs.slack.dev/authentication/using-token-rotation.
+// Slack's refresh responses are non-standard, and the installing user's token (if
+// any) is separate from the bot token, with its own refresh token, so both are
+// rotated together. Extra details which aren't in the responses are preserved.
+//
+// A failure to rotate the user token doesn't discard the rotated bot token, because
+// Slack has already revoked the previous one: it's logged, and the user's previous
+// details are preserved, so the user token rotation is retried next time.
+func refreshToken(ctx context.Context, o *oauth.Config, t *oauth2.Token) (*oauth2.Token, error) {
+	if t.RefreshToken == "" {
+		return nil, errors.New("missing refresh token")
+	}
+
+	resp, err := oauthV2Access(ctx, o, t.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("bot token rotation error: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("bot token rotation error: missing access token")
+	}
+
+	nt := &oauth2.Token{
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		RefreshToken: resp.RefreshToken,
+		ExpiresIn:    resp.ExpiresIn,
+	}
+
+	extras := map[string]any{}
+	for _, k := range []string{"incoming_webhook", "team", "enterprise"} {
+		if v := extraJSON(t, k); v != "" {
+			extras[k] = v
+		}
+	}
+	if resp.Team != nil {
+		extras["team"] = resp.Team
+	}
+	if resp.Enterprise != nil {
+		extras["enterprise"] = resp.Enterprise
+	}
+
+	user := tokenAuthedUser(t)
+	if user != nil && user.RefreshToken != "" {
+		uresp, err := oauthV2Access(ctx, o, user.RefreshToken)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Slack user token rotation error", slog.Any("error", err), slog.String("user_id", user.ID))
+		} else {
+			user = rotatedUser(user, uresp)
+		}
+	}
+	if user != nil {
+		extras["authed_user"] = user
+	}
+
+	return nt.WithExtra(extras), nil
+}
+
+// rotatedUser returns the installing user's details after a user token rotation.
+// Slack may return the new user token either at the top level of the response,
+// or in the "authed_user" object (like in the initial OAuth token exchange).
+func rotatedUser(old *authedUser, resp *oauthV2AccessResponse) *authedUser {
+	u := &authedUser{
+		ID:           old.ID,
+		Scope:        resp.Scope,
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		RefreshToken: resp.RefreshToken,
+		ExpiresIn:    resp.ExpiresIn,
+	}
+	if au := resp.AuthedUser; au != nil && au.AccessToken != "" {
+		u = au
+		if u.ID == "" {
+			u.ID = old.ID
+		}
+	}
+
+	if u.Scope == "" {
+		u.Scope = old.Scope
+	}
+	if u.RefreshToken == "" {
+		u.RefreshToken = old.RefreshToken
+	}
+	u.Expiry = ""
+	return u
+}
+
+// tokenExtras extracts the non-standard details of Slack OAuth tokens, to store
+// them with the token: the installing user's token, the incoming webhook, and
+// the Slack team and enterprise. The user token and webhook URL are also stored
+// separately, so they can be returned as the link's credentials.
+func tokenExtras(t *oauth2.Token) map[string]string {
+	m := map[string]string{}
+	for _, k := range []string{"incoming_webhook", "team", "enterprise"} {
+		if v := extraJSON(t, k); v != "" {
+			m[k] = v
+		}
+	}
+
+	if u := tokenAuthedUser(t); u != nil {
+		if u.Expiry == "" && u.ExpiresIn > 0 {
+			u.Expiry = time.Now().Add(time.Second * time.Duration(u.ExpiresIn)).UTC().Format(time.RFC3339)
+		}
+		if j, err := json.Marshal(u); err == nil {
+			m["authed_user"] = string(j)
+		}
+		if u.AccessToken != "" {
+			m["user_access_token"] = u.AccessToken
+		}
+	}
+
+	if w := tokenIncomingWebhook(t); w != nil && w.URL != "" {
+		m["incoming_webhook_url"] = w.URL
+	}
+
+	return m
+}
+
+// extraJSON returns the given extra field of an OAuth token as a JSON string. The
+// field's value is a JSON object in token exchange and refresh responses, and
+// a JSON-encoded string after being stored with the token (in its "raw" map).
+func extraJSON(t *oauth2.Token, key string) string {
+	switch v := t.Extra(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		j, err := json.Marshal(v)
+		if err != nil || string(j) == "null" {
+			return ""
+		}
+		return string(j)
+	}
+}
+
+func tokenAuthedUser(t *oauth2.Token) *authedUser {
+	u := new(authedUser)
+	if j := extraJSON(t, "authed_user"); j == "" || json.Unmarshal([]byte(j), u) != nil || u.ID == "" {
+		return nil
+	}
+	return u
+}
+
+func tokenIncomingWebhook(t *oauth2.Token) *incomingWebhook {
+	w := new(incomingWebhook)
+	if j := extraJSON(t, "incoming_webhook"); j == "" || json.Unmarshal([]byte(j), w) != nil {
+		return nil
+	}
+	return w
+}
+
+func tokenEnterprise(t *oauth2.Token) *idName {
+	e := new(idName)
+	if j := extraJSON(t, "enterprise"); j == "" || json.Unmarshal([]byte(j), e) != nil || e.ID == "" {
+		return nil
+	}
+	return e
+}
+
+// oauthChecker checks the given OAuth token for
 // Slack, and returns metadata about it in JSON format.
 func oauthChecker(ctx context.Context, _ map[string]string, _ *oauth.Config, t *oauth2.Token) (string, error) {
-	return genericChecker(ctx, t.AccessToken, defaultBaseURL)
+	return oauthTokenChecker(ctx, t, defaultBaseURL)
 }
 
-// govOAuthChecker checks the given static bot token for
+// govOAuthChecker checks the given OAuth token for
 // GovSlack, and returns metadata about it in JSON format.
 func govOAuthChecker(ctx context.Context, _ map[string]string, _ *oauth.Config, t *oauth2.Token) (string, error) {
-	return genericChecker(ctx, t.AccessToken, govBaseURL)
+	return oauthTokenChecker(ctx, t, govBaseURL)
+}
+
+// oauthTokenChecker checks the given OAuth token, and returns metadata about it
+// in JSON format, including the non-standard details of Slack OAuth tokens
+// (see [tokenExtras]), except for secrets such as the user token.
+func oauthTokenChecker(ctx context.Context, t *oauth2.Token, baseURL string) (string, error) {
+	md, err := botMetadata(ctx, t.AccessToken, baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	md.TokenRotation = strings.HasPrefix(t.AccessToken, "xoxe.") || t.RefreshToken != ""
+	if u := tokenAuthedUser(t); u != nil {
+		md.AuthedUserID = u.ID
+		md.AuthedUserScopes = u.Scope
+	}
+	if w := tokenIncomingWebhook(t); w != nil {
+		md.IncomingWebhookChannel = w.Channel
+		md.IncomingWebhookChannelID = w.ChannelID
+		md.IncomingWebhookConfigURL = w.ConfigurationURL
+	}
+	if e := tokenEnterprise(t); e != nil {
+		md.EnterpriseName = e.Name
+		if md.EnterpriseID == "" {
+			md.EnterpriseID = e.ID
+		}
+	}
+
+	return links.EncodeMetadataAsJSON(md)
 }
 
 // socketModeChecker checks the given app-level token for Slack Socket Mode, as
@@ -120,21 +338,29 @@ func socketModeChecker(ctx context.Context, m map[string]string, _ *oauth.Config
 }
 
 func genericChecker(ctx context.Context, botToken, baseURL string) (string, error) {
+	md, err := botMetadata(ctx, botToken, baseURL)
+	if err != nil {
+		return "", err
+	}
+	return links.EncodeMetadataAsJSON(md)
+}
+
+func botMetadata(ctx context.Context, botToken, baseURL string) (*metadata, error) {
 	if botToken == "" {
-		return "", errors.New("missing bot token")
+		return nil, errors.New("missing bot token")
 	}
 
 	auth, err := authTest(ctx, baseURL, botToken)
 	if err != nil {
-		return "", fmt.Errorf("auth test error: %w", err)
+		return nil, fmt.Errorf("auth test error: %w", err)
 	}
 
 	bot, err := botsInfo(ctx, baseURL, botToken, auth)
 	if err != nil {
-		return "", fmt.Errorf("bot info error: %w", err)
+		return nil, fmt.Errorf("bot info error: %w", err)
 	}
 
-	return links.EncodeMetadataAsJSON(metadata{
+	return &metadata{
 		AppID:        bot.AppID,
 		BotID:        bot.ID,
 		BotName:      bot.Name,
@@ -145,7 +371,7 @@ func genericChecker(ctx context.Context, botToken, baseURL string) (string, erro
 		URL:          auth.URL,
 		UserID:       auth.UserID,
 		UserName:     auth.User,
-	})
+	}, nil
 }
 
 type metadata struct {
@@ -159,4 +385,13 @@ type metadata struct {
 	URL          string `json:"url"`
 	UserID       string `json:"user_id"`
 	UserName     string `json:"user_name"`
+
+	// OAuth only.
+	AuthedUserID             string `json:"authed_user_id,omitempty"`
+	AuthedUserScopes         string `json:"authed_user_scopes,omitempty"`
+	EnterpriseName           string `json:"enterprise_name,omitempty"`
+	IncomingWebhookChannel   string `json:"incoming_webhook_channel,omitempty"`
+	IncomingWebhookChannelID string `json:"incoming_webhook_channel_id,omitempty"`
+	IncomingWebhookConfigURL string `json:"incoming_webhook_configuration_url,omitempty"`
+	TokenRotation            bool   `json:"token_rotation,omitempty"`
 }
@@ -0,0 +1,163 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/tzrikka/thrippy/pkg/oauth"
+)
+
+func TestRefreshToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			t.Errorf("basic auth = %q, %q, want %q, %q", id, secret, "id", "secret")
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+			t.Errorf("unexpected request form: %v", r.PostForm)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("refresh_token") {
+		case "xoxe-1-bot":
+			_, _ = w.Write([]byte(`{"ok": true, "app_id": "A1", "access_token": "xoxe.xoxb-2", "token_type": "bot",
+				"refresh_token": "xoxe-2-bot", "expires_in": 43200, "bot_user_id": "U0",
+				"team": {"id": "T1", "name": "Team"}, "enterprise": null, "authed_user": {"id": "U1"}}`))
+		case "xoxe-1-user":
+			_, _ = w.Write([]byte(`{"ok": true, "app_id": "A1", "access_token": "xoxe.xoxp-2", "token_type": "user",
+				"refresh_token": "xoxe-2-user", "expires_in": 43200, "scope": "search:read"}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok": false, "error": "invalid_refresh_token"}`))
+		}
+	}))
+	defer ts.Close()
+
+	o := &oauth.Config{Config: &oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: ts.URL},
+	}}
+
+	// Stored tokens have their extra details in their "raw" map, as JSON strings.
+	stored := (&oauth2.Token{AccessToken: "xoxe.xoxb-1", RefreshToken: "xoxe-1-bot"}).WithExtra(map[string]any{
+		"authed_user":          `{"id":"U1","scope":"search:read","access_token":"xoxe.xoxp-1","refresh_token":"xoxe-1-user"}`,
+		"incoming_webhook":     `{"channel":"#general","url":"https://hooks.slack.com/services/1"}`,
+		"incoming_webhook_url": "https://hooks.slack.com/services/1",
+		"signing_secret":       "signing",
+	})
+
+	got, err := refreshToken(t.Context(), o, stored)
+	if err != nil {
+		t.Fatalf("refreshToken() error = %v", err)
+	}
+	if got.AccessToken != "xoxe.xoxb-2" || got.RefreshToken != "xoxe-2-bot" || got.ExpiresIn != 43200 {
+		t.Errorf("refreshToken() = %+v", got)
+	}
+
+	extras := tokenExtras(got)
+	want := map[string]string{
+		"incoming_webhook":     `{"channel":"#general","url":"https://hooks.slack.com/services/1"}`,
+		"incoming_webhook_url": "https://hooks.slack.com/services/1",
+		"team":                 `{"id":"T1","name":"Team"}`,
+		"user_access_token":    "xoxe.xoxp-2",
+	}
+	for k, v := range want {
+		if extras[k] != v {
+			t.Errorf("tokenExtras()[%q] = %q, want %q", k, extras[k], v)
+		}
+	}
+	if _, found := extras["enterprise"]; found {
+		t.Errorf("tokenExtras() = %v, want no enterprise", extras)
+	}
+
+	u := new(authedUser)
+	if err := json.Unmarshal([]byte(extras["authed_user"]), u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != "U1" || u.AccessToken != "xoxe.xoxp-2" || u.RefreshToken != "xoxe-2-user" || u.Scope != "search:read" {
+		t.Errorf("tokenExtras() authed user = %+v", u)
+	}
+	if _, err := time.Parse(time.RFC3339, u.Expiry); err != nil {
+		t.Errorf("tokenExtras() authed user expiry = %q", u.Expiry)
+	}
+
+	// User token rotation failure: keep the rotated bot token, and the previous user details.
+	stored = (&oauth2.Token{AccessToken: "xoxe.xoxb-1", RefreshToken: "xoxe-1-bot"}).WithExtra(map[string]any{
+		"authed_user": `{"id":"U1","scope":"search:read","access_token":"xoxe.xoxp-1","refresh_token":"bad"}`,
+	})
+	got, err = refreshToken(t.Context(), o, stored)
+	if err != nil {
+		t.Fatalf("refreshToken() with an invalid user refresh token error = %v", err)
+	}
+	if got.AccessToken != "xoxe.xoxb-2" || got.RefreshToken != "xoxe-2-bot" {
+		t.Errorf("refreshToken() with an invalid user refresh token = %+v", got)
+	}
+	u = new(authedUser)
+	if err := json.Unmarshal([]byte(tokenExtras(got)["authed_user"]), u); err != nil {
+		t.Fatal(err)
+	}
+	if u.AccessToken != "xoxe.xoxp-1" || u.RefreshToken != "bad" {
+		t.Errorf("tokenExtras() authed user = %+v, want the previous one", u)
+	}
+
+	if _, err := refreshToken(t.Context(), o, &oauth2.Token{RefreshToken: "bad"}); err == nil {
+		t.Error("refreshToken() with an invalid refresh token error = nil")
+	}
+}
+
+func TestTokenExtrasFromExchange(t *testing.T) {
+	// Based on: https://docs.slack.dev/reference/methods/oauth.v2.access
+	var raw map[string]any
+	j := `{"ok": true, "access_token": "xoxe.xoxb-1", "token_type": "bot", "refresh_token": "xoxe-1-bot",
+		"expires_in": 43200, "team": {"name": "Team", "id": "T1"}, "enterprise": {"name": "Org", "id": "E1"},
+		"authed_user": {"id": "U1", "scope": "chat:write", "access_token": "xoxp-1", "token_type": "user"},
+		"incoming_webhook": {"channel": "#general", "channel_id": "C1", "url": "https://hooks.slack.com/services/1"}}`
+	if err := json.Unmarshal([]byte(j), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	got := tokenExtras((&oauth2.Token{AccessToken: "xoxe.xoxb-1"}).WithExtra(raw))
+	want := map[string]string{
+		"authed_user":          `{"id":"U1","scope":"chat:write","access_token":"xoxp-1","token_type":"user"}`,
+		"enterprise":           `{"id":"E1","name":"Org"}`,
+		"incoming_webhook":     `{"channel":"#general","channel_id":"C1","url":"https://hooks.slack.com/services/1"}`,
+		"incoming_webhook_url": "https://hooks.slack.com/services/1",
+		"team":                 `{"id":"T1","name":"Team"}`,
+		"user_access_token":    "xoxp-1",
+	}
+	if len(got) != len(want) {
+		t.Errorf("tokenExtras() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if strings.HasPrefix(v, "{") {
+			if !sameJSON(t, got[k], v) {
+				t.Errorf("tokenExtras()[%q] = %s, want %s", k, got[k], v)
+			}
+			continue
+		}
+		if got[k] != v {
+			t.Errorf("tokenExtras()[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func sameJSON(t *testing.T, a, b string) bool {
+	t.Helper()
+
+	var ma, mb map[string]any
+	if err := json.Unmarshal([]byte(a), &ma); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(b), &mb); err != nil {
+		t.Fatal(err)
+	}
+
+	ja, _ := json.Marshal(ma)
+	jb, _ := json.Marshal(mb)
+	return string(ja) == string(jb)
+}
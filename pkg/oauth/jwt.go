@@ -0,0 +1,167 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lithammer/shortuuid/v4"
+)
+
+// Link parameters which aren't injected into URLs, but stored with the link,
+// and control the token requests of machine-to-machine links (see
+// [Config.ClientCredentialsToken]). Private keys for signing JWT
+// assertions are stored as link credentials (see [PrivateKeyCred]).
+const (
+	// ClientAuthParam selects the client authentication method in token requests:
+	// [ClientAuthPrivateKeyJWT], or by default the client secret.
+	ClientAuthParam = "client_auth"
+	// GrantTypeParam selects the authorization grant of token requests:
+	// [GrantTypeJWTBearer], or by default the client credentials grant.
+	GrantTypeParam = "grant_type"
+	// SubjectParam is the "sub" claim of JWT bearer grant assertions, e.g. a Salesforce
+	// username, or a Google Workspace user's email address. The default is the client ID.
+	SubjectParam = "subject"
+	// KeyIDParam is the optional "kid" header of JWT assertions.
+	KeyIDParam = "key_id"
+
+	// ClientAuthPrivateKeyJWT is client authentication with a JWT
+	// assertion which is signed by the link's private key, instead of
+	// a client secret (RFC 7523 section 2.2, OpenID Connect Core 1.0).
+	ClientAuthPrivateKeyJWT = "private_key_jwt"
+	// GrantTypeJWTBearer is the JWT bearer authorization grant, which exchanges
+	// a JWT assertion that is signed by the link's private key for an access
+	// token (RFC 7523 section 2.1), e.g. Salesforce's JWT bearer flow.
+	GrantTypeJWTBearer = "jwt-bearer"
+
+	// PrivateKeyCred is the name of the link credential which contains
+	// the PEM-encoded private key (RSA, ECDSA, or Ed25519) for signing
+	// JWT assertions. It's stored alongside cached access tokens,
+	// but never returned to callers.
+	PrivateKeyCred = "private_key"
+)
+
+const (
+	jwtBearerGrantType     = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	jwtBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// assertionLifetime is short, because assertions are used immediately.
+	assertionLifetime = 5 * time.Minute
+)
+
+// jwtParams sets the parameters of a token request which are related to JWT
+// assertions, based on the link's [GrantTypeParam] and [ClientAuthParam].
+// It reports whether the request should authenticate the client with the
+// client secret (i.e. without an assertion).
+func (c *Config) jwtParams(v url.Values, privateKey string) (bool, error) {
+	switch c.Params[GrantTypeParam] {
+	case "", "client_credentials":
+		// Default, already set by [clientcredentials.Config].
+	case GrantTypeJWTBearer, jwtBearerGrantType:
+		claims := c.assertionClaims(c.Params[SubjectParam], c.Params[AudienceParam])
+		if len(c.Config.Scopes) > 0 {
+			claims["scope"] = strings.Join(c.Config.Scopes, " ")
+		}
+		a, err := c.signAssertion(claims, privateKey)
+		if err != nil {
+			return false, err
+		}
+		v.Set("grant_type", jwtBearerGrantType)
+		v.Set("assertion", a)
+		v.Del(AudienceParam) // Already in the assertion.
+	default:
+		return false, fmt.Errorf("unsupported OAuth grant type: %q", c.Params[GrantTypeParam])
+	}
+
+	switch c.Params[ClientAuthParam] {
+	case "", "client_secret":
+		return true, nil
+	case ClientAuthPrivateKeyJWT:
+		a, err := c.signAssertion(c.assertionClaims("", ""), privateKey)
+		if err != nil {
+			return false, err
+		}
+		v.Set("client_assertion_type", jwtBearerAssertionType)
+		v.Set("client_assertion", a)
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported OAuth client authentication method: %q", c.Params[ClientAuthParam])
+	}
+}
+
+// assertionClaims returns the standard claims of a new JWT assertion (RFC 7523
+// section 3). The issuer is the client ID, and by default the subject is the
+// client ID too, and the audience is the token endpoint URL.
+func (c *Config) assertionClaims(sub, aud string) jwt.MapClaims {
+	if sub == "" {
+		sub = c.Config.ClientID
+	}
+	if aud == "" {
+		aud = c.Config.Endpoint.TokenURL
+	}
+
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": c.Config.ClientID,
+		"sub": sub,
+		"aud": aud,
+		"iat": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+		"jti": shortuuid.New(),
+	}
+}
+
+// signAssertion signs the given claims with the given PEM-encoded private key.
+func (c *Config) signAssertion(claims jwt.MapClaims, privateKey string) (string, error) {
+	method, key, err := signingKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	t := jwt.NewWithClaims(method, claims)
+	if kid := c.Params[KeyIDParam]; kid != "" {
+		t.Header["kid"] = kid
+	}
+
+	s, err := t.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT assertion: %w", err)
+	}
+	return s, nil
+}
+
+// signingKey parses the given PEM-encoded private key,
+// and returns it along with the matching JWT signing method.
+func signingKey(privateKey string) (jwt.SigningMethod, any, error) {
+	if privateKey == "" {
+		return nil, nil, errors.New("missing credential: " + PrivateKeyCred)
+	}
+
+	pem := []byte(strings.ReplaceAll(privateKey, "\\n", "\n"))
+	if k, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		return jwt.SigningMethodRS256, k, nil
+	}
+	if k, err := jwt.ParseECPrivateKeyFromPEM(pem); err == nil {
+		return ecdsaSigningMethod(k), k, nil
+	}
+	if k, err := jwt.ParseEdPrivateKeyFromPEM(pem); err == nil {
+		return jwt.SigningMethodEdDSA, k, nil
+	}
+
+	return nil, nil, errors.New("failed to parse private key: expecting PEM-encoded RSA, ECDSA, or Ed25519")
+}
+
+func ecdsaSigningMethod(k *ecdsa.PrivateKey) jwt.SigningMethod {
+	switch k.Curve.Params().BitSize {
+	case 384:
+		return jwt.SigningMethodES384
+	case 521:
+		return jwt.SigningMethodES512
+	default:
+		return jwt.SigningMethodES256
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/lithammer/shortuuid/v4"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
@@ -17,6 +19,21 @@ import (
 
 const (
 	timeout = 3 * time.Second
+
+	// ReturnToParam is a link parameter which isn't injected into URLs, but
+	// stored with the link: a space-separated allowlist of URLs, to which
+	// users may return after completing OAuth flows (in addition to the
+	// server-wide allowlist). Each entry allows the same scheme and host,
+	// and all the paths under its own path.
+	ReturnToParam = "return_to"
+
+	// AudienceParam and ResourceParam are link parameters which aren't injected
+	// into URLs, but stored with the link, and sent to the token endpoint in
+	// client credentials grants (see [Config.ClientCredentialsToken]) to identify
+	// the target API. "audience" is used by Auth0 and Okta, and "resource" by
+	// Microsoft Entra ID (v1 endpoints) and RFC 8707.
+	AudienceParam = "audience"
+	ResourceParam = "resource"
 )
 
 // Config contains the complete OAuth 2.0 configutation of a link:
@@ -72,7 +89,7 @@ func FromProto(c *thrippypb.OAuthConfig) *Config {
 //
 // [OAuthConfig]: https://github.com/tzrikka/thrippy/blob/main/proto/thrippy/v1/oauth.proto
 func ToString(c *thrippypb.OAuthConfig) string {
-	if c.GetAuthUrl() == "" {
+	if c.GetAuthUrl() == "" && c.GetTokenUrl() == "" {
 		return ""
 	}
 
@@ -135,12 +152,38 @@ func (c *Config) ToProto() *thrippypb.OAuthConfig {
 		Scopes:    c.Config.Scopes,
 		AuthCodes: c.AuthCodes,
 
-		// Params were already injected into the URLs, so no need to store them as a map.
+		// Params were already injected into the URLs, so no need to store
+		// them as a map, except those which aren't part of any URL.
+		Params: storedParams(c.Params),
 
 		Nonce: new(c.Nonce),
 	}.Build()
 }
 
+// storedParamKeys are link parameters which should be stored
+// with the link (see [ReturnToParam], [AudienceParam], etc.).
+var storedParamKeys = []string{
+	ReturnToParam, AudienceParam, ResourceParam,
+	ClientAuthParam, GrantTypeParam, SubjectParam, KeyIDParam,
+}
+
+// storedParams returns the subset of the given link parameters
+// which should be stored with the link, or nil if there are none.
+func storedParams(params map[string]string) map[string]string {
+	var m map[string]string
+	for _, k := range storedParamKeys {
+		v, ok := params[k]
+		if !ok {
+			continue
+		}
+		if m == nil {
+			m = map[string]string{}
+		}
+		m[k] = v
+	}
+	return m
+}
+
 // ToJSON converts this struct into a JSON representation of an [OAuthConfig]
 // protocol-buffer message, for storage in the secrets manager.
 // This function returns "{}" if the receiver is nil.
@@ -209,12 +252,65 @@ func (c *Config) RefreshToken(ctx context.Context, t *oauth2.Token, force bool)
 		return nil, err
 	}
 
+	return TokenToMap(t), nil
+}
+
+// ClientCredentialsToken fetches a new access token with the client credentials
+// grant (RFC 6749 section 4.4), for machine-to-machine links which act on their
+// own behalf, without any user interaction. It returns the token as a map,
+// for storage in the secrets manager and transmission to the user.
+//
+// Alternatively, based on the link's parameters, it may use the JWT bearer
+// grant instead (see [GrantTypeParam]), and/or authenticate the client with
+// a JWT assertion instead of the client secret (see [ClientAuthParam]).
+// Both use the given PEM-encoded private key (see [PrivateKeyCred]).
+func (c *Config) ClientCredentialsToken(ctx context.Context, privateKey string) (map[string]any, error) {
+	cc := &clientcredentials.Config{
+		ClientID:       c.Config.ClientID,
+		ClientSecret:   c.Config.ClientSecret,
+		TokenURL:       c.Config.Endpoint.TokenURL,
+		Scopes:         c.Config.Scopes,
+		EndpointParams: url.Values{},
+		AuthStyle:      c.Config.Endpoint.AuthStyle,
+	}
+	for _, k := range []string{AudienceParam, ResourceParam} {
+		if v := c.Params[k]; v != "" {
+			cc.EndpointParams.Set(k, v)
+		}
+	}
+
+	useSecret, err := c.jwtParams(cc.EndpointParams, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if !useSecret || cc.ClientSecret == "" {
+		cc.ClientSecret = ""
+		cc.AuthStyle = oauth2.AuthStyleInParams // Client ID only, without HTTP basic authentication.
+	}
+
+	client := &http.Client{Timeout: timeout}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	t, err := cc.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return TokenToMap(t), nil
+}
+
+// TokenToMap converts the given [oauth2.Token] into a map,
+// for storage in the secrets manager and transmission to the user.
+func TokenToMap(t *oauth2.Token) map[string]any {
+	if t.Expiry.IsZero() && t.ExpiresIn > 0 { // If both are 0, the access token never expires.
+		t.Expiry = time.Now().Add(time.Second * time.Duration(t.ExpiresIn))
+	}
+
 	return map[string]any{
 		"access_token":  t.AccessToken,
 		"expiry":        t.Expiry.UTC().Format(time.RFC3339),
 		"refresh_token": t.RefreshToken,
 		"token_type":    t.TokenType,
-	}, nil
+	}
 }
 
 // TokenToProto converts the given [oauth2.Token] into an [OAuthConfig]
@@ -1,6 +1,9 @@
 package oauth
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
@@ -232,6 +235,38 @@ func TestConfigToProto(t *testing.T) {
 				Nonce:        new(""),
 			}.Build(),
 		},
+		{
+			name: "params",
+			cfg: &Config{
+				Config: &oauth2.Config{},
+				Params: map[string]string{"base_url": "https://example.com", ReturnToParam: "https://app.example.com"},
+			},
+			want: thrippypb.OAuthConfig_builder{
+				AuthUrl:      new(""),
+				TokenUrl:     new(""),
+				AuthStyle:    proto.Int64(0),
+				ClientId:     new(""),
+				ClientSecret: new(""),
+				Params:       map[string]string{ReturnToParam: "https://app.example.com"},
+				Nonce:        new(""),
+			}.Build(),
+		},
+		{
+			name: "client_credentials_params",
+			cfg: &Config{
+				Config: &oauth2.Config{},
+				Params: map[string]string{AudienceParam: "https://api.example.com", ResourceParam: "https://graph.example.com"},
+			},
+			want: thrippypb.OAuthConfig_builder{
+				AuthUrl:      new(""),
+				TokenUrl:     new(""),
+				AuthStyle:    proto.Int64(0),
+				ClientId:     new(""),
+				ClientSecret: new(""),
+				Params:       map[string]string{AudienceParam: "https://api.example.com", ResourceParam: "https://graph.example.com"},
+				Nonce:        new(""),
+			}.Build(),
+		},
 		{
 			name: "nonce",
 			cfg: &Config{
@@ -324,6 +359,86 @@ func TestConfigAuthCodes(t *testing.T) {
 	}
 }
 
+func TestConfigClientCredentialsToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[string]string
+		wantParams url.Values
+		status     int
+		wantErr    bool
+	}{
+		{
+			name:       "no_params",
+			wantParams: url.Values{"grant_type": {"client_credentials"}, "scope": {"aaa bbb"}},
+		},
+		{
+			name:   "audience_and_resource",
+			params: map[string]string{AudienceParam: "https://api.example.com", ResourceParam: "https://graph.example.com", "foo": "bar"},
+			wantParams: url.Values{
+				"grant_type": {"client_credentials"},
+				"scope":      {"aaa bbb"},
+				"audience":   {"https://api.example.com"},
+				"resource":   {"https://graph.example.com"},
+			},
+		},
+		{
+			name:    "error",
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					http.Error(w, `{"error":"invalid_client"}`, tt.status)
+					return
+				}
+
+				if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+					t.Errorf("client authentication = %q, %q, %v", id, secret, ok)
+				}
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("failed to parse form: %v", err)
+				}
+				if !reflect.DeepEqual(r.PostForm, tt.wantParams) {
+					t.Errorf("token request params = %v, want %v", r.PostForm, tt.wantParams)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+			}))
+			defer s.Close()
+
+			c := &Config{
+				Config: &oauth2.Config{
+					ClientID:     "id",
+					ClientSecret: "secret",
+					Endpoint:     oauth2.Endpoint{TokenURL: s.URL, AuthStyle: oauth2.AuthStyleInHeader},
+					Scopes:       []string{"aaa", "bbb"},
+				},
+				Params: tt.params,
+			}
+
+			got, err := c.ClientCredentialsToken(t.Context(), "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config.ClientCredentialsToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got["access_token"] != "token" || got["token_type"] != "Bearer" {
+				t.Errorf("Config.ClientCredentialsToken() = %v", got)
+			}
+			if tok, ok := TokenFromMap(got); !ok || !tok.Valid() {
+				t.Errorf("Config.ClientCredentialsToken() expiry = %v", got["expiry"])
+			}
+		})
+	}
+}
+
 func TestTokenToProto(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStartURLTTL is the validity period of start URLs which
+	// are generated by Thrippy's CLI (see [StartURL]).
+	DefaultStartURLTTL = 10 * time.Minute
+
+	// MaxStartURLTTL limits the validity period of start URLs:
+	// Thrippy's HTTP server rejects URLs which expire later than that.
+	MaxStartURLTTL = 24 * time.Hour
+)
+
+var (
+	// ErrStartURLInvalid is returned by [StartParams.Verify] when
+	// the signature or the expiry time of a start URL is invalid.
+	ErrStartURLInvalid = errors.New("invalid OAuth start URL signature")
+	// ErrStartURLExpired is returned by [StartParams.Verify] when a start URL is expired.
+	ErrStartURLExpired = errors.New("expired OAuth start URL")
+)
+
+// StartParams are the query parameters of a start URL which are covered by its signature.
+type StartParams struct {
+	LinkID    string
+	Namespace string // Optional.
+
+	// Optional: OAuth scopes to add to the link's configuration, when the
+	// flow is completed successfully (see "thrippy add-scopes"). User
+	// scopes are supported only by some link templates (e.g. Slack).
+	Scopes     []string
+	UserScopes []string
+
+	Expires time.Time
+}
+
+// StartURL returns a URL which starts a 3-legged OAuth 2.0 flow of a link, in
+// Thrippy's HTTP server. The URL is valid until the given expiry time (which
+// must not be later than [MaxStartURLTTL] from now), and it's signed with the
+// link's nonce, so it doesn't expose the nonce itself.
+func StartURL(baseURL, nonce string, p StartParams) (string, error) {
+	u, err := url.JoinPath(baseURL, "start")
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("id", p.LinkID)
+	if p.Namespace != "" {
+		q.Set("namespace", p.Namespace)
+	}
+	if len(p.Scopes) > 0 {
+		q.Set("scopes", strings.Join(p.Scopes, ","))
+	}
+	if len(p.UserScopes) > 0 {
+		q.Set("user_scopes", strings.Join(p.UserScopes, ","))
+	}
+	q.Set("expires", strconv.FormatInt(p.Expires.Unix(), 10))
+	q.Set("sig", base64.RawURLEncoding.EncodeToString(p.mac(nonce)))
+
+	return u + "?" + q.Encode(), nil
+}
+
+// ParseStartParams is the inverse of [StartURL]. It returns
+// the signed parameters of a start URL, and its signature.
+func ParseStartParams(q url.Values) (StartParams, string, error) {
+	exp, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return StartParams{}, "", ErrStartURLInvalid
+	}
+
+	p := StartParams{
+		LinkID:     q.Get("id"),
+		Namespace:  q.Get("namespace"),
+		Scopes:     splitScopes(q.Get("scopes")),
+		UserScopes: splitScopes(q.Get("user_scopes")),
+		Expires:    time.Unix(exp, 0),
+	}
+	return p, q.Get("sig"), nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// Verify checks the expiry time and signature of a start URL, which was
+// generated by [StartURL] and parsed by [ParseStartParams], at the given time.
+func (p StartParams) Verify(nonce, sig string, now time.Time) error {
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(b, p.mac(nonce)) {
+		return ErrStartURLInvalid
+	}
+
+	if now.After(p.Expires) {
+		return ErrStartURLExpired
+	}
+	if p.Expires.Sub(now) > MaxStartURLTTL {
+		return ErrStartURLInvalid
+	}
+	return nil
+}
+
+// mac is an HMAC-SHA256 of the parameters, keyed with the link's nonce.
+func (p StartParams) mac(nonce string) []byte {
+	h := hmac.New(sha256.New, []byte(nonce))
+	h.Write([]byte(strings.Join([]string{
+		p.LinkID, p.Namespace, strconv.FormatInt(p.Expires.Unix(), 10),
+		strings.Join(p.Scopes, ","), strings.Join(p.UserScopes, ","),
+	}, "\n")))
+	return h.Sum(nil)
+}
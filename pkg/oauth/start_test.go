@@ -0,0 +1,109 @@
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStartURL(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expires time.Time
+		nonce   string            // Verification nonce, if different.
+		modify  map[string]string // Query parameters to modify before verification.
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			expires: now.Add(DefaultStartURLTTL),
+		},
+		{
+			name:    "expired",
+			expires: now.Add(-time.Second),
+			wantErr: ErrStartURLExpired,
+		},
+		{
+			name:    "too_far_in_the_future",
+			expires: now.Add(MaxStartURLTTL + time.Minute),
+			wantErr: ErrStartURLInvalid,
+		},
+		{
+			name:    "rotated_nonce",
+			expires: now.Add(DefaultStartURLTTL),
+			nonce:   "other-nonce",
+			wantErr: ErrStartURLInvalid,
+		},
+		{
+			name:    "different_namespace",
+			expires: now.Add(DefaultStartURLTTL),
+			modify:  map[string]string{"namespace": "team-b"},
+			wantErr: ErrStartURLInvalid,
+		},
+		{
+			name:    "different_scopes",
+			expires: now.Add(DefaultStartURLTTL),
+			modify:  map[string]string{"scopes": "a,b,c"},
+			wantErr: ErrStartURLInvalid,
+		},
+		{
+			name:    "extended_expiry",
+			expires: now.Add(DefaultStartURLTTL),
+			modify:  map[string]string{"expires": "9999999999"},
+			wantErr: ErrStartURLInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := StartParams{LinkID: "id", Namespace: "team-a", Scopes: []string{"a", "b"}, Expires: tt.expires}
+			got, err := StartURL("https://example.com/", "nonce", want)
+			if err != nil {
+				t.Fatalf("StartURL() error = %v", err)
+			}
+
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Path != "/start" {
+				t.Errorf("StartURL() path = %q, want %q", u.Path, "/start")
+			}
+			q := u.Query()
+			if q.Has("nonce") {
+				t.Errorf("StartURL() = %q, exposes the nonce", got)
+			}
+			for k, v := range tt.modify {
+				q.Set(k, v)
+			}
+
+			p, sig, err := ParseStartParams(q)
+			if err != nil {
+				t.Fatalf("ParseStartParams() error = %v", err)
+			}
+			if tt.modify == nil {
+				want.Expires = time.Unix(want.Expires.Unix(), 0)
+				if !reflect.DeepEqual(p, want) {
+					t.Errorf("ParseStartParams() = %+v, want %+v", p, want)
+				}
+			}
+
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if err := p.Verify(nonce, sig, now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("StartParams.Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseStartParamsInvalidExpiry(t *testing.T) {
+	if _, _, err := ParseStartParams(url.Values{"id": {"id"}, "expires": {"soon"}}); !errors.Is(err, ErrStartURLInvalid) {
+		t.Errorf("ParseStartParams() error = %v, want %v", err, ErrStartURLInvalid)
+	}
+}
@@ -1,8 +1,12 @@
 package secrets
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -17,9 +21,9 @@ const (
 	awsOption = "aws"
 )
 
-// AWSFlags defines global (but hidden) CLI flags. The purpose of these
-// CLI flags is to initialize the AWS SSM Parameter Store provider via
-// environment variables and/or the application's configuration file.
+// AWSFlags defines global (but hidden) CLI flags. The purpose of these CLI
+// flags is to initialize the AWS SSM Parameter Store and AWS Secrets Manager
+// providers via environment variables and/or the application's configuration file.
 func AWSFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 	return []cli.Flag{
 		&cli.StringFlag{
@@ -38,6 +42,29 @@ func AWSFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			),
 			Hidden: true,
 		},
+		&cli.StringFlag{
+			Name: "secrets-aws-tags",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_AWS_TAGS"),
+				toml.TOML("secrets.aws.tags", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.IntFlag{
+			Name:  "secrets-aws-recovery-window-days",
+			Value: awsDefaultRecoveryWindow,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_AWS_RECOVERY_WINDOW_DAYS"),
+				toml.TOML("secrets.aws.recovery_window_days", configFilePath),
+			),
+			Hidden: true,
+			Validator: func(v int) error {
+				if v != 0 && (v < 7 || v > 30) {
+					return errors.New("must be 0, or between 7 and 30")
+				}
+				return nil
+			},
+		},
 	}
 }
 
@@ -60,6 +87,7 @@ func newAWSProvider(ctx context.Context, cmd *cli.Command) (Manager, error) {
 
 // Set value size limit is 4 KiB, according to this link:
 // https://docs.aws.amazon.com/systems-manager/latest/userguide/parameter-store-advanced-parameters.html.
+// Larger values are split into multiple parameters by [chunkedProvider].
 func (p *awsProvider) Set(ctx context.Context, key, value string) error {
 	_, err := p.client.PutParameter(ctx, &ssm.PutParameterInput{
 		Name:      new("/" + key),
@@ -91,3 +119,69 @@ func (p *awsProvider) Delete(ctx context.Context, key string) error {
 	_, err := p.client.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: new("/" + key)})
 	return err
 }
+
+// List returns the names of all the parameters which start with the given prefix.
+func (p *awsProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	in := &ssm.DescribeParametersInput{
+		ParameterFilters: []types.ParameterStringFilter{
+			{Key: new("Name"), Option: new("BeginsWith"), Values: []string{"/" + prefix}},
+		},
+	}
+
+	var keys []string
+	pages := ssm.NewDescribeParametersPaginator(p.client, in)
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pm := range out.Parameters {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(pm.Name), "/"))
+		}
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// History returns the native version history of the parameter,
+// which AWS limits to the last 100 versions.
+func (p *awsProvider) History(ctx context.Context, key string) ([]Version, error) {
+	var h []Version
+	pages := ssm.NewGetParameterHistoryPaginator(p.client, &ssm.GetParameterHistoryInput{Name: new("/" + key)})
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			var pnf *types.ParameterNotFound
+			if errors.As(err, &pnf) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		for _, ph := range out.Parameters {
+			h = append(h, Version{Number: int(ph.Version), CreatedAt: aws.ToTime(ph.LastModifiedDate)})
+		}
+	}
+
+	slices.SortFunc(h, func(a, b Version) int { return cmp.Compare(a.Number, b.Number) })
+	return h, nil
+}
+
+func (p *awsProvider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	out, err := p.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           new("/" + key + ":" + strconv.Itoa(version)),
+		WithDecryption: new(true),
+	})
+	if err != nil {
+		var pnf *types.ParameterNotFound
+		var pvnf *types.ParameterVersionNotFound
+		if errors.As(err, &pnf) || errors.As(err, &pvnf) {
+			return "", ErrVersionNotFound
+		}
+		return "", err
+	}
+
+	return aws.ToString(out.Parameter.Value), nil
+}
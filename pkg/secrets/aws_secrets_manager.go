@@ -0,0 +1,205 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	awsSecretsManagerOption = "aws-secretsmanager"
+
+	awsDefaultRecoveryWindow = 30 // Days.
+)
+
+// awsSecretsManagerProvider stores each secret as an AWS Secrets Manager secret. New secrets
+// are encrypted with the configured KMS key (or the account's default "aws/secretsmanager"
+// key), and tagged with the configured resource tags. Deleted secrets can be restored
+// during the configured recovery window, unless it's zero.
+type awsSecretsManagerProvider struct {
+	client         *secretsmanager.Client
+	keyID          *string
+	tags           []types.Tag
+	recoveryWindow int
+}
+
+func newAWSSecretsManagerProvider(ctx context.Context, cmd *cli.Command) (Manager, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cmd.String("secrets-aws-region")))
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := parseAWSTags(cmd.String("secrets-aws-tags"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &awsSecretsManagerProvider{
+		client:         secretsmanager.NewFromConfig(cfg),
+		tags:           tags,
+		recoveryWindow: cmd.Int("secrets-aws-recovery-window-days"),
+	}
+	if id := cmd.String("secrets-aws-kms-key-id"); id != "" {
+		p.keyID = new(id)
+	}
+
+	return p, nil
+}
+
+// parseAWSTags parses comma-separated "key=value" pairs.
+func parseAWSTags(s string) ([]types.Tag, error) {
+	var tags []types.Tag
+	for pair := range strings.SplitSeq(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid AWS tag %q, expecting \"key=value\"", pair)
+		}
+		tags = append(tags, types.Tag{Key: new(strings.TrimSpace(k)), Value: new(strings.TrimSpace(v))})
+	}
+	return tags, nil
+}
+
+func (p *awsSecretsManagerProvider) Set(ctx context.Context, key, value string) error {
+	err := p.put(ctx, key, value)
+	if err == nil {
+		return nil
+	}
+
+	var rnf *types.ResourceNotFoundException
+	var ir *types.InvalidRequestException
+	switch {
+	case errors.As(err, &rnf):
+		_, err = p.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         new(key),
+			SecretString: new(value),
+			KmsKeyId:     p.keyID,
+			Tags:         p.tags,
+			Description:  new("Managed by Thrippy"),
+		})
+		var ree *types.ResourceExistsException
+		if errors.As(err, &ree) {
+			return p.put(ctx, key, value) // Created concurrently by another process.
+		}
+		return err
+
+	case errors.As(err, &ir):
+		// Secrets which are scheduled for deletion (i.e. in their recovery
+		// window) must be restored before they can be updated.
+		if deleted, derr := p.isDeleted(ctx, key); derr != nil || !deleted {
+			return err
+		}
+		if _, err := p.client.RestoreSecret(ctx, &secretsmanager.RestoreSecretInput{SecretId: new(key)}); err != nil {
+			return err
+		}
+		return p.put(ctx, key, value)
+
+	default:
+		return err
+	}
+}
+
+func (p *awsSecretsManagerProvider) put(ctx context.Context, key, value string) error {
+	_, err := p.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     new(key),
+		SecretString: new(value),
+	})
+	return err
+}
+
+func (p *awsSecretsManagerProvider) Get(ctx context.Context, key string) (string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: new(key)})
+	if err != nil {
+		var rnf *types.ResourceNotFoundException
+		if errors.As(err, &rnf) {
+			return "", nil
+		}
+
+		var ir *types.InvalidRequestException
+		if errors.As(err, &ir) {
+			if deleted, derr := p.isDeleted(ctx, key); derr == nil && deleted {
+				return "", nil
+			}
+		}
+		return "", err
+	}
+
+	return aws.ToString(out.SecretString), nil
+}
+
+func (p *awsSecretsManagerProvider) Delete(ctx context.Context, key string) error {
+	in := &secretsmanager.DeleteSecretInput{SecretId: new(key)}
+	if p.recoveryWindow > 0 {
+		in.RecoveryWindowInDays = new(int64(p.recoveryWindow))
+	} else {
+		in.ForceDeleteWithoutRecovery = new(true)
+	}
+
+	_, err := p.client.DeleteSecret(ctx, in)
+	if err == nil {
+		return nil
+	}
+
+	var rnf *types.ResourceNotFoundException
+	if errors.As(err, &rnf) {
+		return nil
+	}
+
+	// Already scheduled for deletion.
+	var ir *types.InvalidRequestException
+	if errors.As(err, &ir) {
+		if deleted, derr := p.isDeleted(ctx, key); derr == nil && deleted {
+			return nil
+		}
+	}
+	return err
+}
+
+// List returns the names of all the secrets which start with the given
+// prefix, excluding secrets which are scheduled for deletion.
+func (p *awsSecretsManagerProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	in := &secretsmanager.ListSecretsInput{}
+	if prefix != "" {
+		in.Filters = []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{prefix}}}
+	}
+
+	var keys []string
+	pages := secretsmanager.NewListSecretsPaginator(p.client, in)
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// The name filter is a prefix match, but it's not case-sensitive.
+		for _, s := range out.SecretList {
+			if k := aws.ToString(s.Name); strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// isDeleted checks whether the given secret is scheduled for deletion.
+func (p *awsSecretsManagerProvider) isDeleted(ctx context.Context, key string) (bool, error) {
+	out, err := p.client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: new(key)})
+	if err != nil {
+		return false, err
+	}
+	return out.DeletedDate != nil, nil
+}
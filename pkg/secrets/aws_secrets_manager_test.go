@@ -0,0 +1,308 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+type fakeAWSSecret struct {
+	value          string
+	kmsKeyID       string
+	tags           map[string]string
+	deleted        bool
+	recoveryWindow int
+}
+
+// fakeAWSSecretsManager is a minimal stand-in for the AWS Secrets Manager
+// API (JSON 1.1 protocol), which supports only the operations that
+// [awsSecretsManagerProvider] uses, and pages of 2 listed secrets.
+type fakeAWSSecretsManager struct {
+	mu      sync.Mutex
+	secrets map[string]*fakeAWSSecret
+}
+
+func (f *fakeAWSSecretsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var in struct {
+		Name                       string
+		SecretID                   string `json:"SecretId"`
+		SecretString               string
+		KmsKeyID                   string `json:"KmsKeyId"`
+		Tags                       []struct{ Key, Value string }
+		RecoveryWindowInDays       int
+		ForceDeleteWithoutRecovery bool
+		Filters                    []struct {
+			Key    string
+			Values []string
+		}
+		NextToken string
+	}
+	_ = json.NewDecoder(r.Body).Decode(&in)
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+	s := f.secrets[in.SecretID]
+
+	if op != "CreateSecret" && op != "ListSecrets" && s == nil {
+		writeAWSError(w, "ResourceNotFoundException")
+		return
+	}
+	if s != nil && s.deleted && op != "DescribeSecret" && op != "RestoreSecret" {
+		writeAWSError(w, "InvalidRequestException")
+		return
+	}
+
+	resp := map[string]any{}
+	switch op {
+	case "CreateSecret":
+		if f.secrets[in.Name] != nil {
+			writeAWSError(w, "ResourceExistsException")
+			return
+		}
+		tags := map[string]string{}
+		for _, t := range in.Tags {
+			tags[t.Key] = t.Value
+		}
+		f.secrets[in.Name] = &fakeAWSSecret{value: in.SecretString, kmsKeyID: in.KmsKeyID, tags: tags}
+		resp["Name"] = in.Name
+	case "PutSecretValue":
+		s.value = in.SecretString
+	case "GetSecretValue":
+		resp["Name"] = in.SecretID
+		resp["SecretString"] = s.value
+	case "DeleteSecret":
+		if in.ForceDeleteWithoutRecovery {
+			delete(f.secrets, in.SecretID)
+		} else {
+			s.deleted = true
+			s.recoveryWindow = in.RecoveryWindowInDays
+		}
+	case "RestoreSecret":
+		s.deleted = false
+	case "DescribeSecret":
+		resp["Name"] = in.SecretID
+		if s.deleted {
+			resp["DeletedDate"] = 1700000000
+		}
+	case "ListSecrets":
+		var names []string
+		for name, s := range f.secrets {
+			if !s.deleted && (len(in.Filters) == 0 || strings.HasPrefix(strings.ToLower(name), strings.ToLower(in.Filters[0].Values[0]))) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+
+		i := slices.IndexFunc(names, func(n string) bool { return n > in.NextToken })
+		if i < 0 {
+			i = len(names)
+		}
+		names = names[i:]
+		if len(names) > 2 {
+			names = names[:2]
+			resp["NextToken"] = names[1]
+		}
+
+		var list []map[string]string
+		for _, n := range names {
+			list = append(list, map[string]string{"Name": n})
+		}
+		resp["SecretList"] = list
+	default:
+		writeAWSError(w, "InvalidAction")
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeAWSError(w http.ResponseWriter, errType string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": errType, "message": errType})
+}
+
+func newTestAWSSecretsManagerProvider(t *testing.T, recoveryWindow int) (*awsSecretsManagerProvider, *fakeAWSSecretsManager) {
+	t.Helper()
+
+	f := &fakeAWSSecretsManager{secrets: map[string]*fakeAWSSecret{}}
+	s := httptest.NewServer(f)
+	t.Cleanup(s.Close)
+
+	client := secretsmanager.New(secretsmanager.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: new(s.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	tags := []types.Tag{{Key: new("team"), Value: new("platform")}}
+	return &awsSecretsManagerProvider{client: client, keyID: new("alias/thrippy"), tags: tags, recoveryWindow: recoveryWindow}, f
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	p, f := newTestAWSSecretsManagerProvider(t, 7)
+	m := &genericWrapper{provider: p, namespace: "test"}
+
+	v, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get(missing key) error = %v", err)
+	}
+	if v != "" {
+		t.Errorf("Get(missing key) = %q, want %q", v, "")
+	}
+
+	// Create and then update.
+	for _, v := range []string{"val1", "val2"} {
+		if err := m.Set(t.Context(), "id/creds", v); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	s := f.secrets["thrippy/test/id/creds"]
+	if s == nil {
+		t.Fatal("Set() did not create a secret")
+	}
+	if s.kmsKeyID != "alias/thrippy" {
+		t.Errorf("KMS key ID = %q, want %q", s.kmsKeyID, "alias/thrippy")
+	}
+	if want := map[string]string{"team": "platform"}; !reflect.DeepEqual(s.tags, want) {
+		t.Errorf("tags = %v, want %v", s.tags, want)
+	}
+
+	v, err = m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if v != "val2" {
+		t.Errorf("Get() = %q, want %q", v, "val2")
+	}
+
+	// Listing with multiple pages.
+	for _, k := range []string{"id/meta", "id/oauth", "id/template", "other/creds"} {
+		if err := m.Set(t.Context(), k, "val"); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	keys, err := m.List(t.Context(), "id/")
+	if err != nil {
+		t.Errorf("List() error = %v", err)
+	}
+	if want := []string{"id/creds", "id/meta", "id/oauth", "id/template"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	// Deletion with a recovery window.
+	if err := m.Delete(t.Context(), "id/creds"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if !s.deleted || s.recoveryWindow != 7 {
+		t.Errorf("Delete() = deleted %v, recovery window %d, want true and 7", s.deleted, s.recoveryWindow)
+	}
+	if err := m.Delete(t.Context(), "id/creds"); err != nil {
+		t.Errorf("Delete(deleted key) error = %v", err)
+	}
+	if err := m.Delete(t.Context(), "missing"); err != nil {
+		t.Errorf("Delete(missing key) error = %v", err)
+	}
+
+	v, err = m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get(deleted key) error = %v", err)
+	}
+	if v != "" {
+		t.Errorf("Get(deleted key) = %q, want %q", v, "")
+	}
+	keys, err = m.List(t.Context(), "id/c")
+	if err != nil {
+		t.Errorf("List() error = %v", err)
+	}
+	if len(keys) > 0 {
+		t.Errorf("List() = %v, want empty", keys)
+	}
+
+	// Setting a deleted key restores it.
+	if err := m.Set(t.Context(), "id/creds", "val3"); err != nil {
+		t.Errorf("Set(deleted key) error = %v", err)
+	}
+	v, err = m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if v != "val3" {
+		t.Errorf("Get() = %q, want %q", v, "val3")
+	}
+}
+
+func TestAWSSecretsManagerProviderForceDelete(t *testing.T) {
+	p, f := newTestAWSSecretsManagerProvider(t, 0)
+	if err := p.Set(t.Context(), "key", "val"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := p.Delete(t.Context(), "key"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if len(f.secrets) > 0 {
+		t.Errorf("Delete() left data: %v", f.secrets)
+	}
+}
+
+func TestParseAWSTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]string{},
+		},
+		{
+			name: "multiple",
+			s:    " team=platform, env = prod ,empty=,",
+			want: map[string]string{"team": "platform", "env": "prod", "empty": ""},
+		},
+		{
+			name:    "missing_value",
+			s:       "team",
+			wantErr: true,
+		},
+		{
+			name:    "missing_key",
+			s:       "=val",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := parseAWSTags(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAWSTags() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := map[string]string{}
+			for _, tag := range tags {
+				got[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAWSTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package secrets
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"sync"
+	"time"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	defaultCacheMaxEntries = 1000
+	cacheStatsInterval     = 10 * time.Minute
+)
+
+// CacheFlags defines global (but hidden) CLI flags. The purpose of these
+// CLI flags is to enable an in-memory read-through cache in front of the
+// secrets provider, via environment variables and/or the application's
+// configuration file. The cache is disabled by default (zero TTL).
+func CacheFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name: "secrets-cache-ttl",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_CACHE_TTL"),
+				toml.TOML("secrets.cache.ttl", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.IntFlag{
+			Name:  "secrets-cache-max-entries",
+			Value: defaultCacheMaxEntries,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_CACHE_MAX_ENTRIES"),
+				toml.TOML("secrets.cache.max_entries", configFilePath),
+			),
+			Hidden: true,
+		},
+	}
+}
+
+// cacheStats reports the usage of the secrets cache (see [cachedProvider.reportStats]).
+type cacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// cachedProvider is a read-through cache with a TTL, invalidation after writes, and
+// a size bound (least-recently-used entries are evicted first). Missing keys are cached
+// too. Cached values are encrypted with an ephemeral key, which is generated when the
+// cache is created and never leaves the process, to avoid exposing plaintext secrets
+// in core dumps and swap. Writes by other processes are visible only after the TTL.
+type cachedProvider struct {
+	provider   Manager
+	ttl        time.Duration
+	maxEntries int
+	key        []byte
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Most recently used entries are at the front.
+	gen     uint64     // Incremented by every invalidation.
+	stats   cacheStats
+}
+
+type cacheEntry struct {
+	key       string
+	sealed    []byte
+	expiresAt time.Time
+}
+
+// withCacheFlags wraps the given provider with [cachedProvider], if the
+// "secrets-cache-ttl" flag is positive. It also starts reporting cache
+// statistics periodically in the log, until the context is canceled.
+func withCacheFlags(ctx context.Context, cmd *cli.Command, p Manager) (Manager, error) {
+	ttl := cmd.Duration("secrets-cache-ttl")
+	if ttl <= 0 {
+		return p, nil
+	}
+
+	c, err := newCachedProvider(p, ttl, cmd.Int("secrets-cache-max-entries"))
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("secrets cache enabled", slog.Duration("ttl", ttl), slog.Int("max_entries", c.maxEntries))
+	go c.reportStats(ctx, cacheStatsInterval)
+	return c, nil
+}
+
+func newCachedProvider(p Manager, ttl time.Duration, maxEntries int) (*cachedProvider, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
+	return &cachedProvider{
+		provider:   p,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		key:        key,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}, nil
+}
+
+// Set writes the given value to the provider, and then invalidates the key, instead
+// of caching the new value: concurrent writes may reach the provider in a different
+// order than their invalidations, so only a subsequent read knows the winning value.
+func (c *cachedProvider) Set(ctx context.Context, key, value string) error {
+	defer c.invalidate(key)
+	return c.provider.Set(ctx, key, value)
+}
+
+func (c *cachedProvider) Get(ctx context.Context, key string) (string, error) {
+	v, gen, ok := c.get(key)
+	if ok {
+		return v, nil
+	}
+
+	v, err := c.provider.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	c.put(key, v, gen)
+	return v, nil
+}
+
+// Delete invalidates the key after the provider deletes it, so a concurrent
+// read which completes in between can't leave the deleted value in the cache.
+func (c *cachedProvider) Delete(ctx context.Context, key string) error {
+	defer c.invalidate(key)
+	return c.provider.Delete(ctx, key)
+}
+
+func (c *cachedProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	l, ok := c.provider.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	return l.List(ctx, prefix)
+}
+
+func (c *cachedProvider) History(ctx context.Context, key string) ([]Version, error) {
+	v, ok := c.provider.(Versioner)
+	if !ok {
+		return nil, ErrVersionsNotSupported
+	}
+	return v.History(ctx, key)
+}
+
+func (c *cachedProvider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	v, ok := c.provider.(Versioner)
+	if !ok {
+		return "", ErrVersionsNotSupported
+	}
+	return v.GetVersion(ctx, key, version)
+}
+
+// Stats returns a snapshot of the cache's usage statistics.
+func (c *cachedProvider) Stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Entries = c.lru.Len()
+	return s
+}
+
+// get returns the cached value of the given key, if it exists and hasn't expired
+// yet. It also returns the current invalidation generation, for [cachedProvider.put].
+func (c *cachedProvider) get(key string) (string, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return "", c.gen, false
+	}
+
+	ce, _ := e.Value.(*cacheEntry)
+	if time.Now().After(ce.expiresAt) {
+		c.remove(e)
+		c.stats.Misses++
+		return "", c.gen, false
+	}
+
+	v, err := unseal(c.key, ce.sealed, []byte(key))
+	if err != nil {
+		c.remove(e)
+		c.stats.Misses++
+		return "", c.gen, false
+	}
+
+	c.lru.MoveToFront(e)
+	c.stats.Hits++
+	return string(v), c.gen, true
+}
+
+// put adds or replaces the given value in the cache, and evicts the least
+// recently used entry if necessary. It does nothing if there were any
+// invalidations since the given generation, to avoid caching a stale
+// value that was read concurrently with a write.
+func (c *cachedProvider) put(key, value string, gen uint64) {
+	sealed, err := seal(c.key, []byte(value), []byte(key))
+	if err != nil {
+		return // Caching is best-effort.
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+
+	ce := &cacheEntry{key: key, sealed: sealed, expiresAt: time.Now().Add(c.ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = ce
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(ce)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate removes the given key from the cache, and increments the invalidation
+// generation, to prevent caching values which were read before the invalidation.
+func (c *cachedProvider) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.gen++
+}
+
+// remove deletes the given entry from the cache. The caller must hold the mutex.
+func (c *cachedProvider) remove(e *list.Element) {
+	ce, _ := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, ce.key)
+}
+
+// reportStats logs the cache's usage statistics periodically,
+// if there was any activity since the previous report.
+func (c *cachedProvider) reportStats(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var prev cacheStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s := c.Stats()
+			if s.Hits == prev.Hits && s.Misses == prev.Misses {
+				continue
+			}
+			prev = s
+
+			slog.Info("secrets cache stats", slog.Uint64("hits", s.Hits), slog.Uint64("misses", s.Misses),
+				slog.Uint64("evictions", s.Evictions), slog.Int("entries", s.Entries))
+		}
+	}
+}
+
+// getCacheStats returns the usage statistics of the given [Manager]'s
+// cache, or false if it was initialized without a cache.
+func getCacheStats(m Manager) (cacheStats, bool) {
+	w, ok := m.(*genericWrapper)
+	if !ok {
+		return cacheStats{}, false
+	}
+
+	c, ok := w.provider.(*cachedProvider)
+	if !ok {
+		return cacheStats{}, false
+	}
+	return c.Stats(), true
+}
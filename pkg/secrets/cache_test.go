@@ -0,0 +1,219 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCachedManager(t *testing.T, ttl time.Duration, maxEntries int) (Manager, *inMemoryProvider) {
+	t.Helper()
+
+	p := &inMemoryProvider{store: map[string]string{}}
+	c, err := newCachedProvider(p, ttl, maxEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &genericWrapper{provider: c, namespace: "test"}, p
+}
+
+func TestCachedProvider(t *testing.T) {
+	m, p := newTestCachedManager(t, time.Hour, 10)
+
+	// Missing keys are cached too.
+	for range 2 {
+		if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "" {
+			t.Errorf("Get(missing key) = %q, %v", v, err)
+		}
+	}
+
+	// Writes invalidate the cache.
+	if err := m.Set(t.Context(), "id/creds", "val1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "val1" {
+		t.Errorf("Get() = %q, %v, want %q", v, err, "val1")
+	}
+
+	// Reads are served from the cache, even if the provider changed.
+	p.store["thrippy/test/id/creds"] = "changed"
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "val1" {
+		t.Errorf("Get() = %q, %v, want cached %q", v, err, "val1")
+	}
+
+	// Deletions invalidate the cache.
+	if err := m.Delete(t.Context(), "id/creds"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "" {
+		t.Errorf("Get(deleted key) = %q, %v", v, err)
+	}
+
+	s, ok := getCacheStats(m)
+	if !ok {
+		t.Fatal("getCacheStats() = false")
+	}
+	if want := (cacheStats{Hits: 2, Misses: 3, Entries: 1}); s != want {
+		t.Errorf("getCacheStats() = %+v, want %+v", s, want)
+	}
+}
+
+func TestCachedProviderTTL(t *testing.T) {
+	m, p := newTestCachedManager(t, 10*time.Millisecond, 10)
+	if err := m.Set(t.Context(), "id/creds", "val1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	p.store["thrippy/test/id/creds"] = "val2"
+	time.Sleep(20 * time.Millisecond)
+
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "val2" {
+		t.Errorf("Get(expired key) = %q, %v, want %q", v, err, "val2")
+	}
+}
+
+func TestCachedProviderEviction(t *testing.T) {
+	m, _ := newTestCachedManager(t, time.Hour, 2)
+	for _, k := range []string{"a/1", "b/1", "a/1", "c/1"} {
+		if _, err := m.Get(t.Context(), k); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+
+	// "b/1" was the least recently used key.
+	if _, err := m.Get(t.Context(), "a/1"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, err := m.Get(t.Context(), "b/1"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	s, _ := getCacheStats(m)
+	if want := (cacheStats{Hits: 2, Misses: 4, Evictions: 2, Entries: 2}); s != want {
+		t.Errorf("getCacheStats() = %+v, want %+v", s, want)
+	}
+}
+
+func TestCachedProviderEncryption(t *testing.T) {
+	m, _ := newTestCachedManager(t, time.Hour, 10)
+	if err := m.Set(t.Context(), "id/creds", "super-secret-value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	c, _ := m.(*genericWrapper).provider.(*cachedProvider)
+	for _, e := range c.entries {
+		ce, _ := e.Value.(*cacheEntry)
+		if bytes.Contains(ce.sealed, []byte("super-secret-value")) {
+			t.Errorf("cached value is not encrypted: %q", ce.sealed)
+		}
+	}
+}
+
+func TestCachedProviderStaleRead(t *testing.T) {
+	m, _ := newTestCachedManager(t, time.Hour, 10)
+	c, _ := m.(*genericWrapper).provider.(*cachedProvider)
+
+	// Simulate a slow read of an old value, which overlaps with a write.
+	_, gen, _ := c.get("thrippy/test/id/creds")
+	if err := m.Set(t.Context(), "id/creds", "new"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	c.put("thrippy/test/id/creds", "old", gen)
+
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "new" {
+		t.Errorf("Get() = %q, %v, want %q", v, err, "new")
+	}
+}
+
+// slowProvider is an [inMemoryProvider] whose writes can be paused,
+// to simulate concurrent operations which complete in a specific order.
+type slowProvider struct {
+	*inMemoryProvider
+
+	// Called before each write, with its name and value (if any).
+	before func(op, value string)
+}
+
+func (p *slowProvider) Set(ctx context.Context, key, value string) error {
+	p.before("set", value)
+	return p.inMemoryProvider.Set(ctx, key, value)
+}
+
+func (p *slowProvider) Delete(ctx context.Context, key string) error {
+	p.before("delete", "")
+	return p.inMemoryProvider.Delete(ctx, key)
+}
+
+func newSlowCachedProvider(t *testing.T, before func(op, value string)) *cachedProvider {
+	t.Helper()
+
+	p := &slowProvider{inMemoryProvider: &inMemoryProvider{store: map[string]string{}}, before: before}
+	c, err := newCachedProvider(p, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCachedProviderConcurrentSets(t *testing.T) {
+	// Set("A") starts first, but its write reaches the provider last.
+	released := make(chan struct{})
+	c := newSlowCachedProvider(t, func(op, value string) {
+		if op == "set" && value == "A" {
+			<-released
+		}
+	})
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := c.Set(t.Context(), "key", "A"); err != nil {
+			t.Errorf("Set(A) error = %v", err)
+		}
+	})
+
+	if err := c.Set(t.Context(), "key", "B"); err != nil {
+		t.Fatalf("Set(B) error = %v", err)
+	}
+	close(released)
+	wg.Wait()
+
+	if v, err := c.Get(t.Context(), "key"); err != nil || v != "A" {
+		t.Errorf("Get() = %q, %v, want %q", v, err, "A")
+	}
+}
+
+func TestCachedProviderConcurrentGetAndDelete(t *testing.T) {
+	// Delete() pauses before the provider deletes the key,
+	// while a concurrent Get() reads and caches the old value.
+	deleting, released := make(chan struct{}), make(chan struct{})
+	c := newSlowCachedProvider(t, func(op, _ string) {
+		if op == "delete" {
+			close(deleting)
+			<-released
+		}
+	})
+
+	if err := c.Set(t.Context(), "key", "old"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := c.Delete(t.Context(), "key"); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+	})
+
+	<-deleting
+	if v, err := c.Get(t.Context(), "key"); err != nil || v != "old" {
+		t.Errorf("Get() during Delete() = %q, %v, want %q", v, err, "old")
+	}
+	close(released)
+	wg.Wait()
+
+	if v, err := c.Get(t.Context(), "key"); err != nil || v != "" {
+		t.Errorf("Get() after Delete() = %q, %v, want empty", v, err)
+	}
+}
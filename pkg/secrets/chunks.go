@@ -0,0 +1,349 @@
+package secrets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	manifestPrefix = "chunks:v1:"
+	chunkInfix     = ".chunk-"
+
+	awsMaxValueSize               = 4 << 10   // Standard SSM parameters.
+	awsSecretsManagerMaxValueSize = 64 << 10  // Secrets Manager quota.
+	vaultMaxValueSize             = 512 << 10 // Default entry size limit of Vault's integrated storage.
+)
+
+// ErrChunkIntegrity is returned when reading a value that was split into
+// chunks, but the chunks are missing or don't match the value's manifest.
+var ErrChunkIntegrity = errors.New("secret chunks are missing or corrupted")
+
+// maxValueSize returns the maximum size of a single value in bytes, for the
+// given secrets provider, unless it was overridden explicitly. Zero means
+// that the provider doesn't have a practical limit.
+func maxValueSize(provider string, override int) int {
+	if override > 0 {
+		return override
+	}
+
+	switch provider {
+	case awsOption:
+		return awsMaxValueSize
+	case awsSecretsManagerOption:
+		return awsSecretsManagerMaxValueSize
+	case vaultOption:
+		return vaultMaxValueSize
+	default:
+		return 0
+	}
+}
+
+// withChunking wraps the given provider with [chunkedProvider],
+// unless the provider doesn't have a maximum value size.
+func withChunking(p Manager, maxSize int) Manager {
+	if maxSize <= 0 {
+		return p
+	}
+
+	c := &chunkedProvider{provider: p, maxSize: maxSize}
+	if _, ok := p.(Versioner); ok {
+		return &versionedChunkedProvider{chunkedProvider: c}
+	}
+	return c
+}
+
+// chunkedProvider stores values which are larger than the underlying provider's
+// size limit in multiple keys: the value is compressed (if that helps) and
+// base64-encoded, the result is split into chunks which are stored in sibling
+// keys ("<key>.chunk-<N>"), and the original key stores a manifest with
+// SHA-256 digests of the entire value and each chunk, to detect corruptions
+// and partial writes. Chunk keys are hidden from listings.
+//
+// Note that compression is skipped for values with envelope encryption,
+// because encryption is applied before this decorator, and ciphertexts
+// don't compress well enough to be worth the effort.
+type chunkedProvider struct {
+	provider Manager
+	maxSize  int
+}
+
+// chunksManifest is stored instead of a value which was split into chunks.
+type chunksManifest struct {
+	Size   int      `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Gzip   bool     `json:"gzip,omitempty"`
+	Chunks []string `json:"chunks"` // Truncated SHA-256 digest of each chunk.
+}
+
+func (p *chunkedProvider) Set(ctx context.Context, key, value string) error {
+	// Small values don't check for stale chunks of a previous value, to avoid an extra
+	// read in every write: orphaned chunks are harmless (they're ignored and hidden),
+	// and they're deleted by the next write of a large value, or when deleting the key.
+	if len(value) <= p.maxSize && !strings.HasPrefix(value, manifestPrefix) {
+		return p.provider.Set(ctx, key, value)
+	}
+
+	payload, compressed, err := encodeChunks(value)
+	if err != nil {
+		return err
+	}
+
+	var chunks []string
+	for len(payload) > 0 {
+		n := min(len(payload), p.maxSize)
+		chunks = append(chunks, payload[:n])
+		payload = payload[n:]
+	}
+
+	h := sha256.Sum256([]byte(value))
+	m := chunksManifest{Size: len(value), SHA256: hex.EncodeToString(h[:]), Gzip: compressed}
+	for _, c := range chunks {
+		m.Chunks = append(m.Chunks, chunkDigest(c))
+	}
+
+	j, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	manifest := manifestPrefix + string(j)
+	if len(manifest) > p.maxSize {
+		return fmt.Errorf("secret value too large (%d bytes) even when split into %d chunks", len(value), len(chunks))
+	}
+
+	// Write all the chunks before the manifest which references them.
+	for i, c := range chunks {
+		if err := p.provider.Set(ctx, chunkKey(key, i), c); err != nil {
+			return fmt.Errorf("failed to write secret chunk %d of %d: %w", i+1, len(chunks), err)
+		}
+	}
+	if err := p.provider.Set(ctx, key, manifest); err != nil {
+		return err
+	}
+
+	return p.deleteStaleChunks(ctx, key, len(chunks))
+}
+
+func (p *chunkedProvider) Get(ctx context.Context, key string) (string, error) {
+	v, err := p.provider.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return p.join(ctx, key, v)
+}
+
+func (p *chunkedProvider) Delete(ctx context.Context, key string) error {
+	if err := p.provider.Delete(ctx, key); err != nil {
+		return err
+	}
+	return p.deleteChunks(ctx, key, 0)
+}
+
+func (p *chunkedProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	l, ok := p.provider.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+
+	keys, err := l.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := keys[:0]
+	for _, k := range keys {
+		if !isChunkKey(k) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered, nil
+}
+
+// join returns the given value as-is, unless it's a chunks
+// manifest, in which case it reads, verifies, and joins the chunks.
+func (p *chunkedProvider) join(ctx context.Context, key, value string) (string, error) {
+	j, ok := strings.CutPrefix(value, manifestPrefix)
+	if !ok {
+		return value, nil
+	}
+
+	var m chunksManifest
+	if err := json.Unmarshal([]byte(j), &m); err != nil {
+		return "", fmt.Errorf("%w: invalid manifest: %w", ErrChunkIntegrity, err)
+	}
+
+	var sb strings.Builder
+	for i, digest := range m.Chunks {
+		c, err := p.readChunk(ctx, chunkKey(key, i), digest)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(c)
+	}
+
+	v, err := decodeChunks(sb.String(), m.Gzip)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrChunkIntegrity, err)
+	}
+
+	h := sha256.Sum256([]byte(v))
+	if len(v) != m.Size || hex.EncodeToString(h[:]) != m.SHA256 {
+		return "", fmt.Errorf("%w: digest mismatch", ErrChunkIntegrity)
+	}
+	return v, nil
+}
+
+// readChunk returns the current value of the given chunk key. If it doesn't
+// match the expected digest, and the underlying provider retains previous
+// versions, it searches for a matching version, from newest to oldest.
+// This enables reading previous versions of values that were split into
+// chunks, because chunk keys are overwritten by newer versions.
+func (p *chunkedProvider) readChunk(ctx context.Context, key, digest string) (string, error) {
+	c, err := p.provider.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if chunkDigest(c) == digest {
+		return c, nil
+	}
+
+	v, ok := p.provider.(Versioner)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrChunkIntegrity, key)
+	}
+
+	h, err := v.History(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	for i := len(h) - 1; i >= 0; i-- {
+		c, err := v.GetVersion(ctx, key, h[i].Number)
+		if err != nil {
+			continue // Deleted version.
+		}
+		if chunkDigest(c) == digest {
+			return c, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrChunkIntegrity, key)
+}
+
+// deleteStaleChunks deletes leftover chunks from a previous, longer
+// chunked value, unless the underlying provider retains previous versions
+// (which may still reference these chunks - see [chunkedProvider.readChunk]).
+func (p *chunkedProvider) deleteStaleChunks(ctx context.Context, key string, from int) error {
+	if _, ok := p.provider.(Versioner); ok {
+		return nil
+	}
+	return p.deleteChunks(ctx, key, from)
+}
+
+// deleteChunks deletes the consecutive chunk keys of the given key, starting from the given index.
+func (p *chunkedProvider) deleteChunks(ctx context.Context, key string, from int) error {
+	for i := from; ; i++ {
+		k := chunkKey(key, i)
+		c, err := p.provider.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+		if c == "" {
+			return nil
+		}
+		if err := p.provider.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+}
+
+// versionedChunkedProvider passes through the native version history
+// of the underlying provider, and resolves chunks of previous versions.
+type versionedChunkedProvider struct {
+	*chunkedProvider
+}
+
+func (p *versionedChunkedProvider) History(ctx context.Context, key string) ([]Version, error) {
+	return p.provider.(Versioner).History(ctx, key)
+}
+
+func (p *versionedChunkedProvider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	v, err := p.provider.(Versioner).GetVersion(ctx, key, version)
+	if err != nil {
+		return "", err
+	}
+	return p.join(ctx, key, v)
+}
+
+func chunkKey(key string, i int) string {
+	return key + chunkInfix + strconv.Itoa(i)
+}
+
+func isChunkKey(key string) bool {
+	i := strings.LastIndex(key, chunkInfix)
+	if i < 0 {
+		return false
+	}
+	_, err := strconv.Atoi(key[i+len(chunkInfix):])
+	return err == nil
+}
+
+func chunkDigest(chunk string) string {
+	h := sha256.Sum256([]byte(chunk))
+	return hex.EncodeToString(h[:8])
+}
+
+// encodeChunks returns the given value as a base64 string, which can be split at any
+// byte boundary. The value is compressed first, if that makes the result shorter.
+func encodeChunks(value string) (string, bool, error) {
+	if strings.HasPrefix(value, envelopePrefix) {
+		return base64.RawStdEncoding.EncodeToString([]byte(value)), false, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := w.Write([]byte(value)); err != nil {
+		return "", false, err
+	}
+	if err := w.Close(); err != nil {
+		return "", false, err
+	}
+
+	if buf.Len() < len(value) {
+		return base64.RawStdEncoding.EncodeToString(buf.Bytes()), true, nil
+	}
+	return base64.RawStdEncoding.EncodeToString([]byte(value)), false, nil
+}
+
+func decodeChunks(payload string, compressed bool) (string, error) {
+	b, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	if !compressed {
+		return string(b), nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	b, err = io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,345 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMaxValueSize = 256
+
+// newTestChunkedManager returns a manager with the same decorators as
+// [NewManager], and an in-memory provider with an artificial size limit.
+func newTestChunkedManager() (Manager, *inMemoryProvider) {
+	p := &inMemoryProvider{store: map[string]string{}, maxValueSize: testMaxValueSize}
+	return &genericWrapper{provider: withVersions(withChunking(p, testMaxValueSize)), namespace: "test"}, p
+}
+
+// randomString returns a random (hex) string of the given length.
+func randomString(n int) string {
+	b := make([]byte, n/2)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func TestChunkedProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		chunked bool
+	}{
+		{
+			name:  "small_value",
+			value: "val",
+		},
+		{
+			name:  "max_size",
+			value: strings.Repeat("a", testMaxValueSize),
+		},
+		{
+			name:  "compressible_value",
+			value: strings.Repeat("abcdefgh", 100),
+		},
+		{
+			name:    "random_value",
+			value:   randomString(1000),
+			chunked: true,
+		},
+		{
+			name:    "manifest_prefix",
+			value:   manifestPrefix + "{}",
+			chunked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, p := newTestChunkedManager()
+			if err := m.Set(t.Context(), "id/creds", tt.value); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			got, err := m.Get(t.Context(), "id/creds")
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			if got != tt.value {
+				t.Errorf("Get() = %q, want %q", got, tt.value)
+			}
+
+			if tt.chunked {
+				if _, ok := p.store["thrippy/test/id/creds"+chunkInfix+"0"]; !ok {
+					t.Errorf("Set() did not split the value into chunks")
+				}
+			}
+			if _, ok := p.store["thrippy/test/id/creds"+chunkInfix+"7"]; ok {
+				t.Errorf("Set() split the value into too many chunks")
+			}
+
+			// Chunk keys are hidden.
+			keys, err := m.(Lister).List(t.Context(), "")
+			if err != nil {
+				t.Errorf("List() error = %v", err)
+			}
+			if want := []string{"id/creds"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("List() = %v, want %v", keys, want)
+			}
+
+			// Shorter values replace the manifest, and the orphaned chunks are ignored.
+			if err := m.Set(t.Context(), "id/creds", "val2"); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if got, err := m.Get(t.Context(), "id/creds"); err != nil || got != "val2" {
+				t.Errorf("Get() = %q, %v, want %q", got, err, "val2")
+			}
+
+			if err := m.Delete(t.Context(), "id/creds"); err != nil {
+				t.Errorf("Delete() error = %v", err)
+			}
+			if len(p.store) > 0 {
+				t.Errorf("Delete() left data: %v", p.store)
+			}
+		})
+	}
+}
+
+func TestChunkedProviderEncryptedValue(t *testing.T) {
+	m, p := newTestChunkedManager()
+	value := envelopePrefix + strings.Repeat("abcdefgh", 100)
+	if err := m.Set(t.Context(), "id/creds", value); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if manifest := p.store["thrippy/test/id/creds"]; strings.Contains(manifest, `"gzip"`) {
+		t.Errorf("Set() compressed an encrypted value: %s", manifest)
+	}
+	if got, err := m.Get(t.Context(), "id/creds"); err != nil || got != value {
+		t.Errorf("Get() = %q, %v, want %q", got, err, value)
+	}
+}
+
+// readCountingProvider counts the reads of the underlying provider.
+type readCountingProvider struct {
+	*inMemoryProvider
+	reads int
+}
+
+func (p *readCountingProvider) Get(ctx context.Context, key string) (string, error) {
+	p.reads++
+	return p.inMemoryProvider.Get(ctx, key)
+}
+
+func TestChunkedProviderSmallValueWrites(t *testing.T) {
+	p := &readCountingProvider{inMemoryProvider: &inMemoryProvider{store: map[string]string{}, maxValueSize: testMaxValueSize}}
+	c := withChunking(p, testMaxValueSize)
+	for range 3 {
+		if err := c.Set(t.Context(), "id/creds", "val"); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if p.reads > 0 {
+		t.Errorf("Set() of small values read the provider %d times, want 0", p.reads)
+	}
+}
+
+func TestChunkedProviderTooLarge(t *testing.T) {
+	m, _ := newTestChunkedManager()
+	if err := m.Set(t.Context(), "id/creds", randomString(10000)); err == nil {
+		t.Error("Set() error = nil, want error")
+	}
+}
+
+func TestChunkedProviderIntegrity(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(store map[string]string)
+	}{
+		{
+			name: "missing_chunk",
+			corrupt: func(store map[string]string) {
+				delete(store, "thrippy/test/id/creds"+chunkInfix+"1")
+			},
+		},
+		{
+			name: "modified_chunk",
+			corrupt: func(store map[string]string) {
+				k := "thrippy/test/id/creds" + chunkInfix + "1"
+				store[k] = strings.ToUpper(store[k])
+			},
+		},
+		{
+			name: "modified_manifest",
+			corrupt: func(store map[string]string) {
+				k := "thrippy/test/id/creds"
+				store[k] = strings.Replace(store[k], `"size":`, `"size":1`, 1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &inMemoryProvider{store: map[string]string{}, maxValueSize: testMaxValueSize}
+			m := &genericWrapper{provider: withChunking(p, testMaxValueSize), namespace: "test"}
+			if err := m.Set(t.Context(), "id/creds", randomString(1000)); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			tt.corrupt(p.store)
+
+			if _, err := m.Get(t.Context(), "id/creds"); !errors.Is(err, ErrChunkIntegrity) {
+				t.Errorf("Get() error = %v, want %v", err, ErrChunkIntegrity)
+			}
+		})
+	}
+}
+
+func TestChunkedProviderEmulatedVersions(t *testing.T) {
+	m, p := newTestChunkedManager()
+	v1, v2 := randomString(1000), randomString(500)
+	if err := m.Set(t.Context(), "id/creds", v1); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := m.Set(t.Context(), "id/creds", v2); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// The version history is also split into chunks.
+	for k, v := range p.store {
+		if len(v) > testMaxValueSize {
+			t.Errorf("stored value of %q is too large: %d bytes", k, len(v))
+		}
+	}
+
+	got, err := m.(Versioner).GetVersion(t.Context(), "id/creds", 1)
+	if err != nil {
+		t.Errorf("GetVersion() error = %v", err)
+	}
+	if got != v1 {
+		t.Errorf("GetVersion() = %q, want %q", got, v1)
+	}
+}
+
+// versionedTestProvider is a minimal provider with native versions.
+type versionedTestProvider struct {
+	store map[string][]string
+}
+
+func (p *versionedTestProvider) Set(_ context.Context, key, value string) error {
+	if len(value) > testMaxValueSize {
+		return errors.New("value too large")
+	}
+	p.store[key] = append(p.store[key], value)
+	return nil
+}
+
+func (p *versionedTestProvider) Get(_ context.Context, key string) (string, error) {
+	vs := p.store[key]
+	if len(vs) == 0 {
+		return "", nil
+	}
+	return vs[len(vs)-1], nil
+}
+
+func (p *versionedTestProvider) Delete(_ context.Context, key string) error {
+	delete(p.store, key)
+	return nil
+}
+
+func (p *versionedTestProvider) History(_ context.Context, key string) ([]Version, error) {
+	var h []Version
+	for i := range p.store[key] {
+		h = append(h, Version{Number: i + 1})
+	}
+	return h, nil
+}
+
+func (p *versionedTestProvider) GetVersion(_ context.Context, key string, version int) (string, error) {
+	vs := p.store[key]
+	if version < 1 || version > len(vs) {
+		return "", ErrVersionNotFound
+	}
+	return vs[version-1], nil
+}
+
+func TestChunkedProviderNativeVersions(t *testing.T) {
+	p := &versionedTestProvider{store: map[string][]string{}}
+	m := &genericWrapper{provider: withVersions(withChunking(p, testMaxValueSize)), namespace: "test"}
+
+	v1, v2, v3 := randomString(1000), randomString(300), "small"
+	for _, v := range []string{v1, v2, v3} {
+		if err := m.Set(t.Context(), "id/creds", v); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	// Chunks of previous versions are resolved from the chunk keys' history.
+	for i, want := range []string{v1, v2, v3} {
+		got, err := m.GetVersion(t.Context(), "id/creds", i+1)
+		if err != nil {
+			t.Errorf("GetVersion(%d) error = %v", i+1, err)
+		}
+		if got != want {
+			t.Errorf("GetVersion(%d) = %q, want %q", i+1, got, want)
+		}
+	}
+
+	if err := Rollback(t.Context(), m, "id/creds", 1); err != nil {
+		t.Errorf("Rollback() error = %v", err)
+	}
+	got, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if got != v1 {
+		t.Errorf("Get() after Rollback() = %q, want %q", got, v1)
+	}
+
+	if err := m.Delete(t.Context(), "id/creds"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if len(p.store) > 0 {
+		t.Errorf("Delete() left data: %v", p.store)
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		override int
+		want     int
+	}{
+		{
+			name:     "aws",
+			provider: awsOption,
+			want:     awsMaxValueSize,
+		},
+		{
+			name:     "vault",
+			provider: vaultOption,
+			want:     vaultMaxValueSize,
+		},
+		{
+			name:     "unlimited",
+			provider: sqlOption,
+		},
+		{
+			name:     "override",
+			provider: awsOption,
+			override: 8192,
+			want:     8192,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxValueSize(tt.provider, tt.override); got != tt.want {
+				t.Errorf("maxValueSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
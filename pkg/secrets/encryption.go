@@ -0,0 +1,414 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	// envelopePrefix marks values that were encrypted by [encryptedProvider].
+	// Values without it are considered plaintext, to support gradual migrations.
+	envelopePrefix = "enc:v1:"
+
+	keySize = 32 // AES-256.
+)
+
+// EncryptionFlags defines global (but hidden) CLI flags. The purpose
+// of these CLI flags is to enable client-side envelope encryption of
+// all secrets, regardless of the provider, via environment variables
+// and/or the application's configuration file.
+func EncryptionFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "secrets-kek",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_KEK"),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "secrets-kek-file",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_KEK_FILE"),
+				toml.TOML("secrets.encryption.kek_file", configFilePath),
+			),
+			Hidden:    true,
+			TakesFile: true,
+		},
+	}
+}
+
+// KeyWrapper encrypts and decrypts (i.e. wraps and unwraps) data encryption
+// keys (DEKs), using a key encryption key (KEK) that never leaves it. This
+// is the extension point for external key management services (KMS).
+type KeyWrapper interface {
+	// WrapKey encrypts the given DEK with the current KEK,
+	// and returns the result along with the ID of that KEK.
+	WrapKey(ctx context.Context, dek []byte) (wrapped []byte, kekID string, err error)
+	// UnwrapKey decrypts the given DEK with the KEK that has the given ID,
+	// which may be an older KEK than the current one (after rotations).
+	UnwrapKey(ctx context.Context, kekID string, wrapped []byte) ([]byte, error)
+}
+
+// encryptedProvider is a decorator that encrypts all the values which are
+// stored by another [Manager], using AES-256-GCM with a random data key per
+// value. Each data key is wrapped by a [KeyWrapper] and stored alongside the
+// value. The storage key is used as additional authenticated data, so
+// encrypted values cannot be swapped between different storage keys.
+type encryptedProvider struct {
+	provider Manager
+	kw       KeyWrapper
+}
+
+// WithEncryption returns a [Manager] that encrypts all the values that
+// it stores in the given one, using the given [KeyWrapper] to protect
+// the data encryption keys. Existing plaintext values remain readable.
+func WithEncryption(m Manager, kw KeyWrapper) Manager {
+	if w, ok := m.(*genericWrapper); ok {
+		return &genericWrapper{provider: &encryptedProvider{provider: w.provider, kw: kw}, namespace: w.namespace, keyTemplate: w.keyTemplate}
+	}
+	return &encryptedProvider{provider: m, kw: kw}
+}
+
+// withEncryptionFlags wraps the given provider with an [encryptedProvider],
+// if one or more KEKs are configured with [EncryptionFlags].
+func withEncryptionFlags(cmd *cli.Command, p Manager) (Manager, error) {
+	keys := cmd.String("secrets-kek")
+	if path := cmd.String("secrets-kek-file"); path != "" {
+		b, err := os.ReadFile(path) //gosec:disable G304 // Specified by admin by design.
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KEK file: %w", err)
+		}
+		keys = string(b)
+	}
+
+	if keys == "" {
+		return p, nil
+	}
+
+	kw, err := NewLocalKeyWrapper(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedProvider{provider: p, kw: kw}, nil
+}
+
+func (p *encryptedProvider) Set(ctx context.Context, key, value string) error {
+	enc, err := p.encrypt(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return p.provider.Set(ctx, key, enc)
+}
+
+func (p *encryptedProvider) Get(ctx context.Context, key string) (string, error) {
+	v, err := p.provider.Get(ctx, key)
+	if err != nil || v == "" {
+		return v, err
+	}
+	return p.decrypt(ctx, key, v)
+}
+
+func (p *encryptedProvider) Delete(ctx context.Context, key string) error {
+	return p.provider.Delete(ctx, key)
+}
+
+func (p *encryptedProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	l, ok := p.provider.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	return l.List(ctx, prefix)
+}
+
+func (p *encryptedProvider) History(ctx context.Context, key string) ([]Version, error) {
+	v, ok := p.provider.(Versioner)
+	if !ok {
+		return nil, ErrVersionsNotSupported
+	}
+	return v.History(ctx, key)
+}
+
+func (p *encryptedProvider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	v, ok := p.provider.(Versioner)
+	if !ok {
+		return "", ErrVersionsNotSupported
+	}
+
+	value, err := v.GetVersion(ctx, key, version)
+	if err != nil || value == "" {
+		return value, err
+	}
+	return p.decrypt(ctx, key, value)
+}
+
+// encrypt returns this envelope: "enc:v1:<KEK ID>:<wrapped DEK>:<nonce + ciphertext>".
+// The KEK ID may contain colons (e.g. a KMS key ARN), but it can't be empty.
+func (p *encryptedProvider) encrypt(ctx context.Context, key, value string) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+
+	ct, err := seal(dek, []byte(value), []byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, kekID, err := p.kw.WrapKey(ctx, dek)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	if kekID == "" {
+		return "", errors.New("failed to wrap data key: empty KEK ID")
+	}
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s%s:%s:%s", envelopePrefix, kekID, enc.EncodeToString(wrapped), enc.EncodeToString(ct)), nil
+}
+
+func (p *encryptedProvider) decrypt(ctx context.Context, key, value string) (string, error) {
+	envelope, ok := strings.CutPrefix(value, envelopePrefix)
+	if !ok {
+		return value, nil // Plaintext value, stored before enabling encryption.
+	}
+
+	kekID, wrapped, ct, err := parseEnvelope(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	dek, err := p.kw.UnwrapKey(ctx, kekID, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	pt, err := unseal(dek, ct, []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// parseEnvelope splits an envelope (without its prefix) into its KEK ID, wrapped
+// DEK, and ciphertext. The base64-encoded fields never contain colons, so they
+// are parsed from the right, and the KEK ID is allowed to contain colons.
+func parseEnvelope(envelope string) (string, []byte, []byte, error) {
+	rest, ct64, ok := cutLast(envelope, ":")
+	if !ok {
+		return "", nil, nil, errors.New("invalid encryption envelope")
+	}
+	kekID, wrapped64, ok := cutLast(rest, ":")
+	if !ok || kekID == "" {
+		return "", nil, nil, errors.New("invalid encryption envelope")
+	}
+
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(wrapped64)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid encryption envelope: %w", err)
+	}
+	ct, err := enc.DecodeString(ct64)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid encryption envelope: %w", err)
+	}
+
+	return kekID, wrapped, ct, nil
+}
+
+// cutLast is like [strings.Cut], but it splits around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// ReEncrypt decrypts and re-encrypts all the values in the given [Manager],
+// which must have been initialized with encryption (all the providers
+// support listing, see [Lister]). This is used to migrate existing secrets to the current
+// KEK after rotating it, and to encrypt plaintext values after enabling
+// encryption. It returns the number of values that were re-encrypted.
+// It covers only a single namespace: the one in the context (see
+// [WithNamespace]), or the manager's default one.
+//
+// Previous versions of link credentials (see [Versioner]) are re-encrypted in
+// place if the provider emulates them. Native version histories (in AWS Parameter
+// Store and Vault KV v2) can't be modified, so this creates a new version of each
+// value, and previous versions remain readable only with the KEKs they were
+// encrypted with, for as long as the provider retains them.
+func ReEncrypt(ctx context.Context, m Manager) (int, error) {
+	w, ok := m.(*genericWrapper)
+	if !ok {
+		return 0, errors.New("unexpected secrets manager type")
+	}
+	p := w.provider
+	if c, ok := p.(*cachedProvider); ok {
+		p = c.provider
+	}
+	e, ok := p.(*encryptedProvider)
+	if !ok {
+		return 0, errors.New("secrets encryption is not enabled")
+	}
+	ev, emulated := e.provider.(*emulatedVersionsProvider)
+
+	keys, err := w.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, k := range keys {
+		if emulated && strings.HasSuffix(k, versionedSuffix) {
+			err = ev.rewrite(ctx, w.namespaced(ctx, k), e.reEncrypt(ctx))
+		} else {
+			err = reEncryptValue(ctx, w, k)
+		}
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", k, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func reEncryptValue(ctx context.Context, m Manager, key string) error {
+	v, err := m.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return m.Set(ctx, key, v)
+}
+
+// reEncrypt returns a function which decrypts a stored value (if
+// it's encrypted at all), and encrypts it again with the current KEK.
+func (p *encryptedProvider) reEncrypt(ctx context.Context) func(key, value string) (string, error) {
+	return func(key, value string) (string, error) {
+		pt, err := p.decrypt(ctx, key, value)
+		if err != nil {
+			return "", err
+		}
+		return p.encrypt(ctx, key, pt)
+	}
+}
+
+// localKeyWrapper is a [KeyWrapper] based on one or more
+// locally-available KEKs. The first one is used to wrap new
+// data keys, all of them can be used to unwrap existing ones.
+type localKeyWrapper struct {
+	currentID string
+	keks      map[string][]byte
+}
+
+// NewLocalKeyWrapper parses a list of KEKs, separated by whitespaces and/or commas.
+// Each KEK is specified as "<ID>:<base64-encoded 32 random bytes>", for example
+// "2026-10:" followed by the output of "openssl rand -base64 32". The first KEK is
+// the current one, the rest are previous ones which are still needed for decryption.
+func NewLocalKeyWrapper(keys string) (KeyWrapper, error) {
+	kw := &localKeyWrapper{keks: map[string][]byte{}}
+	for _, s := range strings.FieldsFunc(keys, isKeySeparator) {
+		id, b64, ok := strings.Cut(s, ":")
+		if !ok || id == "" {
+			return nil, errors.New("invalid KEK: expecting <ID>:<base64 key>")
+		}
+		if _, ok := kw.keks[id]; ok {
+			return nil, fmt.Errorf("duplicate KEK ID: %s", id)
+		}
+
+		kek, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KEK %q: %w", id, err)
+		}
+		if len(kek) != keySize {
+			return nil, fmt.Errorf("invalid KEK %q: expecting %d bytes, got %d", id, keySize, len(kek))
+		}
+
+		if kw.currentID == "" {
+			kw.currentID = id
+		}
+		kw.keks[id] = kek
+	}
+
+	if kw.currentID == "" {
+		return nil, errors.New("no KEKs specified")
+	}
+	return kw, nil
+}
+
+func isKeySeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+func (kw *localKeyWrapper) WrapKey(_ context.Context, dek []byte) ([]byte, string, error) {
+	wrapped, err := seal(kw.keks[kw.currentID], dek, []byte(kw.currentID))
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, kw.currentID, nil
+}
+
+func (kw *localKeyWrapper) UnwrapKey(_ context.Context, kekID string, wrapped []byte) ([]byte, error) {
+	kek, ok := kw.keks[kekID]
+	if !ok {
+		return nil, fmt.Errorf("unknown KEK ID: %s", kekID)
+	}
+	return unseal(kek, wrapped, []byte(kekID))
+}
+
+// seal encrypts and authenticates the given plaintext and additional data
+// with AES-GCM, and returns the random nonce followed by the ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// unseal is the inverse of [seal].
+func unseal(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, errors.New("decryption failed")
+	}
+	return pt, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,264 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testKEK1 = "kek1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testKEK2 = "kek2:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+)
+
+func TestEncryptedProvider(t *testing.T) {
+	kw, err := NewLocalKeyWrapper(testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := newInMemoryProvider()
+	m := WithEncryption(&genericWrapper{provider: p, namespace: "test"}, kw)
+
+	if err := m.Set(t.Context(), "id/creds", "secret"); err != nil {
+		t.Fatalf("encryptedProvider.Set() error = %v", err)
+	}
+
+	stored, _ := p.Get(t.Context(), "thrippy/test/id/creds")
+	if !strings.HasPrefix(stored, envelopePrefix+"kek1:") {
+		t.Errorf("stored value = %q, want encryption envelope with kek1", stored)
+	}
+	if strings.Contains(stored, "secret") {
+		t.Errorf("stored value = %q, contains plaintext", stored)
+	}
+
+	got, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Fatalf("encryptedProvider.Get() error = %v", err)
+	}
+	if got != "secret" {
+		t.Errorf("encryptedProvider.Get() = %q, want %q", got, "secret")
+	}
+
+	// Missing keys.
+	got, err = m.Get(t.Context(), "id/missing")
+	if err != nil {
+		t.Errorf("encryptedProvider.Get(missing key) error = %v", err)
+	}
+	if got != "" {
+		t.Errorf("encryptedProvider.Get(missing key) = %q, want %q", got, "")
+	}
+
+	// Plaintext values which were stored before enabling encryption.
+	_ = p.Set(t.Context(), "thrippy/test/id/meta", "plaintext")
+	got, err = m.Get(t.Context(), "id/meta")
+	if err != nil {
+		t.Errorf("encryptedProvider.Get(plaintext) error = %v", err)
+	}
+	if got != "plaintext" {
+		t.Errorf("encryptedProvider.Get(plaintext) = %q, want %q", got, "plaintext")
+	}
+
+	// Encrypted values are bound to their storage keys.
+	_ = p.Set(t.Context(), "thrippy/test/id/oauth", stored)
+	if _, err := m.Get(t.Context(), "id/oauth"); err == nil {
+		t.Error("encryptedProvider.Get(swapped value) error = nil, want error")
+	}
+}
+
+func TestEncryptedProviderKEKIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		kekID   string
+		wantErr bool
+	}{
+		{
+			name:  "simple",
+			kekID: "kek1",
+		},
+		{
+			name:  "kms_key_arn",
+			kekID: "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kw := &localKeyWrapper{currentID: tt.kekID, keks: map[string][]byte{tt.kekID: make([]byte, keySize)}}
+			p, _ := newInMemoryProvider()
+			m := WithEncryption(&genericWrapper{provider: p, namespace: "test"}, kw)
+
+			err := m.Set(t.Context(), "id/creds", "secret")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encryptedProvider.Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := m.Get(t.Context(), "id/creds")
+			if err != nil {
+				t.Fatalf("encryptedProvider.Get() error = %v", err)
+			}
+			if got != "secret" {
+				t.Errorf("encryptedProvider.Get() = %q, want %q", got, "secret")
+			}
+		})
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	p, _ := newInMemoryProvider()
+	w := &genericWrapper{provider: p, namespace: "test"}
+	_ = w.Set(t.Context(), "id/template", "plaintext")
+
+	kw1, err := NewLocalKeyWrapper(testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := WithEncryption(w, kw1)
+	_ = m1.Set(t.Context(), "id/creds", "secret")
+
+	// Rotation: new current KEK, old one is still available for decryption.
+	kw2, err := NewLocalKeyWrapper(testKEK2 + ", " + testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := WithEncryption(w, kw2)
+
+	n, err := ReEncrypt(t.Context(), m2)
+	if err != nil {
+		t.Fatalf("ReEncrypt() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("ReEncrypt() = %d, want 2", n)
+	}
+
+	// The old KEK is no longer needed.
+	kw3, err := NewLocalKeyWrapper(testKEK2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3 := WithEncryption(w, kw3)
+
+	for k, want := range map[string]string{"id/template": "plaintext", "id/creds": "secret"} {
+		got, err := m3.Get(t.Context(), k)
+		if err != nil {
+			t.Errorf("Get(%q) error = %v", k, err)
+		}
+		if got != want {
+			t.Errorf("Get(%q) = %q, want %q", k, got, want)
+		}
+	}
+
+	if _, err := ReEncrypt(t.Context(), w); err == nil {
+		t.Error("ReEncrypt(unencrypted manager) error = nil, want error")
+	}
+}
+
+func TestReEncryptVersions(t *testing.T) {
+	p, _ := newInMemoryProvider()
+	w := &genericWrapper{provider: withVersions(p), namespace: "test"}
+
+	kw1, err := NewLocalKeyWrapper(testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := WithEncryption(w, kw1)
+	_ = m1.Set(t.Context(), "id/creds", "secret1")
+	_ = m1.Set(t.Context(), "id/creds", "secret2")
+
+	kw2, err := NewLocalKeyWrapper(testKEK2 + ", " + testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReEncrypt(t.Context(), WithEncryption(w, kw2)); err != nil {
+		t.Fatalf("ReEncrypt() error = %v", err)
+	}
+
+	// Previous versions are re-encrypted in place, without adding a new version.
+	kw3, err := NewLocalKeyWrapper(testKEK2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3 := WithEncryption(w, kw3)
+	v := m3.(Versioner)
+
+	h, err := v.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History() error = %v", err)
+	}
+	if len(h) != 2 {
+		t.Errorf("History() = %v, want 2 versions", h)
+	}
+
+	for i, want := range []string{"secret1", "secret2"} {
+		got, err := v.GetVersion(t.Context(), "id/creds", i+1)
+		if err != nil {
+			t.Errorf("GetVersion(%d) error = %v", i+1, err)
+		}
+		if got != want {
+			t.Errorf("GetVersion(%d) = %q, want %q", i+1, got, want)
+		}
+	}
+
+	got, err := m3.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if got != "secret2" {
+		t.Errorf("Get() = %q, want %q", got, "secret2")
+	}
+}
+
+func TestNewLocalKeyWrapper(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+		{
+			name: "single",
+			keys: testKEK1,
+		},
+		{
+			name: "multiple",
+			keys: testKEK1 + "\n" + testKEK2 + "\n",
+		},
+		{
+			name:    "missing_id",
+			keys:    "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate_id",
+			keys:    testKEK1 + "," + testKEK1,
+			wantErr: true,
+		},
+		{
+			name:    "invalid_base64",
+			keys:    "kek:!!!",
+			wantErr: true,
+		},
+		{
+			name:    "short_key",
+			keys:    "kek:AAAA",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLocalKeyWrapper(tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("NewLocalKeyWrapper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
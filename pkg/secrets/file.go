@@ -2,10 +2,16 @@ package secrets
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 
@@ -21,61 +27,196 @@ const (
 	DataFilePerm = 0o600
 )
 
+var errCorruptedFile = errors.New("corrupted secrets file")
+
+// fileProvider stores secrets in a local TOML file. It is safe for concurrent
+// use by multiple goroutines and multiple processes: all access is coordinated
+// with an OS-level lock on a sibling lock file, and all writes replace the data
+// file atomically. The previous version of the data file is kept as a backup,
+// to recover from corruptions. Parsed data is cached in memory, and reloaded
+// only when the data file is changed by another process.
 type fileProvider struct {
 	path string
-	mu   sync.RWMutex
+	mu   sync.Mutex
+
+	cache     map[string]string
+	cacheInfo os.FileInfo
 }
 
 func newFileProvider(ctx context.Context) (Manager, error) { //nolint:unparam // Special case compared to other providers.
 	return &fileProvider{path: dataFile(ctx)}, nil
 }
 
-func (p *fileProvider) Set(_ context.Context, key, value string) error {
+func (p *fileProvider) Set(ctx context.Context, key, value string) error {
+	return p.update(ctx, func(store map[string]string) error {
+		store[key] = value
+		return nil
+	})
+}
+
+func (p *fileProvider) updateKeys(ctx context.Context, keys []string, f func(map[string]string) error) error {
+	return p.update(ctx, func(store map[string]string) error {
+		values := make(map[string]string, len(keys))
+		for _, k := range keys {
+			if v, ok := store[k]; ok {
+				values[k] = v
+			}
+		}
+
+		if err := f(values); err != nil {
+			return err
+		}
+
+		maps.Copy(store, values)
+		return nil
+	})
+}
+
+func (p *fileProvider) Get(ctx context.Context, key string) (string, error) {
+	store, err := p.read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := store[key]
+	if !ok {
+		return "", nil
+	}
+	return v, nil
+}
+
+func (p *fileProvider) Delete(ctx context.Context, key string) error {
+	return p.update(ctx, func(store map[string]string) error {
+		delete(store, key)
+		return nil
+	})
+}
+
+func (p *fileProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	store, err := p.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for k := range store {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// read returns a read-only snapshot of the data file's contents,
+// recovering from a corrupted data file if necessary.
+func (p *fileProvider) read(ctx context.Context) (map[string]string, error) {
+	store, err := p.readLocked()
+	if errors.Is(err, errCorruptedFile) {
+		if err := p.recoverFile(ctx); err != nil {
+			return nil, err
+		}
+		store, err = p.readLocked()
+	}
+	return store, err
+}
+
+func (p *fileProvider) readLocked() (map[string]string, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	store, err := p.readTOMLFile()
+	unlock, err := lockFile(p.lockPath(), false)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer unlock()
 
-	store[key] = value
-	if err := p.writeTOMLFile(store); err != nil {
-		return err
+	return p.readTOMLFile()
+}
+
+// update applies the given function to a copy of the data file's contents,
+// and writes the result back (unless the function fails), without allowing any
+// other goroutine or process to read or modify the data file in the meantime.
+func (p *fileProvider) update(ctx context.Context, f func(map[string]string) error) error {
+	err := p.updateLocked(f)
+	if errors.Is(err, errCorruptedFile) {
+		if err := p.recoverFile(ctx); err != nil {
+			return err
+		}
+		err = p.updateLocked(f)
 	}
-	return nil
+	return err
 }
 
-func (p *fileProvider) Get(_ context.Context, key string) (string, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+func (p *fileProvider) updateLocked(f func(map[string]string) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	unlock, err := lockFile(p.lockPath(), true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	store, err := p.readTOMLFile()
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	v, ok := store[key]
-	if !ok {
-		return "", nil
+	store = maps.Clone(store)
+	if err := f(store); err != nil {
+		return err
 	}
-	return v, nil
+	return p.writeTOMLFile(store)
 }
 
-func (p *fileProvider) Delete(_ context.Context, key string) error {
+// recoverFile replaces a corrupted data file with the most recent backup,
+// or with the last known good contents in the in-memory cache, or (as
+// a last resort) with an empty file. The corrupted file is not deleted.
+func (p *fileProvider) recoverFile(ctx context.Context) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	store, err := p.readTOMLFile()
+	unlock, err := lockFile(p.lockPath(), true)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	delete(store, key)
-	if err := p.writeTOMLFile(store); err != nil {
+	// Another process may have already recovered the data file.
+	if _, err := p.readTOMLFile(); !errors.Is(err, errCorruptedFile) {
 		return err
 	}
-	return nil
+
+	l := logger.FromContext(ctx).With(slog.String("path", p.path))
+	quarantine := fmt.Sprintf("%s.corrupt-%d", p.path, time.Now().Unix())
+	if err := os.Rename(p.path, quarantine); err != nil {
+		return err
+	}
+	l.Error("corrupted secrets file, moved aside", slog.String("new_path", quarantine))
+
+	store, err := decodeTOMLFile(p.backupPath())
+	switch {
+	case err == nil:
+		l.Warn("restoring secrets file from backup")
+	case p.cache != nil:
+		l.Warn("restoring secrets file from in-memory cache", slog.Any("error", err))
+		store = p.cache
+	default:
+		l.Error("no backup of secrets file, starting from scratch", slog.Any("error", err))
+		store = map[string]string{}
+	}
+
+	return p.writeTOMLFile(store)
+}
+
+func (p *fileProvider) lockPath() string {
+	return p.path + ".lock"
+}
+
+func (p *fileProvider) backupPath() string {
+	return p.path + ".bak"
 }
 
 // dataFile returns the path to the app's data file.
@@ -93,61 +234,69 @@ func dataFile(ctx context.Context) string {
 	return path
 }
 
+// readTOMLFile returns the cached contents of the data file, unless
+// it was modified or replaced since they were cached. The caller
+// must hold both the in-process mutex and the OS-level file lock.
 func (p *fileProvider) readTOMLFile() (map[string]string, error) {
-	var tomlStore map[string]any
-	if _, err := toml.DecodeFile(p.path, &tomlStore); err != nil {
+	info, err := os.Stat(p.path)
+	if err != nil {
 		return nil, err
 	}
 
-	flatStore := map[string]string{}
-	for prefix, v1 := range tomlStore {
-		m1, ok := v1.(map[string]any)
-		if !ok {
-			continue
-		}
-		for namespace, v2 := range m1 {
-			m2, ok := v2.(map[string]any)
-			if !ok {
-				continue
-			}
-			for id, v3 := range m2 {
-				m3, ok := v3.(map[string]any)
-				if !ok {
-					continue
-				}
-				for field, v4 := range m3 {
-					s, ok := v4.(string)
-					if !ok {
-						continue
-					}
-					k := fmt.Sprintf("%s/%s/%s/%s", prefix, namespace, id, field)
-					flatStore[k] = s
-				}
-			}
-		}
+	if p.cacheInfo != nil && os.SameFile(info, p.cacheInfo) &&
+		info.ModTime().Equal(p.cacheInfo.ModTime()) && info.Size() == p.cacheInfo.Size() {
+		return p.cache, nil
 	}
 
-	return flatStore, nil
+	store, err := decodeTOMLFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache, p.cacheInfo = store, info
+	return store, nil
 }
 
-func (p *fileProvider) writeTOMLFile(store map[string]string) error {
-	f, err := os.OpenFile(p.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, DataFilePerm)
-	if err != nil {
-		return err
+func decodeTOMLFile(path string) (map[string]string, error) {
+	var tomlStore map[string]any
+	if _, err := toml.DecodeFile(path, &tomlStore); err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, fmt.Errorf("%w: %w", errCorruptedFile, err)
+		}
+		return nil, err
 	}
-	defer f.Close()
 
-	// Ensure file permissions are set correctly even if the file already exists.
-	if err := os.Chmod(p.path, DataFilePerm); err != nil {
-		return err
+	flatStore := map[string]string{}
+	flattenTOML(flatStore, "", tomlStore)
+	return flatStore, nil
+}
+
+// flattenTOML converts nested TOML tables into a flat map, whose keys are
+// the "/"-separated paths of all the string values. The nesting depth
+// depends on the manager's key template (see [ManagerFlags]).
+func flattenTOML(flatStore map[string]string, prefix string, m map[string]any) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			flatStore[prefix+k] = v
+		case map[string]any:
+			flattenTOML(flatStore, prefix+k+"/", v)
+		}
 	}
+}
 
+// writeTOMLFile replaces the data file atomically: it writes the new contents to
+// a temporary file, flushes it to disk, keeps the current data file as a backup,
+// and then renames the temporary file. The caller must hold both the in-process
+// mutex and an exclusive OS-level file lock.
+func (p *fileProvider) writeTOMLFile(store map[string]string) error {
 	// Convert flat "map[string]string" to nested "map[string]any" for TOML encoding.
 	tomlStore := map[string]any{}
 	for k, v := range store {
 		tomlKeys := strings.Split(k, "/")
 		m := tomlStore
-		for i := range 3 {
+		for i := range len(tomlKeys) - 1 {
 			subMap, ok := m[tomlKeys[i]]
 			if !ok {
 				m[tomlKeys[i]] = map[string]any{}
@@ -158,11 +307,50 @@ func (p *fileProvider) writeTOMLFile(store map[string]string) error {
 				return fmt.Errorf("unexpected type for key %s", strings.Join(tomlKeys[:i+1], "/"))
 			}
 		}
-		m[tomlKeys[3]] = v
+		if _, ok := m[tomlKeys[len(tomlKeys)-1]].(map[string]any); ok {
+			return fmt.Errorf("unexpected type for key %s", k)
+		}
+		m[tomlKeys[len(tomlKeys)-1]] = v
 	}
 
+	dir := filepath.Dir(p.path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck // No-op after a successful rename.
+	defer f.Close()
+
+	// Ensure file permissions are set correctly regardless of the umask.
+	if err := f.Chmod(DataFilePerm); err != nil {
+		return err
+	}
 	if err := toml.NewEncoder(f).Encode(tomlStore); err != nil {
 		return err
 	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Best-effort backup: a hard link to the current data file, which
+	// remains intact after the rename below replaces the data file.
+	_ = os.Remove(p.backupPath())
+	_ = os.Link(p.path, p.backupPath())
+
+	if err := os.Rename(f.Name(), p.path); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	// Update the cache to avoid an unnecessary re-read.
+	if info, err := os.Stat(p.path); err == nil {
+		p.cache, p.cacheInfo = store, info
+	}
+
 	return nil
 }
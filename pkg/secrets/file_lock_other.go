@@ -0,0 +1,14 @@
+//go:build !unix
+
+package secrets
+
+// lockFile is a no-op on non-Unix platforms, which are not officially
+// supported: the file provider is safe only for a single process there.
+func lockFile(_ string, _ bool) (func(), error) {
+	return func() {}, nil
+}
+
+// syncDir is a no-op on non-Unix platforms, which don't support syncing directories.
+func syncDir(_ string) error {
+	return nil
+}
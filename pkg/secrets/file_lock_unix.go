@@ -0,0 +1,51 @@
+//go:build unix
+
+package secrets
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an advisory OS-level lock on the given lock file (which
+// is created if necessary), and returns a function that releases the lock.
+// Exclusive locks are meant for writers, shared locks for readers.
+func lockFile(path string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, DataFilePerm) //gosec:disable G304 // Data directory.
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err = syscall.Flock(int(f.Fd()), how) //gosec:disable G115 // File descriptors fit in an int.
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //gosec:disable G115 // File descriptors fit in an int.
+		_ = f.Close()
+	}, nil
+}
+
+// syncDir flushes a directory's entries to disk, to persist renames.
+func syncDir(path string) error {
+	d, err := os.Open(path) //gosec:disable G304 // Data directory.
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
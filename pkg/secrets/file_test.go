@@ -1,6 +1,10 @@
 package secrets
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -56,3 +60,116 @@ func TestFileProvider(t *testing.T) {
 		t.Errorf("fileProvider.Delete(missing key) error = %v", err)
 	}
 }
+
+func TestFileProviderKeyTemplate(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	p, err := newFileProvider(t.Context())
+	if err != nil {
+		t.Fatalf("newFileProvider() error = %v", err)
+	}
+	m := &genericWrapper{provider: p, namespace: "test", keyTemplate: "apps/{namespace}/thrippy/{key}"}
+
+	if err := m.Set(t.Context(), "id/creds.history", "val"); err != nil {
+		t.Fatalf("fileProvider.Set() error = %v", err)
+	}
+
+	// Read the data file from scratch, without the in-memory cache.
+	store, err := decodeTOMLFile(p.(*fileProvider).path)
+	if err != nil {
+		t.Fatalf("decodeTOMLFile() error = %v", err)
+	}
+	if v := store["apps/test/thrippy/id/creds.history"]; v != "val" {
+		t.Errorf("decodeTOMLFile() = %v", store)
+	}
+
+	// Values and tables can't share the same path.
+	if err := m.Set(t.Context(), "id", "val"); err == nil {
+		t.Error("fileProvider.Set(conflicting key) error = nil")
+	}
+}
+
+func TestFileProviderMultipleProcesses(t *testing.T) {
+	d := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", d)
+
+	// Separate provider instances simulate separate processes.
+	p1, _ := newFileProvider(t.Context())
+	p2, _ := newFileProvider(t.Context())
+	m1 := &genericWrapper{provider: p1, namespace: "test"}
+	m2 := &genericWrapper{provider: p2, namespace: "test"}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		m := m1
+		if i%2 == 1 {
+			m = m2
+		}
+		wg.Go(func() {
+			if err := m.Set(t.Context(), fmt.Sprintf("id%d/field", i), "val"); err != nil {
+				t.Errorf("fileProvider.Set() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, m := range []*genericWrapper{m1, m2} {
+		keys, err := m.List(t.Context(), "")
+		if err != nil {
+			t.Fatalf("fileProvider.List() error = %v", err)
+		}
+		if len(keys) != 20 {
+			t.Errorf("fileProvider.List() = %d keys, want 20", len(keys))
+		}
+	}
+
+	// Cache invalidation after a change by another "process".
+	if err := m1.Set(t.Context(), "id0/field", "new"); err != nil {
+		t.Fatalf("fileProvider.Set() error = %v", err)
+	}
+	v, err := m2.Get(t.Context(), "id0/field")
+	if err != nil {
+		t.Fatalf("fileProvider.Get() error = %v", err)
+	}
+	if v != "new" {
+		t.Errorf("fileProvider.Get() = %q, want %q", v, "new")
+	}
+}
+
+func TestFileProviderRecovery(t *testing.T) {
+	d := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", d)
+
+	p, _ := newFileProvider(t.Context())
+	m := &genericWrapper{provider: p, namespace: "test"}
+	path := p.(*fileProvider).path
+
+	_ = m.Set(t.Context(), "id/field1", "val1")
+	_ = m.Set(t.Context(), "id/field2", "val2")
+
+	if err := os.WriteFile(path, []byte("[corrupted"), DataFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backup contains the state before the last write.
+	v, err := m.Get(t.Context(), "id/field1")
+	if err != nil {
+		t.Fatalf("fileProvider.Get() error = %v", err)
+	}
+	if v != "val1" {
+		t.Errorf("fileProvider.Get() = %q, want %q", v, "val1")
+	}
+
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	if len(matches) != 1 {
+		t.Errorf("quarantined files = %v, want 1", matches)
+	}
+
+	// Subsequent writes work normally.
+	if err := m.Set(t.Context(), "id/field2", "val3"); err != nil {
+		t.Errorf("fileProvider.Set() error = %v", err)
+	}
+	if v, _ := m.Get(t.Context(), "id/field2"); v != "val3" {
+		t.Errorf("fileProvider.Get() = %q, want %q", v, "val3")
+	}
+}
@@ -0,0 +1,259 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	kubernetesOption = "kubernetes"
+
+	k8sManagedByLabel   = "app.kubernetes.io/managed-by"
+	k8sManagedByValue   = "thrippy"
+	k8sPathAnnotation   = "thrippy.tzrikka.com/path"
+	k8sNamespaceFile    = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	k8sSecretNamePrefix = "thrippy-"
+)
+
+// KubernetesFlags defines global (but hidden) CLI flags. The purpose of
+// these CLI flags is to initialize the Kubernetes Secrets provider via
+// environment variables and/or the application's configuration file.
+func KubernetesFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "secrets-k8s-kubeconfig",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("KUBECONFIG"),
+				toml.TOML("secrets.kubernetes.kubeconfig", configFilePath),
+			),
+			Hidden:    true,
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name: "secrets-k8s-namespace",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_K8S_NAMESPACE"),
+				toml.TOML("secrets.kubernetes.namespace", configFilePath),
+			),
+			Hidden: true,
+		},
+	}
+}
+
+// kubernetesProvider stores secrets as Kubernetes [Secret] objects. Each
+// Thrippy key is split into a path (e.g. "thrippy/<namespace>/<link ID>")
+// and a field name (e.g. "creds"). All the fields of the same path are
+// stored as data keys in a single Secret object, whose name is derived
+// from a hash of the path, because Kubernetes object names must be
+// lowercase while link IDs are case-sensitive. The path itself is
+// stored in an annotation, and all the Secret objects have an
+// ownership label, to enable listing.
+//
+// [Secret]: https://kubernetes.io/docs/concepts/configuration/secret/
+type kubernetesProvider struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func newKubernetesProvider(cmd *cli.Command) (Manager, error) {
+	cfg, err := kubernetesConfig(cmd.String("secrets-k8s-kubeconfig"))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubernetesProvider{client: client, namespace: kubernetesNamespace(cmd.String("secrets-k8s-namespace"))}, nil
+}
+
+// kubernetesConfig uses the in-cluster service account by default,
+// unless an explicit kubeconfig file is specified, or Thrippy is
+// running outside of a Kubernetes cluster.
+func kubernetesConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		cfg, err := rest.InClusterConfig()
+		if err == nil {
+			return cfg, nil
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, nil).ClientConfig()
+}
+
+// kubernetesNamespace returns the given Kubernetes namespace, or the
+// in-cluster service account's namespace, or the default namespace.
+func kubernetesNamespace(ns string) string {
+	if ns != "" {
+		return ns
+	}
+
+	if b, err := os.ReadFile(k8sNamespaceFile); err == nil {
+		if ns = strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+
+	return metav1.NamespaceDefault
+}
+
+// k8sSecretName returns a valid and deterministic Kubernetes object name for the
+// given Thrippy key path. 80 bits of SHA-256 make collisions practically impossible,
+// but they are also detected by comparing the path annotation.
+func k8sSecretName(keyPath string) string {
+	h := sha256.Sum256([]byte(keyPath))
+	return k8sSecretNamePrefix + hex.EncodeToString(h[:10])
+}
+
+// splitKey splits a Thrippy key into a path and a field name.
+func splitKey(key string) (keyPath, field string) {
+	return path.Dir(key), path.Base(key)
+}
+
+func (p *kubernetesProvider) Set(ctx context.Context, key, value string) error {
+	keyPath, field := splitKey(key)
+	name := k8sSecretName(keyPath)
+	secrets := p.client.CoreV1().Secrets(p.namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		s, err := p.getSecret(ctx, name, keyPath)
+		if err != nil {
+			return err
+		}
+
+		if s == nil {
+			s = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   p.namespace,
+					Labels:      map[string]string{k8sManagedByLabel: k8sManagedByValue},
+					Annotations: map[string]string{k8sPathAnnotation: keyPath},
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{field: []byte(value)},
+			}
+			_, err = secrets.Create(ctx, s, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("secrets"), name, err)
+			}
+			return err
+		}
+
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Data[field] = []byte(value)
+		_, err = secrets.Update(ctx, s, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (p *kubernetesProvider) Get(ctx context.Context, key string) (string, error) {
+	keyPath, field := splitKey(key)
+	s, err := p.getSecret(ctx, k8sSecretName(keyPath), keyPath)
+	if err != nil || s == nil {
+		return "", err
+	}
+
+	return string(s.Data[field]), nil
+}
+
+func (p *kubernetesProvider) Delete(ctx context.Context, key string) error {
+	keyPath, field := splitKey(key)
+	name := k8sSecretName(keyPath)
+	secrets := p.client.CoreV1().Secrets(p.namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		s, err := p.getSecret(ctx, name, keyPath)
+		if err != nil || s == nil {
+			return err
+		}
+
+		if _, ok := s.Data[field]; !ok {
+			return nil
+		}
+
+		// Delete the entire Secret object when deleting its last field.
+		delete(s.Data, field)
+		if len(s.Data) == 0 {
+			opts := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &s.ResourceVersion}}
+			err = secrets.Delete(ctx, name, opts)
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		_, err = secrets.Update(ctx, s, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (p *kubernetesProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	opts := metav1.ListOptions{LabelSelector: k8sManagedByLabel + "=" + k8sManagedByValue}
+	var keys []string
+	for {
+		list, err := p.client.CoreV1().Secrets(p.namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range list.Items {
+			keyPath := s.Annotations[k8sPathAnnotation]
+			if keyPath == "" {
+				continue
+			}
+			for field := range s.Data {
+				if k := keyPath + "/" + field; strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+		}
+
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// getSecret returns the Kubernetes Secret object with the given name, or
+// nil if it doesn't exist. It also verifies the object's path annotation.
+func (p *kubernetesProvider) getSecret(ctx context.Context, name, keyPath string) (*corev1.Secret, error) {
+	s, err := p.client.CoreV1().Secrets(p.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if got := s.Annotations[k8sPathAnnotation]; got != keyPath {
+		return nil, fmt.Errorf("kubernetes secret %q belongs to %q, not %q", name, got, keyPath)
+	}
+	return s, nil
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesProvider(t *testing.T) {
+	client := fake.NewClientset()
+	p := &kubernetesProvider{client: client, namespace: "thrippy"}
+	m := &genericWrapper{provider: p, namespace: "test"}
+
+	v1, err := m.Get(t.Context(), "id/field1")
+	if err != nil {
+		t.Errorf("kubernetesProvider.Get(missing key) error = %v", err)
+	}
+	if v1 != "" {
+		t.Errorf("kubernetesProvider.Get(missing key) = %q, want %q", v1, "")
+	}
+
+	v2 := "val1"
+	if err := m.Set(t.Context(), "id/field1", v2); err != nil {
+		t.Errorf("kubernetesProvider.Set() error = %v", err)
+	}
+
+	v2 = "val2"
+	if err := m.Set(t.Context(), "id/field1", v2); err != nil {
+		t.Errorf("kubernetesProvider.Set() error = %v", err)
+	}
+	if err := m.Set(t.Context(), "id/field2", "val3"); err != nil {
+		t.Errorf("kubernetesProvider.Set() error = %v", err)
+	}
+
+	v1, err = m.Get(t.Context(), "id/field1")
+	if err != nil {
+		t.Errorf("kubernetesProvider.Get() error = %v", err)
+	}
+	if v1 != v2 {
+		t.Errorf("kubernetesProvider.Get() = %q, want %q", v1, v2)
+	}
+
+	// Both fields are stored in a single Secret object.
+	name := k8sSecretName("thrippy/test/id")
+	s, err := client.CoreV1().Secrets("thrippy").Get(t.Context(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Secrets.Get() error = %v", err)
+	}
+	if got := s.Labels[k8sManagedByLabel]; got != k8sManagedByValue {
+		t.Errorf("secret label = %q, want %q", got, k8sManagedByValue)
+	}
+	if got := len(s.Data); got != 2 {
+		t.Errorf("secret data keys = %d, want 2", got)
+	}
+
+	keys, err := m.List(t.Context(), "")
+	if err != nil {
+		t.Errorf("kubernetesProvider.List() error = %v", err)
+	}
+	if want := []string{"id/field1", "id/field2"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("kubernetesProvider.List() = %v, want %v", keys, want)
+	}
+
+	if err := m.Delete(t.Context(), "id/field1"); err != nil {
+		t.Errorf("kubernetesProvider.Delete() error = %v", err)
+	}
+
+	v1, err = m.Get(t.Context(), "id/field1")
+	if err != nil {
+		t.Errorf("kubernetesProvider.Get(missing key) error = %v", err)
+	}
+	if v1 != "" {
+		t.Errorf("kubernetesProvider.Get(missing key) = %q, want %q", v1, "")
+	}
+
+	if err := m.Delete(t.Context(), "id/field1"); err != nil {
+		t.Errorf("kubernetesProvider.Delete(missing key) error = %v", err)
+	}
+
+	// Deleting the last field deletes the Secret object.
+	if err := m.Delete(t.Context(), "id/field2"); err != nil {
+		t.Errorf("kubernetesProvider.Delete() error = %v", err)
+	}
+	list, err := client.CoreV1().Secrets("thrippy").List(t.Context(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Secrets.List() error = %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("Secrets.List() = %d items, want 0", len(list.Items))
+	}
+}
+
+func TestKubernetesProviderPathMismatch(t *testing.T) {
+	name := k8sSecretName("thrippy/test/id")
+	client := fake.NewClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "thrippy",
+			Annotations: map[string]string{k8sPathAnnotation: "thrippy/test/other"},
+		},
+	})
+	p := &kubernetesProvider{client: client, namespace: "thrippy"}
+
+	if _, err := p.Get(t.Context(), "thrippy/test/id/field"); err == nil {
+		t.Error("kubernetesProvider.Get() error = nil, want error")
+	}
+	if err := p.Set(t.Context(), "thrippy/test/id/field", "val"); err == nil {
+		t.Error("kubernetesProvider.Set() error = nil, want error")
+	}
+}
@@ -2,36 +2,103 @@
 // user secrets, using one of these providers:
 //   - In-memory storage ("in-memory") - see note below!
 //   - AWS Parameter Store ("aws")
+//   - AWS Secrets Manager ("aws-secretsmanager")
 //   - Google Cloud Parameter Store ("gcp")
 //   - HashiCorp Vault ("vault")
+//   - Kubernetes Secrets ("kubernetes")
+//   - SQL database: SQLite or PostgreSQL ("sql")
 //
 // Configuration in environment variables:
 //   - THRIPPY_SECRETS_PROVIDER
 //   - THRIPPY_SECRETS_NAMESPACE
+//   - THRIPPY_SECRETS_KEY_TEMPLATE
+//   - THRIPPY_SECRETS_MAX_VALUE_SIZE
+//   - THRIPPY_SECRETS_CACHE_TTL
+//   - THRIPPY_SECRETS_CACHE_MAX_ENTRIES
+//   - THRIPPY_SECRETS_KEK
+//   - THRIPPY_SECRETS_KEK_FILE
+//   - THRIPPY_SECRETS_SQL_DRIVER
+//   - THRIPPY_SECRETS_SQL_DSN
+//   - THRIPPY_SECRETS_K8S_NAMESPACE
+//   - KUBECONFIG
 //   - AWS_REGION
 //   - AWS_KMS_KEY_ID
+//   - THRIPPY_SECRETS_AWS_TAGS
+//   - THRIPPY_SECRETS_AWS_RECOVERY_WINDOW_DAYS
 //   - VAULT_ADDR
 //   - VAULT_CACERT
+//   - VAULT_NAMESPACE
 //   - VAULT_TOKEN
+//   - THRIPPY_SECRETS_VAULT_MOUNT
+//   - THRIPPY_SECRETS_VAULT_KV_VERSION
+//   - THRIPPY_SECRETS_VAULT_AUTH_METHOD
+//   - THRIPPY_SECRETS_VAULT_AUTH_MOUNT
+//   - THRIPPY_SECRETS_VAULT_ROLE_ID
+//   - THRIPPY_SECRETS_VAULT_SECRET_ID
+//   - THRIPPY_SECRETS_VAULT_K8S_ROLE
+//   - THRIPPY_SECRETS_VAULT_K8S_TOKEN_FILE
 //
 // Configuration in the file "$XDG_CONFIG_HOME/thrippy/config.toml":
 //
 //	[secrets]
 //	provider = "in-memory"
 //	namespace = "default"
+//	key_template = "thrippy/{namespace}/{key}"
+//	max_value_size = 4096 # Default: depends on the provider.
+//
+//	[secrets.cache]
+//	ttl = "5m" # Default: 0 = disabled.
+//	max_entries = 1000
+//
+//	[secrets.encryption]
+//	kek_file = "/path/to/keks.txt"
 //
 //	[secrets.aws]
 //	region = "us-west-2"
 //	kms_key_id = "arn:aws:kms:us-west-2:123456789012:alias/..."
+//	tags = "team=platform,env=prod" # Secrets Manager only.
+//	recovery_window_days = 30 # Secrets Manager only, 0 = no recovery.
 //
 //	[secrets.vault]
 //	address = "https://127.0.0.1:8200"
 //	cacert = "/path/to/vault-ca.pem"
+//	namespace = "..." # Vault Enterprise only.
+//	mount = "secret"
+//	kv_version = 2
+//	auth_method = "token" # Or "approle", or "kubernetes".
+//	auth_mount = "..." # Default: same as the auth method.
 //	token = "..."
+//	role_id = "..." # AppRole.
+//	secret_id = "..." # AppRole.
+//	k8s_role = "..." # Kubernetes.
+//	k8s_token_file = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+//
+//	[secrets.kubernetes]
+//	kubeconfig = "/path/to/kubeconfig" # Default: in-cluster service account.
+//	namespace = "thrippy" # Default: the service account's namespace.
+//
+//	[secrets.sql]
+//	driver = "sqlite" # Or "postgres".
+//	dsn = "file:/path/to/secrets.db"
 //
 // Notes:
 //   - The in-memory provider is used by default when specifying the "--dev" flag,
 //     but it is unreliable and insecure for real-world use!
+//   - The SQL provider requires envelope encryption (see below), unless
+//     specifying the "--dev" flag, because it stores values as-is.
+//   - Specifying one or more key encryption keys (KEKs) enables client-side
+//     envelope encryption of all secrets, with any provider. See
+//     [NewLocalKeyWrapper] for the format, and [ReEncrypt] for key rotation.
+//   - All providers retain the last few versions of link credentials (see [Versioner]
+//     and [Rollback]): natively in AWS Parameter Store and Vault KV v2, and by
+//     emulation (up to 10 versions, excluding automatic token updates, see
+//     [WithoutNewVersion]) in all the other providers.
+//   - Values larger than the provider's size limit (4 KiB in AWS Parameter Store,
+//     64 KiB in AWS Secrets Manager, 512 KiB in Vault, or the "max_value_size"
+//     setting) are compressed and split into multiple keys transparently.
+//   - The "key_template" setting controls the layout of storage keys, to fit existing
+//     path conventions (e.g. "apps/{namespace}/thrippy/{key}"). The namespace can also
+//     be selected per request, with [WithNamespace] (see the gRPC server's ACL).
 package secrets
 
 import (
@@ -39,6 +106,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
@@ -46,8 +114,14 @@ import (
 )
 
 const (
-	defaultProvider  = inMemoryOption
-	defaultNamespace = "default" // Other examples: "dev", "staging", "prod", etc.
+	defaultProvider    = inMemoryOption
+	defaultNamespace   = "default" // Other examples: "dev", "staging", "prod", etc.
+	defaultKeyTemplate = "thrippy/{namespace}/{key}"
+
+	maxNamespaceLen = 63
+
+	// probeKey doesn't need to exist, and can't collide with link IDs (short UUIDs).
+	probeKey = "health/probe"
 )
 
 // ManagerFlags defines global (but hidden) CLI flags. The purpose
@@ -65,10 +139,13 @@ func ManagerFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			Hidden: true,
 			Validator: func(v string) error {
 				options := map[string]bool{
-					awsOption:      true,
-					fileOption:     true,
-					inMemoryOption: true,
-					vaultOption:    true,
+					awsOption:               true,
+					awsSecretsManagerOption: true,
+					fileOption:              true,
+					inMemoryOption:          true,
+					kubernetesOption:        true,
+					sqlOption:               true,
+					vaultOption:             true,
 				}
 				if ok := options[v]; !ok {
 					return errors.New("unrecognized option")
@@ -85,6 +162,24 @@ func ManagerFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			),
 			Hidden: true,
 		},
+		&cli.StringFlag{
+			Name:  "secrets-key-template",
+			Value: defaultKeyTemplate,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_KEY_TEMPLATE"),
+				toml.TOML("secrets.key_template", configFilePath),
+			),
+			Hidden:    true,
+			Validator: validateKeyTemplate,
+		},
+		&cli.IntFlag{
+			Name: "secrets-max-value-size",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_MAX_VALUE_SIZE"),
+				toml.TOML("secrets.max_value_size", configFilePath),
+			),
+			Hidden: true,
+		},
 	}
 }
 
@@ -95,14 +190,86 @@ type Manager interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// Lister is an optional interface for [Manager] implementations
+// that can enumerate all their keys which start with a given prefix.
+type Lister interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ErrListNotSupported is returned when listing keys
+// with a provider that doesn't implement [Lister].
+var ErrListNotSupported = errors.New("secrets provider does not support listing keys")
+
 type genericWrapper struct {
-	provider  Manager
-	namespace string
+	provider    Manager
+	namespace   string // Default, unless overridden per request with [WithNamespace].
+	keyTemplate string // Empty = [defaultKeyTemplate].
+}
+
+// ValidateNamespace checks that the given namespace is a valid DNS label (like
+// Kubernetes namespaces), so it can't escape its place in the storage key layout.
+func ValidateNamespace(ns string) error {
+	if ns == "" || len(ns) > maxNamespaceLen {
+		return fmt.Errorf("namespace must be 1-%d characters long", maxNamespaceLen)
+	}
+	for i, r := range ns {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(ns)-1:
+		default:
+			return fmt.Errorf("invalid namespace %q: expecting lowercase alphanumeric characters or '-'", ns)
+		}
+	}
+	return nil
+}
+
+// validateKeyTemplate checks that the given storage key template contains exactly one
+// "{namespace}" placeholder, and ends with the "{key}" placeholder (so that listings
+// by key prefix are possible), and that the placeholders are separate path segments.
+func validateKeyTemplate(t string) error {
+	if strings.Count(t, "{namespace}") != 1 || strings.Count(t, "{key}") != 1 {
+		return errors.New(`key template must contain "{namespace}" and "{key}" exactly once`)
+	}
+	if !strings.HasSuffix(t, "/{key}") {
+		return errors.New(`key template must end with "/{key}"`)
+	}
+	if !strings.Contains("/"+t+"/", "/{namespace}/") {
+		return errors.New(`"{namespace}" must be a separate path segment in the key template`)
+	}
+	if strings.HasPrefix(t, "/") || strings.Contains(t, "//") {
+		return errors.New("key template must not contain empty path segments")
+	}
+	return nil
+}
+
+type namespaceKey struct{}
+
+// WithNamespace returns a copy of the given context which overrides the
+// default namespace of all the [Manager] operations that use it. The caller
+// is responsible for validating and authorizing the namespace.
+func WithNamespace(ctx context.Context, ns string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, ns)
+}
+
+// NamespaceFromContext returns the namespace that was set with [WithNamespace], if any.
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	ns, ok := ctx.Value(namespaceKey{}).(string)
+	return ns, ok && ns != ""
+}
+
+// DefaultNamespace returns the default namespace of the given
+// [Manager], or an empty string if it doesn't have one.
+func DefaultNamespace(m Manager) string {
+	if w, ok := m.(*genericWrapper); ok {
+		return w.namespace
+	}
+	return ""
 }
 
 func NewManager(ctx context.Context, cmd *cli.Command) (Manager, error) {
 	provider := cmd.String("secrets-provider")
 	ns := cmd.String("secrets-namespace")
+	tmpl := cmd.String("secrets-key-template")
 
 	if provider == defaultProvider && !cmd.Bool("dev") {
 		return nil, errors.New("in-memory secrets provider allowed only with --dev flag")
@@ -115,12 +282,18 @@ func NewManager(ctx context.Context, cmd *cli.Command) (Manager, error) {
 	switch provider {
 	case awsOption:
 		p, err = newAWSProvider(ctx, cmd)
+	case awsSecretsManagerOption:
+		p, err = newAWSSecretsManagerProvider(ctx, cmd)
 	case fileOption:
 		p, err = newFileProvider(ctx)
 	case inMemoryOption:
 		p, err = newInMemoryProvider()
+	case kubernetesOption:
+		p, err = newKubernetesProvider(cmd)
+	case sqlOption:
+		p, err = newSQLProvider(ctx, cmd)
 	case vaultOption:
-		p, err = newVaultProvider(cmd)
+		p, err = newVaultProvider(ctx, cmd)
 	default:
 		return nil, fmt.Errorf("unrecognized secrets provider: %s", provider)
 	}
@@ -128,27 +301,111 @@ func NewManager(ctx context.Context, cmd *cli.Command) (Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &genericWrapper{provider: p, namespace: ns}, nil
+
+	p = withChunking(p, maxValueSize(provider, cmd.Int("secrets-max-value-size")))
+	p, err = withEncryptionFlags(cmd, withVersions(p))
+	if err != nil {
+		return nil, err
+	}
+
+	p, err = withCacheFlags(ctx, cmd, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &genericWrapper{provider: p, namespace: ns, keyTemplate: tmpl}, nil
 }
 
 // NewTestManager should be used only in unit tests.
 func NewTestManager() Manager {
 	p, _ := newInMemoryProvider()
-	return &genericWrapper{provider: p, namespace: "test"}
+	return &genericWrapper{provider: withVersions(p), namespace: "test"}
 }
 
 func (m *genericWrapper) Set(ctx context.Context, key, value string) error {
-	return m.provider.Set(ctx, m.namespaced(key), value)
+	return m.provider.Set(ctx, m.namespaced(ctx, key), value)
 }
 
 func (m *genericWrapper) Get(ctx context.Context, key string) (string, error) {
-	return m.provider.Get(ctx, m.namespaced(key))
+	return m.provider.Get(ctx, m.namespaced(ctx, key))
 }
 
 func (m *genericWrapper) Delete(ctx context.Context, key string) error {
-	return m.provider.Delete(ctx, m.namespaced(key))
+	return m.provider.Delete(ctx, m.namespaced(ctx, key))
+}
+
+// List returns all the keys in the request's namespace which start with the given
+// prefix. The returned keys are relative to the namespace, just like the input keys
+// of all the other functions. The provider must implement the [Lister] interface.
+func (m *genericWrapper) List(ctx context.Context, prefix string) ([]string, error) {
+	l, ok := m.provider.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+
+	keys, err := l.List(ctx, m.namespaced(ctx, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	ns := m.namespaced(ctx, "")
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, ns)
+	}
+	return keys, nil
 }
 
-func (m *genericWrapper) namespaced(key string) string {
-	return fmt.Sprintf("thrippy/%s/%s", m.namespace, key)
+// History returns the metadata of all the retained versions of the given key,
+// sorted from oldest to newest. The provider must implement the [Versioner]
+// interface, natively or by emulation (see [NewManager]).
+func (m *genericWrapper) History(ctx context.Context, key string) ([]Version, error) {
+	v, ok := m.provider.(Versioner)
+	if !ok {
+		return nil, ErrVersionsNotSupported
+	}
+	return v.History(ctx, m.namespaced(ctx, key))
+}
+
+// GetVersion returns a specific version of the given key. The provider must
+// implement the [Versioner] interface, natively or by emulation (see [NewManager]).
+func (m *genericWrapper) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	v, ok := m.provider.(Versioner)
+	if !ok {
+		return "", ErrVersionsNotSupported
+	}
+	return v.GetVersion(ctx, m.namespaced(ctx, key), version)
+}
+
+// Probe checks that the secrets provider of the given [Manager] is reachable and
+// usable, by reading a key which doesn't need to exist, bypassing the cache.
+func Probe(ctx context.Context, m Manager) error {
+	w, ok := m.(*genericWrapper)
+	if !ok {
+		_, err := m.Get(ctx, probeKey)
+		return err
+	}
+
+	p := w.provider
+	if c, ok := p.(*cachedProvider); ok {
+		p = c.provider
+	}
+
+	_, err := p.Get(ctx, w.namespaced(ctx, probeKey))
+	return err
+}
+
+// namespaced returns the storage key of the given key, based on the manager's
+// key template, and the request's namespace (or the manager's default one).
+func (m *genericWrapper) namespaced(ctx context.Context, key string) string {
+	ns, ok := NamespaceFromContext(ctx)
+	if !ok {
+		ns = m.namespace
+	}
+
+	t := m.keyTemplate
+	if t == "" {
+		t = defaultKeyTemplate
+	}
+
+	return strings.NewReplacer("{namespace}", ns, "{key}", key).Replace(t)
 }
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenericWrapperNamespaces(t *testing.T) {
+	p := &inMemoryProvider{store: map[string]string{}}
+	m := &genericWrapper{provider: p, namespace: "default", keyTemplate: "apps/{namespace}/thrippy/{key}"}
+
+	if err := m.Set(t.Context(), "id/creds", "val1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	ctx := WithNamespace(t.Context(), "team-a")
+	if err := m.Set(ctx, "id/creds", "val2"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	want := map[string]string{
+		"apps/default/thrippy/id/creds": "val1",
+		"apps/team-a/thrippy/id/creds":  "val2",
+	}
+	if !reflect.DeepEqual(p.store, want) {
+		t.Errorf("store = %v, want %v", p.store, want)
+	}
+
+	if v, err := m.Get(ctx, "id/creds"); err != nil || v != "val2" {
+		t.Errorf("Get() = %q, %v, want %q", v, err, "val2")
+	}
+
+	keys, err := m.List(ctx, "id/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{"id/creds"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	if err := m.Delete(ctx, "id/creds"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if v, err := m.Get(t.Context(), "id/creds"); err != nil || v != "val1" {
+		t.Errorf("Get(default namespace) = %q, %v, want %q", v, err, "val1")
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	tests := []struct {
+		ns      string
+		wantErr bool
+	}{
+		{ns: "default"},
+		{ns: "team-a"},
+		{ns: "1"},
+		{ns: "", wantErr: true},
+		{ns: "Team", wantErr: true},
+		{ns: "-team", wantErr: true},
+		{ns: "team-", wantErr: true},
+		{ns: "a/b", wantErr: true},
+		{ns: "a.b", wantErr: true},
+		{ns: "a_b", wantErr: true},
+		{ns: "..", wantErr: true},
+		{ns: "0123456789012345678901234567890123456789012345678901234567890123", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ns, func(t *testing.T) {
+			if err := ValidateNamespace(tt.ns); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateKeyTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		t       string
+		wantErr bool
+	}{
+		{name: "default", t: defaultKeyTemplate},
+		{name: "namespace_first", t: "{namespace}/thrippy/{key}"},
+		{name: "nested", t: "apps/{namespace}/thrippy/{key}"},
+		{name: "empty", wantErr: true},
+		{name: "missing_namespace", t: "thrippy/{key}", wantErr: true},
+		{name: "missing_key", t: "thrippy/{namespace}", wantErr: true},
+		{name: "key_not_last", t: "thrippy/{key}/{namespace}", wantErr: true},
+		{name: "duplicate_namespace", t: "{namespace}/{namespace}/{key}", wantErr: true},
+		{name: "namespace_not_segment", t: "thrippy-{namespace}/{key}", wantErr: true},
+		{name: "leading_slash", t: "/thrippy/{namespace}/{key}", wantErr: true},
+		{name: "empty_segment", t: "thrippy//{namespace}/{key}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateKeyTemplate(tt.t); (err != nil) != tt.wantErr {
+				t.Errorf("validateKeyTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package secrets
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -12,6 +16,8 @@ const (
 type inMemoryProvider struct {
 	store map[string]string
 	mu    sync.RWMutex
+
+	maxValueSize int // Artificial limit, for unit tests.
 }
 
 func newInMemoryProvider() (Manager, error) { //nolint:unparam // Special case compared to other providers.
@@ -19,6 +25,10 @@ func newInMemoryProvider() (Manager, error) { //nolint:unparam // Special case c
 }
 
 func (p *inMemoryProvider) Set(_ context.Context, key, value string) error {
+	if p.maxValueSize > 0 && len(value) > p.maxValueSize {
+		return fmt.Errorf("value too large: %d > %d bytes", len(value), p.maxValueSize)
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -26,6 +36,31 @@ func (p *inMemoryProvider) Set(_ context.Context, key, value string) error {
 	return nil
 }
 
+func (p *inMemoryProvider) updateKeys(_ context.Context, keys []string, f func(map[string]string) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	values := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v, ok := p.store[k]; ok {
+			values[k] = v
+		}
+	}
+
+	if err := f(values); err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		if p.maxValueSize > 0 && len(v) > p.maxValueSize {
+			return fmt.Errorf("value too large: %d > %d bytes", len(v), p.maxValueSize)
+		}
+	}
+
+	maps.Copy(p.store, values)
+	return nil
+}
+
 func (p *inMemoryProvider) Get(_ context.Context, key string) (string, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -44,3 +79,18 @@ func (p *inMemoryProvider) Delete(_ context.Context, key string) error {
 	delete(p.store, key)
 	return nil
 }
+
+func (p *inMemoryProvider) List(_ context.Context, prefix string) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var keys []string
+	for k := range p.store {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
@@ -0,0 +1,322 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // PostgreSQL driver ("pgx").
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver ("sqlite").
+
+	"github.com/tzrikka/xdg"
+)
+
+const (
+	sqlOption = "sql"
+
+	sqliteDriver   = "sqlite"
+	postgresDriver = "postgres"
+	pgxDriver      = "pgx" // The name of the PostgreSQL driver in [database/sql].
+
+	sqliteFileName = "secrets.db"
+)
+
+// SQLFlags defines global (but hidden) CLI flags. The purpose of these
+// CLI flags is to initialize the SQL database provider via environment
+// variables and/or the application's configuration file.
+func SQLFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "secrets-sql-driver",
+			Value: sqliteDriver,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_SQL_DRIVER"),
+				toml.TOML("secrets.sql.driver", configFilePath),
+			),
+			Hidden: true,
+			Validator: func(v string) error {
+				if v != sqliteDriver && v != postgresDriver {
+					return errors.New("unrecognized option")
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "secrets-sql-dsn",
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_SQL_DSN"),
+				toml.TOML("secrets.sql.dsn", configFilePath),
+			),
+			Hidden: true,
+		},
+	}
+}
+
+// sqlMigrations is the ordered list of schema changes. Each entry is applied
+// exactly once per database, in a transaction, and recorded in a version table.
+// Never modify or remove existing entries, only append new ones.
+var sqlMigrations = []string{
+	`CREATE TABLE thrippy_secrets (
+		name       TEXT NOT NULL PRIMARY KEY,
+		value      TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+}
+
+// sqlProvider stores secrets in a relational database: SQLite for single-node
+// deployments, or PostgreSQL for high availability. Values are stored as-is,
+// so [newSQLProvider] requires envelope encryption (see [EncryptionFlags]),
+// which encrypts each row with its own data key, except in dev mode.
+type sqlProvider struct {
+	db     *sql.DB
+	driver string
+}
+
+func newSQLProvider(ctx context.Context, cmd *cli.Command) (Manager, error) {
+	driver := cmd.String("secrets-sql-driver")
+	dsn := cmd.String("secrets-sql-dsn")
+
+	switch driver {
+	case sqliteDriver:
+		if dsn == "" {
+			path, err := sqliteFile()
+			if err != nil {
+				return nil, err
+			}
+			dsn = "file:" + path
+		}
+		dsn = sqliteDSN(dsn)
+	case postgresDriver:
+		driver = pgxDriver
+		if dsn == "" {
+			return nil, errors.New("missing PostgreSQL DSN")
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized SQL driver: %s", driver)
+	}
+
+	if cmd.String("secrets-kek") == "" && cmd.String("secrets-kek-file") == "" && !cmd.Bool("dev") {
+		return nil, errors.New("SQL secrets provider allowed without a KEK only with --dev flag")
+	}
+
+	return openSQLProvider(ctx, driver, dsn)
+}
+
+func openSQLProvider(ctx context.Context, driver, dsn string) (*sqlProvider, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == sqliteDriver {
+		db.SetMaxOpenConns(1) // SQLite supports only a single writer anyway.
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to connect to SQL database: %w", err)
+	}
+
+	if err := migrateSQL(ctx, db, driver); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate SQL database schema: %w", err)
+	}
+
+	return &sqlProvider{db: db, driver: driver}, nil
+}
+
+// sqliteFile returns the path to the default SQLite database
+// file. It also creates an empty file if it doesn't already exist.
+func sqliteFile() (string, error) {
+	path, _ := xdg.FindDataFile(DataDirName, sqliteFileName)
+	if path != "" {
+		return path, nil
+	}
+
+	return xdg.CreateFile(xdg.DataHome, DataDirName, sqliteFileName)
+}
+
+// sqliteDSN adds default pragmas to the given SQLite DSN, to support concurrent
+// access by multiple connections. It also makes transactions take the database's
+// write lock when they begin, rather than when they first write, so concurrent
+// read-modify-write transactions are serialized instead of failing to upgrade.
+func sqliteDSN(dsn string) string {
+	var params []string
+	if !strings.Contains(dsn, "_pragma=") {
+		params = append(params, "_pragma=busy_timeout(5000)", "_pragma=journal_mode(WAL)")
+	}
+	if !strings.Contains(dsn, "_txlock=") {
+		params = append(params, "_txlock=immediate")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// migrateSQL applies all the pending entries in [sqlMigrations]. Each entry is
+// applied in its own transaction, which holds an exclusive lock and re-checks that
+// the entry is still pending, so multiple replicas can start at the same time.
+func migrateSQL(ctx context.Context, db *sql.DB, driver string) error {
+	for i, stmt := range sqlMigrations {
+		applied, err := applySQLMigration(ctx, db, driver, i+1, stmt)
+		if err != nil {
+			return fmt.Errorf("version %d: %w", i+1, err)
+		}
+		if applied {
+			slog.Info("applied SQL schema migration", slog.Int("version", i+1))
+		}
+	}
+
+	return nil
+}
+
+func applySQLMigration(ctx context.Context, db *sql.DB, driver string, version int, stmt string) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() //nolint:errcheck // No-op after a successful commit.
+
+	if err := lockSQL(ctx, tx, driver, "thrippy_schema_migrations"); err != nil {
+		return false, err
+	}
+
+	const create = "CREATE TABLE IF NOT EXISTS thrippy_schema_migrations (version INTEGER NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL)"
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return false, err
+	}
+
+	var n int
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM thrippy_schema_migrations WHERE version = $1", version)
+	if err := row.Scan(&n); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return false, err
+	}
+
+	const insert = "INSERT INTO thrippy_schema_migrations (version, applied_at) VALUES ($1, $2)"
+	if _, err := tx.ExecContext(ctx, insert, version, time.Now().UTC()); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// lockSQL holds an exclusive lock on the given name until the end of the given
+// transaction. In PostgreSQL this is a transaction-level advisory lock. In SQLite,
+// transactions take the database's write lock as soon as they begin (see [sqliteDSN]).
+func lockSQL(ctx context.Context, tx *sql.Tx, driver, name string) error {
+	if driver != pgxDriver {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", name)
+	return err
+}
+
+const sqlUpsert = `INSERT INTO thrippy_secrets (name, value, created_at, updated_at) VALUES ($1, $2, $3, $3)
+	ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`
+
+func (p *sqlProvider) Set(ctx context.Context, key, value string) error {
+	_, err := p.db.ExecContext(ctx, sqlUpsert, key, value, time.Now().UTC())
+	return err
+}
+
+func (p *sqlProvider) updateKeys(ctx context.Context, keys []string, f func(map[string]string) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // No-op after a successful commit.
+
+	// Lock the keys in a consistent order, to avoid deadlocks.
+	keys = slices.Sorted(slices.Values(keys))
+	values := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if err := lockSQL(ctx, tx, p.driver, k); err != nil {
+			return err
+		}
+
+		var v string
+		err := tx.QueryRowContext(ctx, "SELECT value FROM thrippy_secrets WHERE name = $1", k).Scan(&v)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			values[k] = v
+		}
+	}
+
+	if err := f(values); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for k, v := range values {
+		if _, err := tx.ExecContext(ctx, sqlUpsert, k, v, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *sqlProvider) Get(ctx context.Context, key string) (string, error) {
+	var v string
+	err := p.db.QueryRowContext(ctx, "SELECT value FROM thrippy_secrets WHERE name = $1", key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, err
+}
+
+func (p *sqlProvider) Delete(ctx context.Context, key string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM thrippy_secrets WHERE name = $1", key)
+	return err
+}
+
+func (p *sqlProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	const query = `SELECT name FROM thrippy_secrets WHERE name LIKE $1 ESCAPE '\' ORDER BY name`
+	rows, err := p.db.QueryContext(ctx, query, escapeLike(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// escapeLike escapes the special characters of SQL LIKE patterns.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,237 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli/v3"
+)
+
+func TestSQLProvider(t *testing.T) {
+	dsn := sqliteDSN("file:" + filepath.Join(t.TempDir(), sqliteFileName))
+	p, err := openSQLProvider(t.Context(), sqliteDriver, dsn)
+	if err != nil {
+		t.Fatalf("openSQLProvider() error = %v", err)
+	}
+	defer p.db.Close()
+
+	m := &genericWrapper{provider: p, namespace: "test"}
+
+	v1, err := m.Get(t.Context(), "id/field")
+	if err != nil {
+		t.Errorf("sqlProvider.Get(missing key) error = %v", err)
+	}
+	if v1 != "" {
+		t.Errorf("sqlProvider.Get(missing key) = %q, want %q", v1, "")
+	}
+
+	v2 := "val1"
+	if err := m.Set(t.Context(), "id/field", v2); err != nil {
+		t.Errorf("sqlProvider.Set() error = %v", err)
+	}
+
+	v2 = "val2"
+	if err := m.Set(t.Context(), "id/field", v2); err != nil {
+		t.Errorf("sqlProvider.Set() error = %v", err)
+	}
+
+	v1, err = m.Get(t.Context(), "id/field")
+	if err != nil {
+		t.Errorf("sqlProvider.Get() error = %v", err)
+	}
+	if v1 != v2 {
+		t.Errorf("sqlProvider.Get() = %q, want %q", v1, v2)
+	}
+
+	_ = m.Set(t.Context(), "id_2/field", "val3") // "_" is a special character in SQL LIKE patterns.
+	keys, err := m.List(t.Context(), "id/")
+	if err != nil {
+		t.Errorf("sqlProvider.List() error = %v", err)
+	}
+	if want := []string{"id/field"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("sqlProvider.List() = %v, want %v", keys, want)
+	}
+
+	if err := m.Delete(t.Context(), "id/field"); err != nil {
+		t.Errorf("sqlProvider.Delete() error = %v", err)
+	}
+
+	v1, err = m.Get(t.Context(), "id/field")
+	if err != nil {
+		t.Errorf("sqlProvider.Get(missing key) error = %v", err)
+	}
+	if v1 != "" {
+		t.Errorf("sqlProvider.Get(missing key) = %q, want %q", v1, "")
+	}
+
+	if err := m.Delete(t.Context(), "id/field"); err != nil {
+		t.Errorf("sqlProvider.Delete(missing key) error = %v", err)
+	}
+}
+
+func TestSQLProviderVersions(t *testing.T) {
+	dsn := sqliteDSN("file:" + filepath.Join(t.TempDir(), sqliteFileName))
+	p, err := openSQLProvider(t.Context(), sqliteDriver, dsn)
+	if err != nil {
+		t.Fatalf("openSQLProvider() error = %v", err)
+	}
+	defer p.db.Close()
+
+	m := &genericWrapper{provider: withVersions(p), namespace: "test"}
+
+	var wg sync.WaitGroup
+	for i := range maxEmulatedVersions {
+		wg.Go(func() {
+			if err := m.Set(t.Context(), "id/creds", fmt.Sprintf("val%d", i)); err != nil {
+				t.Errorf("Set() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	h, err := m.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History() error = %v", err)
+	}
+	if len(h) != maxEmulatedVersions || h[len(h)-1].Number != maxEmulatedVersions {
+		t.Errorf("History() = %v, want versions 1 to %d", h, maxEmulatedVersions)
+	}
+}
+
+func TestSQLProviderEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFileName)
+	newManager := func(args ...string) (Manager, error) {
+		var m Manager
+		flags := append(ManagerFlags(altsrc.StringSourcer("")), EncryptionFlags(altsrc.StringSourcer(""))...)
+		flags = append(flags, CacheFlags(altsrc.StringSourcer(""))...)
+		cmd := &cli.Command{
+			Flags: append(flags, SQLFlags(altsrc.StringSourcer(""))...),
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				var err error
+				m, err = NewManager(ctx, cmd)
+				return err
+			},
+		}
+		args = append([]string{"test", "--secrets-provider", sqlOption, "--secrets-sql-dsn", "file:" + path}, args...)
+		return m, cmd.Run(t.Context(), args)
+	}
+
+	if _, err := newManager(); err == nil {
+		t.Fatal("NewManager(without KEK) error = nil")
+	}
+
+	m, err := newManager("--secrets-kek", testKEK1)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if err := m.Set(t.Context(), "id/creds", "plaintext"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	db, err := sql.Open(sqliteDriver, "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var raw string
+	if err := db.QueryRowContext(t.Context(), "SELECT value FROM thrippy_secrets WHERE name = $1", "thrippy/default/id/creds").Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw == "" || strings.Contains(raw, "plaintext") {
+		t.Errorf("stored value = %q, want encrypted", raw)
+	}
+
+	got, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if got != "plaintext" {
+		t.Errorf("Get() = %q, want %q", got, "plaintext")
+	}
+}
+
+func TestSQLMigrations(t *testing.T) {
+	dsn := sqliteDSN("file:" + filepath.Join(t.TempDir(), sqliteFileName))
+	for range 2 { // Re-opening the same database must be idempotent.
+		p, err := openSQLProvider(t.Context(), sqliteDriver, dsn)
+		if err != nil {
+			t.Fatalf("openSQLProvider() error = %v", err)
+		}
+
+		var version int
+		row := p.db.QueryRowContext(t.Context(), "SELECT MAX(version) FROM thrippy_schema_migrations")
+		if err := row.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(sqlMigrations) {
+			t.Errorf("schema version = %d, want %d", version, len(sqlMigrations))
+		}
+
+		_ = p.db.Close()
+	}
+}
+
+func TestSQLMigrationsConcurrent(t *testing.T) {
+	dsn := sqliteDSN("file:" + filepath.Join(t.TempDir(), sqliteFileName))
+	errs := make(chan error, 5)
+	for range cap(errs) { // Like replicas that start at the same time.
+		go func() {
+			p, err := openSQLProvider(t.Context(), sqliteDriver, dsn)
+			if err == nil {
+				_ = p.db.Close()
+			}
+			errs <- err
+		}()
+	}
+
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Errorf("openSQLProvider() error = %v", err)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "file",
+			dsn:  "file:/tmp/a.db",
+			want: "file:/tmp/a.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate",
+		},
+		{
+			name: "file_with_params",
+			dsn:  "file:/tmp/a.db?mode=rw",
+			want: "file:/tmp/a.db?mode=rw&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate",
+		},
+		{
+			name: "custom_pragmas",
+			dsn:  "file:/tmp/a.db?_pragma=foreign_keys(1)",
+			want: "file:/tmp/a.db?_pragma=foreign_keys(1)&_txlock=immediate",
+		},
+		{
+			name: "custom_pragmas_and_txlock",
+			dsn:  "file:/tmp/a.db?_pragma=foreign_keys(1)&_txlock=exclusive",
+			want: "file:/tmp/a.db?_pragma=foreign_keys(1)&_txlock=exclusive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqliteDSN(tt.dsn); got != tt.want {
+				t.Errorf("sqliteDSN() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,12 @@ package secrets
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	vault "github.com/hashicorp/vault/api"
 	altsrc "github.com/urfave/cli-altsrc/v3"
@@ -13,6 +18,16 @@ import (
 
 const (
 	vaultOption = "vault"
+
+	vaultDefaultMount = "secret"
+
+	vaultTokenAuth      = "token"
+	vaultAppRoleAuth    = "approle"
+	vaultKubernetesAuth = "kubernetes"
+
+	vaultK8sTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" //gosec:disable G101 // Not a credential.
+
+	vaultReloginDelay = 10 * time.Second
 )
 
 // VaultFlags defines global (but hidden) CLI flags. The purpose of
@@ -39,21 +54,128 @@ func VaultFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			TakesFile: true,
 		},
 		&cli.StringFlag{
-			Name: "secrets-vault-token",
+			Name: "secrets-vault-namespace", // Vault Enterprise only.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar(vault.EnvVaultNamespace),
+				toml.TOML("secrets.vault.namespace", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name:  "secrets-vault-mount",
+			Value: vaultDefaultMount,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_MOUNT"),
+				toml.TOML("secrets.vault.mount", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.IntFlag{
+			Name:  "secrets-vault-kv-version",
+			Value: 2,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_KV_VERSION"),
+				toml.TOML("secrets.vault.kv_version", configFilePath),
+			),
+			Hidden: true,
+			Validator: func(v int) error {
+				if v != 1 && v != 2 {
+					return errors.New("must be 1 or 2")
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:  "secrets-vault-auth-method",
+			Value: vaultTokenAuth,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_AUTH_METHOD"),
+				toml.TOML("secrets.vault.auth_method", configFilePath),
+			),
+			Hidden: true,
+			Validator: func(v string) error {
+				if v != vaultTokenAuth && v != vaultAppRoleAuth && v != vaultKubernetesAuth {
+					return errors.New("unrecognized option")
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "secrets-vault-auth-mount", // Default = auth method name.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_AUTH_MOUNT"),
+				toml.TOML("secrets.vault.auth_mount", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "secrets-vault-token", // Token auth method.
 			Sources: cli.NewValueSourceChain(
 				cli.EnvVar(vault.EnvVaultToken),
 				toml.TOML("secrets.vault.token", configFilePath),
 			),
 			Hidden: true,
 		},
+		&cli.StringFlag{
+			Name: "secrets-vault-role-id", // AppRole auth method.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_ROLE_ID"),
+				toml.TOML("secrets.vault.role_id", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "secrets-vault-secret-id", // AppRole auth method.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_SECRET_ID"),
+				toml.TOML("secrets.vault.secret_id", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "secrets-vault-k8s-role", // Kubernetes auth method.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_K8S_ROLE"),
+				toml.TOML("secrets.vault.k8s_role", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name:  "secrets-vault-k8s-token-file", // Kubernetes auth method.
+			Value: vaultK8sTokenFile,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_SECRETS_VAULT_K8S_TOKEN_FILE"),
+				toml.TOML("secrets.vault.k8s_token_file", configFilePath),
+			),
+			Hidden:    true,
+			TakesFile: true,
+		},
 	}
 }
 
 type vaultProvider struct {
-	client *vault.KVv2
+	client    *vault.Client
+	mount     string
+	kvVersion int
+	auth      vaultAuth
+}
+
+// vaultAuth contains the details of a Vault auth method,
+// in order to log in again when the Vault token expires.
+type vaultAuth struct {
+	method string
+	mount  string
+
+	token string // Token auth method.
+
+	roleID   string // AppRole auth method.
+	secretID string // AppRole auth method.
+
+	k8sRole      string // Kubernetes auth method.
+	k8sTokenFile string // Kubernetes auth method.
 }
 
-func newVaultProvider(cmd *cli.Command) (Manager, error) {
+func newVaultProvider(ctx context.Context, cmd *cli.Command) (Manager, error) {
 	cfg := vault.DefaultConfig()
 	cfg.Address = cmd.String("secrets-vault-address")
 
@@ -69,22 +191,191 @@ func newVaultProvider(cmd *cli.Command) (Manager, error) {
 		return nil, err
 	}
 
-	client.SetToken(cmd.String("secrets-vault-token"))
+	if ns := cmd.String("secrets-vault-namespace"); ns != "" {
+		client.SetNamespace(ns)
+	}
+
+	auth := vaultAuth{
+		method:       cmd.String("secrets-vault-auth-method"),
+		mount:        cmd.String("secrets-vault-auth-mount"),
+		token:        cmd.String("secrets-vault-token"),
+		roleID:       cmd.String("secrets-vault-role-id"),
+		secretID:     cmd.String("secrets-vault-secret-id"),
+		k8sRole:      cmd.String("secrets-vault-k8s-role"),
+		k8sTokenFile: cmd.String("secrets-vault-k8s-token-file"),
+	}
+	if auth.mount == "" {
+		auth.mount = auth.method
+	}
+
+	p := &vaultProvider{
+		client:    client,
+		mount:     strings.Trim(cmd.String("secrets-vault-mount"), "/"),
+		kvVersion: cmd.Int("secrets-vault-kv-version"),
+		auth:      auth,
+	}
+
+	secret, err := p.login(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("vault login error: %w", err)
+	}
+
+	go p.watchToken(ctx, secret)
+
+	if p.kvVersion == 2 {
+		return &vaultKVv2Provider{vaultProvider: p}, nil
+	}
+	return p, nil
+}
+
+// login authenticates with Vault, sets the client's
+// token, and returns the auth secret for renewals.
+func (p *vaultProvider) login(ctx context.Context) (*vault.Secret, error) {
+	var data map[string]any
+	switch p.auth.method {
+	case vaultTokenAuth:
+		p.client.SetToken(p.auth.token)
+		// Renewing a static token is the only way to get its lease details.
+		// If this fails, the token is simply not renewable, which is fine.
+		secret, err := p.client.Auth().Token().RenewSelfWithContext(ctx, 0)
+		if err != nil {
+			slog.Debug("Vault token is not renewable", slog.Any("error", err))
+			return nil, nil
+		}
+		return secret, nil
+
+	case vaultAppRoleAuth:
+		if p.auth.roleID == "" || p.auth.secretID == "" {
+			return nil, errors.New("missing AppRole role ID or secret ID")
+		}
+		data = map[string]any{"role_id": p.auth.roleID, "secret_id": p.auth.secretID}
+
+	case vaultKubernetesAuth:
+		if p.auth.k8sRole == "" {
+			return nil, errors.New("missing Kubernetes role")
+		}
+		// Read the service account token every time, because it's rotated by Kubernetes.
+		jwt, err := os.ReadFile(p.auth.k8sTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kubernetes service account token: %w", err)
+		}
+		data = map[string]any{"role": p.auth.k8sRole, "jwt": strings.TrimSpace(string(jwt))}
+
+	default:
+		return nil, fmt.Errorf("unrecognized auth method: %s", p.auth.method)
+	}
+
+	secret, err := p.client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", p.auth.mount), data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("no auth info in login response")
+	}
 
-	return &vaultProvider{client: client.KVv2("secret")}, nil
+	p.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// watchToken renews the Vault token in the background, as long as it's renewable.
+// When it expires (e.g. because it reached its max TTL), this function logs in
+// again to get a new token, unless the auth method is a static token.
+func (p *vaultProvider) watchToken(ctx context.Context, secret *vault.Secret) {
+	for {
+		if secret == nil || secret.Auth == nil || secret.Auth.LeaseDuration == 0 {
+			slog.Debug("Vault token renewal is not needed or not possible")
+			return
+		}
+
+		var d time.Duration
+		if secret.Auth.Renewable {
+			if err := p.renew(ctx, secret); err != nil {
+				slog.Warn("Vault token renewal stopped", slog.Any("error", err))
+			}
+		} else {
+			// Non-renewable token: log in again shortly before it expires.
+			d = time.Duration(secret.Auth.LeaseDuration) * time.Second * 4 / 5
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if p.auth.method == vaultTokenAuth {
+			slog.Error("Vault token can no longer be renewed, and there is no auth method to replace it")
+			return
+		}
+
+		secret = p.relogin(ctx, d)
+	}
+}
+
+// renew runs a Vault lifetime watcher until the given token can no
+// longer be renewed (e.g. it reached its max TTL), or the context is canceled.
+func (p *vaultProvider) renew(ctx context.Context, secret *vault.Secret) error {
+	w, err := p.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+
+	go w.Start()
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-w.DoneCh():
+			return err
+		case r := <-w.RenewCh():
+			slog.Debug("renewed Vault token", slog.Time("renewed_at", r.RenewedAt))
+		}
+	}
+}
+
+// relogin waits for the given duration, and then logs in until it succeeds,
+// with a delay between failed attempts. It returns nil if the context is canceled.
+func (p *vaultProvider) relogin(ctx context.Context, d time.Duration) *vault.Secret {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d):
+		}
+
+		secret, err := p.login(ctx)
+		if err == nil {
+			slog.Info("logged in to Vault again", slog.String("auth_method", p.auth.method))
+			return secret
+		}
+
+		slog.Error("Vault login error", slog.Any("error", err))
+		d = vaultReloginDelay
+	}
 }
 
 // Set value size limit is 0.5 or 1 MiB, according to this link:
 // https://developer.hashicorp.com/vault/docs/internals/limits.
 func (p *vaultProvider) Set(ctx context.Context, key, value string) error {
-	_, err := p.client.Put(ctx, key, map[string]any{"value": value})
+	data := map[string]any{"value": value}
+	if p.kvVersion == 1 {
+		return p.client.KVv1(p.mount).Put(ctx, key, data)
+	}
+
+	_, err := p.client.KVv2(p.mount).Put(ctx, key, data)
 	return err
 }
 
 func (p *vaultProvider) Get(ctx context.Context, key string) (string, error) {
-	sec, err := p.client.Get(ctx, key)
+	var sec *vault.KVSecret
+	var err error
+	if p.kvVersion == 1 {
+		sec, err = p.client.KVv1(p.mount).Get(ctx, key)
+	} else {
+		sec, err = p.client.KVv2(p.mount).Get(ctx, key)
+	}
+
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "secret not found: at ") {
+		if errors.Is(err, vault.ErrSecretNotFound) {
 			err = nil
 		}
 		return "", err
@@ -97,5 +388,113 @@ func (p *vaultProvider) Get(ctx context.Context, key string) (string, error) {
 }
 
 func (p *vaultProvider) Delete(ctx context.Context, key string) error {
-	return p.client.DeleteMetadata(ctx, key)
+	if p.kvVersion == 1 {
+		return p.client.KVv1(p.mount).Delete(ctx, key)
+	}
+	return p.client.KVv2(p.mount).DeleteMetadata(ctx, key)
+}
+
+// List returns all the keys which start with the given prefix. Vault lists only
+// the direct children of a path, so this walks the subtree of the prefix's parent
+// path, and descends only into sub-paths which may contain matching keys.
+func (p *vaultProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i+1]
+	}
+
+	keys, err := p.listDir(ctx, dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// listDir returns all the keys in the given directory and its
+// sub-directories, recursively, which start with the given prefix.
+func (p *vaultProvider) listDir(ctx context.Context, dir, prefix string) ([]string, error) {
+	path := p.mount + "/" + dir
+	if p.kvVersion == 2 {
+		path = p.mount + "/metadata/" + dir
+	}
+
+	sec, err := p.client.Logical().ListWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if sec == nil {
+		return nil, nil // Empty or nonexistent directory.
+	}
+
+	names, _ := sec.Data["keys"].([]any)
+	var keys []string
+	for _, n := range names {
+		name, ok := n.(string)
+		if !ok || strings.Trim(name, "/") == "" {
+			continue // Also avoid infinite recursion.
+		}
+
+		k := dir + name
+		if !strings.HasSuffix(k, "/") {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(k, prefix) && !strings.HasPrefix(prefix, k) {
+			continue
+		}
+		sub, err := p.listDir(ctx, k, prefix)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sub...)
+	}
+
+	return keys, nil
+}
+
+// vaultKVv2Provider exposes the native version history of the
+// KV v2 secrets engine, which is not available in KV v1.
+type vaultKVv2Provider struct {
+	*vaultProvider
+}
+
+func (p *vaultKVv2Provider) History(ctx context.Context, key string) ([]Version, error) {
+	vs, err := p.client.KVv2(p.mount).GetVersionsAsList(ctx, key)
+	if err != nil {
+		if errors.Is(err, vault.ErrSecretNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	h := make([]Version, 0, len(vs))
+	for _, v := range vs {
+		h = append(h, Version{Number: v.Version, CreatedAt: v.CreatedTime, Deleted: v.Destroyed || !v.DeletionTime.IsZero()})
+	}
+	return h, nil
+}
+
+func (p *vaultKVv2Provider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	sec, err := p.client.KVv2(p.mount).GetVersion(ctx, key, version)
+	if err != nil {
+		if errors.Is(err, vault.ErrSecretNotFound) {
+			err = ErrVersionNotFound
+		}
+		return "", err
+	}
+
+	// Soft-deleted and destroyed versions have no data.
+	if sec.Data == nil {
+		return "", ErrVersionNotFound
+	}
+	data, ok := sec.Data["value"].(string)
+	if !ok {
+		return "", errors.New("invalid data")
+	}
+	return data, nil
 }
@@ -0,0 +1,264 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli/v3"
+)
+
+// fakeVault is a minimal stand-in for a Vault server, which supports AppRole
+// logins, listing, and the KV v1 ("kv1" mount) and KV v2 ("kv2" mount) secrets engines.
+// Each path in the store has a list of versions, but KV v1 keeps only one.
+type fakeVault struct {
+	t     *testing.T
+	mu    sync.Mutex
+	store map[string][]map[string]any
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if got := r.Header.Get("X-Vault-Namespace"); got != "ns1/" && got != "ns1" {
+		v.t.Errorf("namespace header = %q, want %q", got, "ns1")
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if path == "auth/my-approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "token", "lease_duration": 0}}`))
+		return
+	}
+
+	if got := r.Header.Get("X-Vault-Token"); got != "token" {
+		v.t.Errorf("token header = %q, want %q", got, "token")
+	}
+
+	if r.Method == http.MethodGet && r.URL.Query().Get("list") == "true" {
+		v.list(w, strings.Replace(path, "kv2/metadata/", "kv2/", 1))
+		return
+	}
+
+	if strings.HasPrefix(path, "kv2/") {
+		v.serveKVv2(w, r, path)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.store[path] = []map[string]any{body}
+	case http.MethodGet:
+		vs, ok := v.store[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": vs[0]})
+	case http.MethodDelete:
+		delete(v.store, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list returns the direct children of the given directory, with
+// a "/" suffix for sub-directories, like Vault's LIST operation.
+func (v *fakeVault) list(w http.ResponseWriter, dir string) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	seen := map[string]bool{}
+	keys := []string{}
+	for k := range v.store {
+		name, ok := strings.CutPrefix(k, dir)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i+1]
+		}
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"keys": keys}})
+}
+
+func (v *fakeVault) serveKVv2(w http.ResponseWriter, r *http.Request, path string) {
+	// KV v2 uses different path prefixes for different operations.
+	metadata := strings.HasPrefix(path, "kv2/metadata/")
+	path = strings.Replace(path, "kv2/data/", "kv2/", 1)
+	path = strings.Replace(path, "kv2/metadata/", "kv2/", 1)
+	vs := v.store[path]
+
+	versionMetadata := func(n int) map[string]any {
+		return map[string]any{"version": n, "created_time": "2025-01-02T03:04:05Z", "deletion_time": "", "destroyed": false}
+	}
+
+	switch {
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		data, _ := body["data"].(map[string]any)
+		v.store[path] = append(vs, data)
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": versionMetadata(len(vs) + 1)})
+
+	case r.Method == http.MethodGet && metadata:
+		if len(vs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		versions := map[string]any{}
+		for i := range vs {
+			versions[strconv.Itoa(i+1)] = versionMetadata(i + 1)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"versions": versions}})
+
+	case r.Method == http.MethodGet:
+		n := len(vs)
+		if q := r.URL.Query().Get("version"); q != "" {
+			n, _ = strconv.Atoi(q)
+		}
+		if n < 1 || n > len(vs) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": vs[n-1], "metadata": versionMetadata(n)}})
+
+	case r.Method == http.MethodDelete && metadata:
+		delete(v.store, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		mount     string
+		kvVersion string
+	}{
+		{
+			name:      "kv_v1",
+			mount:     "kv1",
+			kvVersion: "1",
+		},
+		{
+			name:      "kv_v2",
+			mount:     "/kv2/",
+			kvVersion: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := &fakeVault{t: t, store: map[string][]map[string]any{}}
+			s := httptest.NewServer(fv)
+			defer s.Close()
+
+			var p Manager
+			cmd := &cli.Command{
+				Flags: VaultFlags(altsrc.StringSourcer("")),
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					var err error
+					p, err = newVaultProvider(ctx, cmd)
+					return err
+				},
+			}
+			err := cmd.Run(t.Context(), []string{
+				"test", "--secrets-vault-address", s.URL, "--secrets-vault-namespace", "ns1",
+				"--secrets-vault-mount", tt.mount, "--secrets-vault-kv-version", tt.kvVersion,
+				"--secrets-vault-auth-method", "approle", "--secrets-vault-auth-mount", "my-approle",
+				"--secrets-vault-role-id", "role", "--secrets-vault-secret-id", "secret",
+			})
+			if err != nil {
+				t.Fatalf("newVaultProvider() error = %v", err)
+			}
+
+			m := &genericWrapper{provider: withVersions(p), namespace: "test"}
+
+			v1, err := m.Get(t.Context(), "id/creds")
+			if err != nil {
+				t.Errorf("vaultProvider.Get(missing key) error = %v", err)
+			}
+			if v1 != "" {
+				t.Errorf("vaultProvider.Get(missing key) = %q, want %q", v1, "")
+			}
+
+			if err := m.Set(t.Context(), "id/creds", "val"); err != nil {
+				t.Errorf("vaultProvider.Set() error = %v", err)
+			}
+			if _, ok := fv.store[strings.Trim(tt.mount, "/")+"/thrippy/test/id/creds"]; !ok {
+				t.Errorf("vaultProvider.Set() did not use the mount %q: %v", tt.mount, fv.store)
+			}
+
+			v1, err = m.Get(t.Context(), "id/creds")
+			if err != nil {
+				t.Errorf("vaultProvider.Get() error = %v", err)
+			}
+			if v1 != "val" {
+				t.Errorf("vaultProvider.Get() = %q, want %q", v1, "val")
+			}
+
+			// Native versions in KV v2, emulated versions in KV v1.
+			if err := m.Set(t.Context(), "id/creds", "val2"); err != nil {
+				t.Errorf("vaultProvider.Set() error = %v", err)
+			}
+			h, err := m.History(t.Context(), "id/creds")
+			if err != nil {
+				t.Errorf("vaultProvider.History() error = %v", err)
+			}
+			if len(h) != 2 || h[0].Number != 1 || h[1].Number != 2 {
+				t.Errorf("vaultProvider.History() = %v, want versions 1 and 2", h)
+			}
+			v1, err = m.GetVersion(t.Context(), "id/creds", 1)
+			if err != nil {
+				t.Errorf("vaultProvider.GetVersion() error = %v", err)
+			}
+			if v1 != "val" {
+				t.Errorf("vaultProvider.GetVersion() = %q, want %q", v1, "val")
+			}
+			if _, err := m.GetVersion(t.Context(), "id/creds", 3); !errors.Is(err, ErrVersionNotFound) {
+				t.Errorf("vaultProvider.GetVersion(missing version) error = %v, want %v", err, ErrVersionNotFound)
+			}
+
+			for _, prefix := range []string{"", "id/", "id/cr"} {
+				keys, err := m.List(t.Context(), prefix)
+				if err != nil {
+					t.Errorf("vaultProvider.List(%q) error = %v", prefix, err)
+				}
+				if len(keys) != 1 || keys[0] != "id/creds" {
+					t.Errorf("vaultProvider.List(%q) = %v, want [id/creds]", prefix, keys)
+				}
+			}
+			if keys, err := m.List(t.Context(), "other/"); err != nil || len(keys) > 0 {
+				t.Errorf("vaultProvider.List(other/) = %v, %v, want none", keys, err)
+			}
+
+			if err := m.Delete(t.Context(), "id/creds"); err != nil {
+				t.Errorf("vaultProvider.Delete() error = %v", err)
+			}
+			if len(fv.store) > 0 {
+				t.Errorf("vaultProvider.Delete() left data: %v", fv.store)
+			}
+		})
+	}
+}
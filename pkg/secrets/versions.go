@@ -0,0 +1,331 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// versionedSuffix identifies the only keys whose versions are emulated: link
+	// credentials, which are set by users and may need to be rolled back.
+	versionedSuffix = "/creds"
+	// historySuffix is appended to keys to store their emulated version history.
+	historySuffix = ".history"
+	// maxEmulatedVersions is the same as the default in Vault KV v2.
+	maxEmulatedVersions = 10
+)
+
+// Versioner is an optional interface for [Manager] implementations
+// that retain previous values of each key, not just the latest one.
+type Versioner interface {
+	// History returns the metadata of all the retained versions of the
+	// given key, sorted from oldest to newest (i.e. the current one).
+	History(ctx context.Context, key string) ([]Version, error)
+	// GetVersion returns a specific version of the given key,
+	// or [ErrVersionNotFound] if it doesn't exist anymore.
+	GetVersion(ctx context.Context, key string, version int) (string, error)
+}
+
+// Version is the metadata of a single version of a secret.
+type Version struct {
+	Number    int
+	CreatedAt time.Time // Zero if unknown.
+	Deleted   bool      // Soft-deleted or destroyed in Vault KV v2.
+}
+
+var (
+	// ErrVersionsNotSupported is returned when accessing the version
+	// history with a provider that doesn't implement [Versioner].
+	ErrVersionsNotSupported = errors.New("secrets provider does not support versions")
+	// ErrVersionNotFound is returned when accessing a version
+	// of a secret that doesn't exist, or was already pruned.
+	ErrVersionNotFound = errors.New("secret version not found")
+)
+
+// Rollback restores a previous version of the given key, by setting it as a new
+// version, so the rollback itself can also be rolled back. The manager must
+// implement the [Versioner] interface (managers returned by [NewManager] do).
+func Rollback(ctx context.Context, m Manager, key string, version int) error {
+	v, ok := m.(Versioner)
+	if !ok {
+		return ErrVersionsNotSupported
+	}
+
+	value, err := v.GetVersion(ctx, key, version)
+	if err != nil {
+		return err
+	}
+
+	return m.Set(ctx, key, value)
+}
+
+type skipVersionKey struct{}
+
+// WithoutNewVersion returns a copy of the given context in which [Manager.Set]
+// replaces the current value of a key without recording it as a new version,
+// in providers which emulate the version history. This is meant for automatic
+// updates (e.g. OAuth token refreshes), which would otherwise push out the
+// versions set by users. Native version histories record all updates anyway.
+func WithoutNewVersion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipVersionKey{}, true)
+}
+
+func skipVersion(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipVersionKey{}).(bool)
+	return skip
+}
+
+// keysUpdater is an optional interface for providers which can read and update
+// multiple keys atomically, without interleaving with other writers (in this
+// process or in other ones). Only [emulatedVersionsProvider] depends on it.
+type keysUpdater interface {
+	// updateKeys calls f with the current values of the given keys (missing
+	// keys are omitted), and then sets all the values that f leaves in the map.
+	updateKeys(ctx context.Context, keys []string, f func(map[string]string) error) error
+}
+
+// withVersions wraps the given provider with [emulatedVersionsProvider],
+// unless the provider already implements the [Versioner] interface natively.
+func withVersions(p Manager) Manager {
+	if _, ok := p.(Versioner); ok {
+		return p
+	}
+	return &emulatedVersionsProvider{provider: p}
+}
+
+// emulatedVersionsProvider retains the last few versions of each credentials key
+// (see [versionedSuffix]) in a sidecar key of the underlying provider, as a JSON
+// list. Other keys are passed through as-is. Values in the history are stored
+// exactly as they are passed to the provider, so if envelope encryption is
+// enabled they remain encrypted. Sidecar keys are hidden from listings.
+//
+// Keys which were set before the emulation was enabled start with a
+// single (current) version, whose creation time is unknown. Keys which
+// were set with [WithoutNewVersion] may be newer than their last version.
+//
+// Updates of a key and its history are atomic if the underlying provider
+// implements [keysUpdater]. Otherwise, they are serialized only within
+// this process, so concurrent updates by other replicas may lose versions.
+type emulatedVersionsProvider struct {
+	provider Manager
+	mu       sync.Mutex // Used only if the provider doesn't implement [keysUpdater].
+}
+
+type emulatedVersion struct {
+	Number    int       `json:"version"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Value     string    `json:"value"`
+}
+
+func (p *emulatedVersionsProvider) Set(ctx context.Context, key, value string) error {
+	if !strings.HasSuffix(key, versionedSuffix) || skipVersion(ctx) {
+		return p.provider.Set(ctx, key, value)
+	}
+
+	return p.update(ctx, key, func(values map[string]string) error {
+		vs, err := parseHistory(values[key+historySuffix], values[key])
+		if err != nil {
+			return err
+		}
+
+		n := 1
+		if len(vs) > 0 {
+			n = vs[len(vs)-1].Number + 1
+		}
+		vs = append(vs, emulatedVersion{Number: n, CreatedAt: time.Now().UTC(), Value: value})
+		if len(vs) > maxEmulatedVersions {
+			vs = vs[len(vs)-maxEmulatedVersions:]
+		}
+
+		j, err := json.Marshal(vs)
+		if err != nil {
+			return err
+		}
+
+		values[key+historySuffix] = string(j)
+		values[key] = value
+		return nil
+	})
+}
+
+// update applies the given function to the current values of the given
+// key and its history, and then writes both of them back atomically (see
+// [keysUpdater]), or under an in-process lock if that isn't supported.
+func (p *emulatedVersionsProvider) update(ctx context.Context, key string, f func(map[string]string) error) error {
+	keys := []string{key, key + historySuffix}
+	if u, ok := p.provider.(keysUpdater); ok {
+		return u.updateKeys(ctx, keys, f)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	values := make(map[string]string, len(keys))
+	for _, k := range keys {
+		v, err := p.provider.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			values[k] = v
+		}
+	}
+
+	if err := f(values); err != nil {
+		return err
+	}
+
+	// Write the history first: if the second write fails,
+	// the history still reflects the caller's intent.
+	if h, ok := values[keys[1]]; ok {
+		if err := p.provider.Set(ctx, keys[1], h); err != nil {
+			return fmt.Errorf("failed to update version history: %w", err)
+		}
+	}
+	if v, ok := values[key]; ok {
+		return p.provider.Set(ctx, key, v)
+	}
+	return nil
+}
+
+// rewrite applies the given function to the current value and to all the retained
+// versions of the given key, in place, without recording a new version. This is
+// used to re-encrypt them with a new KEK (see [ReEncrypt]).
+func (p *emulatedVersionsProvider) rewrite(ctx context.Context, key string, f func(key, value string) (string, error)) error {
+	return p.update(ctx, key, func(values map[string]string) error {
+		if v, ok := values[key]; ok {
+			v, err := f(key, v)
+			if err != nil {
+				return err
+			}
+			values[key] = v
+		}
+
+		j, ok := values[key+historySuffix]
+		if !ok {
+			return nil
+		}
+
+		vs, err := parseHistory(j, "")
+		if err != nil {
+			return err
+		}
+		for i := range vs {
+			if vs[i].Value, err = f(key, vs[i].Value); err != nil {
+				return fmt.Errorf("version %d: %w", vs[i].Number, err)
+			}
+		}
+
+		b, err := json.Marshal(vs)
+		if err != nil {
+			return err
+		}
+
+		values[key+historySuffix] = string(b)
+		return nil
+	})
+}
+
+func (p *emulatedVersionsProvider) Get(ctx context.Context, key string) (string, error) {
+	return p.provider.Get(ctx, key)
+}
+
+// Delete removes the key along with all its versions, just like
+// deleting a parameter in AWS SSM, or a secret's metadata in Vault.
+func (p *emulatedVersionsProvider) Delete(ctx context.Context, key string) error {
+	if err := p.provider.Delete(ctx, key); err != nil || !strings.HasSuffix(key, versionedSuffix) {
+		return err
+	}
+	return p.provider.Delete(ctx, key+historySuffix)
+}
+
+func (p *emulatedVersionsProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	l, ok := p.provider.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+
+	keys, err := l.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := keys[:0]
+	for _, k := range keys {
+		if !strings.HasSuffix(k, historySuffix) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered, nil
+}
+
+func (p *emulatedVersionsProvider) History(ctx context.Context, key string) ([]Version, error) {
+	vs, err := p.history(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	h := make([]Version, 0, len(vs))
+	for _, v := range vs {
+		h = append(h, Version{Number: v.Number, CreatedAt: v.CreatedAt})
+	}
+	return h, nil
+}
+
+func (p *emulatedVersionsProvider) GetVersion(ctx context.Context, key string, version int) (string, error) {
+	vs, err := p.history(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range vs {
+		if v.Number == version {
+			return v.Value, nil
+		}
+	}
+	return "", ErrVersionNotFound
+}
+
+// history returns the stored version history of the given key, or a
+// single version with the key's current value if there is no history.
+func (p *emulatedVersionsProvider) history(ctx context.Context, key string) ([]emulatedVersion, error) {
+	if !strings.HasSuffix(key, versionedSuffix) {
+		return nil, ErrVersionsNotSupported
+	}
+
+	j, err := p.provider.Get(ctx, key+historySuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	v := ""
+	if j == "" {
+		if v, err = p.provider.Get(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseHistory(j, v)
+}
+
+// parseHistory parses the stored version history of a key, or returns a single
+// version with the key's current value if there is no history. Both may be empty.
+func parseHistory(j, current string) ([]emulatedVersion, error) {
+	if j != "" {
+		var vs []emulatedVersion
+		if err := json.Unmarshal([]byte(j), &vs); err != nil {
+			return nil, fmt.Errorf("invalid version history: %w", err)
+		}
+		return vs, nil
+	}
+
+	if current == "" {
+		return nil, nil
+	}
+	return []emulatedVersion{{Number: 1, Value: current}}, nil
+}
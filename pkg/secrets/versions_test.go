@@ -0,0 +1,238 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEmulatedVersions(t *testing.T) {
+	m := NewTestManager()
+	v, ok := m.(Versioner)
+	if !ok {
+		t.Fatal("NewTestManager() does not implement Versioner")
+	}
+
+	h, err := v.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History(missing key) error = %v", err)
+	}
+	if len(h) > 0 {
+		t.Errorf("History(missing key) = %v, want empty", h)
+	}
+
+	for i := range maxEmulatedVersions + 2 {
+		if err := m.Set(t.Context(), "id/creds", fmt.Sprintf("val%d", i+1)); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	// Only the last few versions are retained.
+	h, err = v.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History() error = %v", err)
+	}
+	if len(h) != maxEmulatedVersions {
+		t.Fatalf("len(History()) = %d, want %d", len(h), maxEmulatedVersions)
+	}
+	if h[0].Number != 3 || h[len(h)-1].Number != maxEmulatedVersions+2 {
+		t.Errorf("History() = %v, want versions 3 to %d", h, maxEmulatedVersions+2)
+	}
+	if h[0].CreatedAt.IsZero() {
+		t.Errorf("History()[0].CreatedAt is zero")
+	}
+
+	if _, err := v.GetVersion(t.Context(), "id/creds", 2); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("GetVersion(pruned version) error = %v, want %v", err, ErrVersionNotFound)
+	}
+
+	// Rollbacks create a new version.
+	if err := Rollback(t.Context(), m, "id/creds", 5); err != nil {
+		t.Errorf("Rollback() error = %v", err)
+	}
+	got, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if got != "val5" {
+		t.Errorf("Get() after Rollback() = %q, want %q", got, "val5")
+	}
+	got, err = v.GetVersion(t.Context(), "id/creds", maxEmulatedVersions+3)
+	if err != nil {
+		t.Errorf("GetVersion() error = %v", err)
+	}
+	if got != "val5" {
+		t.Errorf("GetVersion() after Rollback() = %q, want %q", got, "val5")
+	}
+
+	// History keys are hidden, and deleted along with their keys.
+	keys, err := m.(Lister).List(t.Context(), "")
+	if err != nil {
+		t.Errorf("List() error = %v", err)
+	}
+	if want := []string{"id/creds"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	if err := m.Delete(t.Context(), "id/creds"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	h, err = v.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History(deleted key) error = %v", err)
+	}
+	if len(h) > 0 {
+		t.Errorf("History(deleted key) = %v, want empty", h)
+	}
+}
+
+func TestEmulatedVersionsScope(t *testing.T) {
+	p, _ := newInMemoryProvider()
+	m := &genericWrapper{provider: withVersions(p), namespace: "test"}
+
+	// Only credentials are versioned.
+	for _, v := range []string{"val1", "val2"} {
+		if err := m.Set(t.Context(), "id/meta", v); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if h, err := m.History(t.Context(), "id/meta"); !errors.Is(err, ErrVersionsNotSupported) {
+		t.Errorf("History(id/meta) = %v, %v, want %v", h, err, ErrVersionsNotSupported)
+	}
+	if raw, _ := p.Get(t.Context(), "thrippy/test/id/meta"+historySuffix); raw != "" {
+		t.Errorf("history of id/meta = %q, want none", raw)
+	}
+
+	// Automatic updates don't push out previous versions.
+	if err := m.Set(t.Context(), "id/creds", "user"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := m.Set(WithoutNewVersion(t.Context()), "id/creds", "auto"); err != nil {
+		t.Fatalf("Set(WithoutNewVersion) error = %v", err)
+	}
+
+	got, err := m.Get(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if got != "auto" {
+		t.Errorf("Get() = %q, want %q", got, "auto")
+	}
+	h, err := m.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History() error = %v", err)
+	}
+	if len(h) != 1 {
+		t.Errorf("History() = %v, want a single version", h)
+	}
+}
+
+func TestEmulatedVersionsConcurrentSets(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider func() Manager
+	}{
+		{
+			name: "atomic_updates",
+			provider: func() Manager {
+				p, _ := newInMemoryProvider()
+				return p
+			},
+		},
+		{
+			name: "in_process_lock",
+			provider: func() Manager {
+				p, _ := newInMemoryProvider()
+				return struct{ Manager }{p} // Hide the keysUpdater interface.
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &genericWrapper{provider: withVersions(tt.provider()), namespace: "test"}
+
+			var wg sync.WaitGroup
+			for i := range maxEmulatedVersions {
+				wg.Go(func() {
+					if err := m.Set(t.Context(), "id/creds", fmt.Sprintf("val%d", i)); err != nil {
+						t.Errorf("Set() error = %v", err)
+					}
+				})
+			}
+			wg.Wait()
+
+			h, err := m.History(t.Context(), "id/creds")
+			if err != nil {
+				t.Errorf("History() error = %v", err)
+			}
+			if len(h) != maxEmulatedVersions || h[len(h)-1].Number != maxEmulatedVersions {
+				t.Errorf("History() = %v, want versions 1 to %d", h, maxEmulatedVersions)
+			}
+		})
+	}
+}
+
+func TestEmulatedVersionsExistingKey(t *testing.T) {
+	p, _ := newInMemoryProvider()
+	if err := p.Set(t.Context(), "thrippy/test/id/creds", "old"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	m := &genericWrapper{provider: withVersions(p), namespace: "test"}
+	if err := m.Set(t.Context(), "id/creds", "new"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	h, err := m.History(t.Context(), "id/creds")
+	if err != nil {
+		t.Errorf("History() error = %v", err)
+	}
+	if len(h) != 2 || !h[0].CreatedAt.IsZero() || h[1].CreatedAt.IsZero() {
+		t.Errorf("History() = %v, want an old version with unknown time and a new one", h)
+	}
+
+	got, err := m.GetVersion(t.Context(), "id/creds", 1)
+	if err != nil {
+		t.Errorf("GetVersion() error = %v", err)
+	}
+	if got != "old" {
+		t.Errorf("GetVersion() = %q, want %q", got, "old")
+	}
+}
+
+func TestEmulatedVersionsEncryption(t *testing.T) {
+	kw, err := NewLocalKeyWrapper(testKEK1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := newInMemoryProvider()
+	m := WithEncryption(&genericWrapper{provider: withVersions(p), namespace: "test"}, kw)
+	if err := m.Set(t.Context(), "id/creds", "val1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := m.Set(t.Context(), "id/creds", "val2"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Previous versions remain encrypted at rest.
+	raw, err := p.Get(t.Context(), "thrippy/test/id/creds"+historySuffix)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if raw == "" || strings.Contains(raw, "val1") || strings.Contains(raw, "val2") {
+		t.Errorf("history at rest = %q, want encrypted values", raw)
+	}
+
+	got, err := m.(Versioner).GetVersion(t.Context(), "id/creds", 1)
+	if err != nil {
+		t.Errorf("GetVersion() error = %v", err)
+	}
+	if got != "val1" {
+		t.Errorf("GetVersion() = %q, want %q", got, "val1")
+	}
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	altsrc "github.com/urfave/cli-altsrc/v3"
+	"github.com/urfave/cli-altsrc/v3/toml"
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/internal/logger"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+// APINamespaceHeader is the HTTP equivalent of the gRPC metadata key
+// [client.NamespaceMetadataKey], in requests to the REST/JSON API.
+//
+// [client.NamespaceMetadataKey]: https://pkg.go.dev/github.com/tzrikka/thrippy/pkg/client#NamespaceMetadataKey
+const APINamespaceHeader = "Thrippy-Namespace"
+
+// APIFlags defines global (but hidden) CLI flags. The purpose of these
+// CLI flags is to configure the authentication of the REST/JSON API
+// via environment variables and/or the application's configuration file.
+func APIFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "api-tokens", // See [parseAPITokens].
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_API_TOKENS"),
+				toml.TOML("api.tokens", configFilePath),
+			),
+			Hidden: true,
+		},
+	}
+}
+
+// apiServer is a REST/JSON gateway to the [Thrippy service], for clients which can't
+// use gRPC easily. It runs on a separate port from the public OAuth webhooks, and
+// authenticates callers with bearer tokens. Caller identities are subject to the
+// same namespace ACL as gRPC callers, and requests are handled by the same code.
+//
+// [Thrippy service]: https://github.com/tzrikka/thrippy-api/blob/main/proto/thrippy/v1/thrippy.proto
+type apiServer struct {
+	grpc *grpcServer
+
+	tokens           map[string]string // SHA-256 digest (hex) of each token -> caller identity.
+	acl              namespaceACL
+	defaultNamespace string
+}
+
+func newAPIServer(cmd *cli.Command, sm secrets.Manager) (*apiServer, error) {
+	tokens, err := parseAPITokens(cmd.String("api-tokens"))
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := parseNamespaceACL(cmd.String("grpc-namespace-acl"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiServer{
+		grpc:             &grpcServer{sm: sm},
+		tokens:           tokens,
+		acl:              acl,
+		defaultNamespace: secrets.DefaultNamespace(sm),
+	}, nil
+}
+
+// parseAPITokens parses semicolon-separated "<identity>=<SHA-256 digest>" entries.
+// Only digests of tokens are configured, not the tokens themselves, for example:
+// "ci.example.com=$(echo -n "$TOKEN" | sha256sum | cut -d' ' -f1)".
+func parseAPITokens(s string) (map[string]string, error) {
+	tokens := map[string]string{}
+	for entry := range strings.SplitSeq(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, digest, ok := strings.Cut(entry, "=")
+		id, digest = strings.TrimSpace(id), strings.ToLower(strings.TrimSpace(digest))
+		if !ok || id == "" || id == anyone {
+			return nil, fmt.Errorf("invalid API token entry %q, expecting \"identity=sha256\"", entry)
+		}
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 digest of API token for %q", id)
+		}
+		if _, ok := tokens[digest]; ok {
+			return nil, fmt.Errorf("duplicate API token digest for %q", id)
+		}
+
+		tokens[digest] = id
+	}
+	return tokens, nil
+}
+
+// startAPIServer starts the REST/JSON API server, if it's enabled with the "api-port"
+// flag. This is non-blocking, in order to let Thrippy run the other servers as well.
+// It uses the same TLS server cert and key as the gRPC server, except in dev mode.
+// It returns a function that stops the server gracefully (see [shutdownHTTP]).
+func startAPIServer(ctx context.Context, cmd *cli.Command, sm secrets.Manager) (func(), error) {
+	port := cmd.Int("api-port")
+	if port == 0 {
+		return func() {}, nil
+	}
+
+	s, err := newAPIServer(cmd, sm)
+	if err != nil {
+		slog.Error("invalid REST API configuration", slog.Any("error", err))
+		return nil, err
+	}
+	if len(s.tokens) == 0 {
+		slog.Warn("REST API enabled without any API tokens")
+	}
+
+	server := &http.Server{
+		Handler:      s.handler(),
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout * 2, // Some handlers call third-party services.
+	}
+
+	if !cmd.Bool("dev") {
+		certPath := cmd.String("grpc-server-cert")
+		keyPath := cmd.String("grpc-server-key")
+		if certPath == "" || keyPath == "" {
+			return nil, errors.New("REST API requires a TLS server cert and key, except in dev mode")
+		}
+
+		r, err := newCertReloader(certPath, keyPath, "")
+		if err != nil {
+			slog.Error("invalid REST API TLS configuration", slog.Any("error", err))
+			return nil, err
+		}
+		go r.watch(ctx)
+		server.TLSConfig = r.serverConfig()
+	}
+
+	lc := net.ListenConfig{}
+	lis, err := lc.Listen(ctx, "tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		slog.Error("failed to listen on REST API port", slog.Any("error", err), slog.Int("port", port))
+		return nil, err
+	}
+
+	go func() {
+		if server.TLSConfig == nil {
+			err = server.Serve(lis)
+		} else {
+			err = server.ServeTLS(lis, "", "")
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.FatalError(ctx, "REST API serving error", err)
+		}
+	}()
+
+	slog.Info("REST API server listening on " + lis.Addr().String())
+	return func() { _ = shutdownHTTP(server, "REST API server", shutdownTimeout(cmd)) }, nil
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/links", s.createLink)
+	mux.HandleFunc("GET /v1/links/{id}", s.getLink)
+	mux.HandleFunc("DELETE /v1/links/{id}", s.deleteLink)
+	mux.HandleFunc("GET /v1/links/{id}/credentials", s.getCredentials)
+	mux.HandleFunc("PUT /v1/links/{id}/credentials", s.setCredentials)
+	mux.HandleFunc("GET /v1/links/{id}/metadata", s.getMetadata)
+	return mux
+}
+
+func (s *apiServer) createLink(w http.ResponseWriter, r *http.Request) {
+	req := &thrippypb.CreateLinkRequest{}
+	s.handle(w, r, req, func(ctx context.Context) (proto.Message, error) {
+		return s.grpc.CreateLink(ctx, req)
+	})
+}
+
+func (s *apiServer) getLink(w http.ResponseWriter, r *http.Request) {
+	req := thrippypb.GetLinkRequest_builder{LinkId: new(r.PathValue("id"))}.Build()
+	s.handle(w, r, nil, func(ctx context.Context) (proto.Message, error) {
+		return s.grpc.GetLink(ctx, req)
+	})
+}
+
+func (s *apiServer) deleteLink(w http.ResponseWriter, r *http.Request) {
+	allowMissing, _ := strconv.ParseBool(r.URL.Query().Get("allow_missing"))
+	req := thrippypb.DeleteLinkRequest_builder{LinkId: new(r.PathValue("id")), AllowMissing: new(allowMissing)}.Build()
+	s.handle(w, r, nil, func(ctx context.Context) (proto.Message, error) {
+		return s.grpc.DeleteLink(ctx, req)
+	})
+}
+
+func (s *apiServer) getCredentials(w http.ResponseWriter, r *http.Request) {
+	req := thrippypb.GetCredentialsRequest_builder{LinkId: new(r.PathValue("id"))}.Build()
+	s.handle(w, r, nil, func(ctx context.Context) (proto.Message, error) {
+		return s.grpc.GetCredentials(ctx, req)
+	})
+}
+
+// setCredentials accepts a JSON body with either "generic_creds" or "token"
+// (see the SetCredentialsRequest message). The link ID is taken from the URL path.
+func (s *apiServer) setCredentials(w http.ResponseWriter, r *http.Request) {
+	req := &thrippypb.SetCredentialsRequest{}
+	s.handle(w, r, req, func(ctx context.Context) (proto.Message, error) {
+		req.SetLinkId(r.PathValue("id"))
+		return s.grpc.SetCredentials(ctx, req)
+	})
+}
+
+func (s *apiServer) getMetadata(w http.ResponseWriter, r *http.Request) {
+	req := thrippypb.GetMetadataRequest_builder{LinkId: new(r.PathValue("id"))}.Build()
+	s.handle(w, r, nil, func(ctx context.Context) (proto.Message, error) {
+		return s.grpc.GetMetadata(ctx, req)
+	})
+}
+
+// handle authenticates the request, parses its JSON body into the given message (if it's
+// not nil), applies the selected namespace (if the caller is authorized to use it), calls
+// the given function, and writes its result or error as a JSON response.
+func (s *apiServer) handle(w http.ResponseWriter, r *http.Request, body proto.Message, f func(context.Context) (proto.Message, error)) {
+	l := slog.With(slog.String("http_method", r.Method), slog.String("url_path", r.URL.EscapedPath()))
+	l.Info("received HTTP request")
+
+	id, ok := s.authenticate(r)
+	if !ok {
+		l.Warn("unauthenticated REST API request")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="thrippy"`)
+		writeAPIError(w, status.Error(codes.Unauthenticated, "missing or invalid API token"))
+		return
+	}
+
+	l = l.With(slog.String("caller", id))
+	ctx := logger.WithContext(r.Context(), l)
+
+	if body != nil {
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+		if err != nil {
+			l.Warn("bad request: failed to read body", slog.Any("error", err))
+			writeAPIError(w, status.Error(codes.InvalidArgument, "failed to read request body"))
+			return
+		}
+		if err := protojson.Unmarshal(b, body); err != nil {
+			l.Warn("bad request: invalid JSON body", slog.Any("error", err))
+			writeAPIError(w, status.Error(codes.InvalidArgument, "invalid JSON body"))
+			return
+		}
+	}
+
+	if nss := r.Header.Values(APINamespaceHeader); len(nss) > 0 {
+		var err error
+		if ctx, err = authorizeNamespace(ctx, s.acl, s.defaultNamespace, nss, []string{id}); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	resp, err := f(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	j, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp)
+	if err != nil {
+		l.Error("failed to convert proto into JSON", slog.Any("error", err))
+		writeAPIError(w, status.Error(codes.Internal, "response encoding error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(j)
+}
+
+// authenticate returns the caller identity which is associated with
+// the request's bearer token, or false if the token is missing or unknown.
+func (s *apiServer) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	h := sha256.Sum256([]byte(token))
+	id, ok := s.tokens[hex.EncodeToString(h[:])]
+	return id, ok
+}
+
+// writeAPIError converts a gRPC status error into an HTTP JSON response.
+func writeAPIError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	j, _ := protojson.Marshal(st.Proto())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusCode(st.Code()))
+	_, _ = w.Write(j)
+}
+
+// httpStatusCode maps gRPC status codes to HTTP status codes, so REST
+// clients can distinguish retryable failures from permanent ones.
+func httpStatusCode(c codes.Code) int {
+	switch c {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
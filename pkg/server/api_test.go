@@ -0,0 +1,225 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc/codes"
+
+	intlinks "github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/pkg/links"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+const testAPIToken = "test-token"
+
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	h := sha256.Sum256([]byte(testAPIToken))
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "api-tokens",
+			Value: "ci.example.com=" + hex.EncodeToString(h[:]),
+		},
+		&cli.StringFlag{
+			Name:  "grpc-namespace-acl",
+			Value: "ci.example.com=team-a",
+		},
+	}}
+	s, err := newAPIServer(cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func apiRequest(t *testing.T, method, url, token, ns, body string) (int, map[string]any) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if ns != "" {
+		req.Header.Set(APINamespaceHeader, ns)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("invalid JSON response: %q", b)
+	}
+	return resp.StatusCode, m
+}
+
+func TestAPIServer(t *testing.T) {
+	links.Templates["test"] = intlinks.NewTemplate("Generic link", nil, nil, nil, nil)
+	srv := newTestAPIServer(t)
+
+	code, _ := apiRequest(t, http.MethodPost, srv.URL+"/v1/links", "", "", `{"template": "test"}`)
+	if code != http.StatusUnauthorized {
+		t.Errorf("POST without token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	code, _ = apiRequest(t, http.MethodPost, srv.URL+"/v1/links", "wrong", "", `{"template": "test"}`)
+	if code != http.StatusUnauthorized {
+		t.Errorf("POST with wrong token = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	code, _ = apiRequest(t, http.MethodPost, srv.URL+"/v1/links", testAPIToken, "", `{"template": "bad"}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("POST with invalid template = %d, want %d", code, http.StatusBadRequest)
+	}
+	code, _ = apiRequest(t, http.MethodPost, srv.URL+"/v1/links", testAPIToken, "team-b", `{"template": "test"}`)
+	if code != http.StatusForbidden {
+		t.Errorf("POST with disallowed namespace = %d, want %d", code, http.StatusForbidden)
+	}
+
+	code, resp := apiRequest(t, http.MethodPost, srv.URL+"/v1/links", testAPIToken, "team-a", `{"template": "test"}`)
+	if code != http.StatusOK {
+		t.Fatalf("POST /v1/links = %d, %v", code, resp)
+	}
+	id, _ := resp["link_id"].(string)
+	u := srv.URL + "/v1/links/" + id
+
+	code, resp = apiRequest(t, http.MethodGet, u, testAPIToken, "team-a", "")
+	if code != http.StatusOK || resp["template"] != "test" {
+		t.Errorf("GET link = %d, %v", code, resp)
+	}
+	code, _ = apiRequest(t, http.MethodGet, u, testAPIToken, "", "")
+	if code != http.StatusNotFound {
+		t.Errorf("GET link in default namespace = %d, want %d", code, http.StatusNotFound)
+	}
+	code, _ = apiRequest(t, http.MethodGet, srv.URL+"/v1/links/111", testAPIToken, "team-a", "")
+	if code != http.StatusBadRequest {
+		t.Errorf("GET invalid link ID = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	code, resp = apiRequest(t, http.MethodPut, u+"/credentials", testAPIToken, "team-a", `{"generic_creds": {"aaa": "111"}}`)
+	if code != http.StatusOK {
+		t.Errorf("PUT credentials = %d, %v", code, resp)
+	}
+	code, resp = apiRequest(t, http.MethodGet, u+"/credentials", testAPIToken, "team-a", "")
+	if want := map[string]any{"credentials": map[string]any{"aaa": "111"}}; code != http.StatusOK || !reflect.DeepEqual(resp, want) {
+		t.Errorf("GET credentials = %d, %v, want %v", code, resp, want)
+	}
+	code, resp = apiRequest(t, http.MethodGet, u+"/metadata", testAPIToken, "team-a", "")
+	if code != http.StatusOK {
+		t.Errorf("GET metadata = %d, %v", code, resp)
+	}
+
+	code, _ = apiRequest(t, http.MethodDelete, u, testAPIToken, "team-a", "")
+	if code != http.StatusOK {
+		t.Errorf("DELETE link = %d, want %d", code, http.StatusOK)
+	}
+	code, _ = apiRequest(t, http.MethodDelete, u, testAPIToken, "team-a", "")
+	if code != http.StatusNotFound {
+		t.Errorf("DELETE missing link = %d, want %d", code, http.StatusNotFound)
+	}
+	code, _ = apiRequest(t, http.MethodDelete, u+"?allow_missing=true", testAPIToken, "team-a", "")
+	if code != http.StatusOK {
+		t.Errorf("DELETE missing link with allow_missing = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestParseAPITokens(t *testing.T) {
+	digest := strings.Repeat("ab", sha256.Size)
+
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]string{},
+		},
+		{
+			name: "multiple",
+			s:    " ci = " + strings.ToUpper(digest) + "; ops=" + strings.Repeat("cd", sha256.Size) + ";",
+			want: map[string]string{digest: "ci", strings.Repeat("cd", sha256.Size): "ops"},
+		},
+		{
+			name:    "missing_digest",
+			s:       "ci",
+			wantErr: true,
+		},
+		{
+			name:    "wildcard_identity",
+			s:       "*=" + digest,
+			wantErr: true,
+		},
+		{
+			name:    "invalid_digest",
+			s:       "ci=token",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate_digest",
+			s:       "ci=" + digest + "; ops=" + digest,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAPITokens(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAPITokens() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAPITokens() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.FailedPrecondition, http.StatusConflict},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.Internal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := httpStatusCode(tt.code); got != tt.want {
+				t.Errorf("httpStatusCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,18 @@ package server
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"log/slog"
-	"os"
+	"net"
 
 	altsrc "github.com/urfave/cli-altsrc/v3"
 	"github.com/urfave/cli-altsrc/v3/toml"
 	"github.com/urfave/cli/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/local"
 
 	"github.com/tzrikka/thrippy/internal/logger"
+	"github.com/tzrikka/thrippy/pkg/client"
 )
 
 // GRPCFlags defines global (but hidden) CLI flags. The purpose of
@@ -51,15 +51,48 @@ func GRPCFlags(configFilePath altsrc.StringSourcer) []cli.Flag {
 			Hidden:    true,
 			TakesFile: true,
 		},
+		&cli.StringFlag{
+			Name:  "grpc-socket-mode", // Only Unix domain sockets.
+			Value: defaultSocketMode,
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_GRPC_SOCKET_MODE"),
+				toml.TOML("grpc.server.socket_mode", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "grpc-socket-group", // Only Unix domain sockets.
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_GRPC_SOCKET_GROUP"),
+				toml.TOML("grpc.server.socket_group", configFilePath),
+			),
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name: "grpc-namespace-acl", // See [parseNamespaceACL].
+			Sources: cli.NewValueSourceChain(
+				cli.EnvVar("THRIPPY_GRPC_NAMESPACE_ACL"),
+				toml.TOML("grpc.server.namespace_acl", configFilePath),
+			),
+			Hidden: true,
+		},
 	}
 }
 
 // GRPCCreds initializes gRPC server credentials, based on CLI flags.
-// Errors here will abort the application with a log message.
+// Errors here will abort the application with a log message. TLS certs are
+// reloaded when their files change, or on SIGHUP, until the context is canceled.
 // See also [client.GRPCCreds].
 //
 // [client.GRPCCreds]: https://pkg.go.dev/github.com/tzrikka/thrippy/pkg/client#GRPCCreds
 func GRPCCreds(ctx context.Context, cmd *cli.Command) []grpc.ServerOption {
+	// Unix domain sockets don't use TLS: access to them is controlled by the socket
+	// file's permissions, and clients are authenticated by their peer credentials.
+	if _, ok := client.UnixSocketPath(cmd.String("grpc-addr")); ok {
+		slog.Info("using gRPC server with local credentials over a Unix socket")
+		return []grpc.ServerOption{grpc.Creds(&peerCredsTransport{TransportCredentials: local.NewCredentials()})}
+	}
+
 	if cmd.Bool("dev") {
 		return nil
 	}
@@ -81,42 +114,64 @@ func GRPCCreds(ctx context.Context, cmd *cli.Command) []grpc.ServerOption {
 
 	// Using mTLS requires the client's CA cert (on many Linux systems,
 	// "/etc/ssl/cert.pem" contains the system-wide set of root CAs).
-	// If it's missing, we use TLS.
-	if caPath == "" {
-		msg := "gRPC server with TLS"
-		creds, err := credentials.NewServerTLSFromFile(certPath, keyPath)
-		if err != nil {
-			logger.FatalError(ctx, "failed to create credentials for "+msg, err)
-		}
-		slog.Info("using "+msg, slog.String("cert", certPath), slog.String("key", keyPath))
-		return []grpc.ServerOption{grpc.Creds(creds)}
+	// If it's missing, we use TLS. If all 3 are specified, we use mTLS.
+	msg := "gRPC server with TLS"
+	if caPath != "" {
+		msg = "gRPC server with mTLS"
 	}
 
-	// If all 3 are specified, we use mTLS.
-	msg := "client CA cert file for gRPC server with mTLS"
-	ca := x509.NewCertPool()
-	pem, err := os.ReadFile(caPath) //gosec:disable G304 // Specified by admin by design.
+	r, err := newCertReloader(certPath, keyPath, caPath)
 	if err != nil {
-		logger.FatalError(ctx, "failed to read "+msg, err, slog.String("path", caPath))
+		logger.FatalError(ctx, "failed to create credentials for "+msg, err, slog.String("server_cert", certPath),
+			slog.String("server_key", keyPath), slog.String("client_ca_cert", caPath))
 	}
-	if ok := ca.AppendCertsFromPEM(pem); !ok {
-		logger.Fatal(ctx, "failed to parse "+msg, slog.String("path", caPath))
+
+	// Certs are reloaded when their files change, or on SIGHUP.
+	go r.watch(ctx)
+
+	slog.Info("using "+msg, slog.String("server_cert", certPath), slog.String("server_key", keyPath),
+		slog.String("client_ca_cert", caPath))
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(r.serverConfig()))}
+}
+
+// grpcClientCreds initializes the credentials of in-process gRPC clients (i.e. the
+// HTTP webhook server's), just like [client.GRPCCreds], except that their TLS certs
+// are reloaded when their files change, or on SIGHUP, until the context is canceled.
+func grpcClientCreds(ctx context.Context, cmd *cli.Command) credentials.TransportCredentials {
+	creds := client.GRPCCreds(ctx, cmd) // Also validates the CLI flags.
+	if creds.Info().SecurityProtocol != "tls" {
+		return creds // Unix domain socket, or dev mode.
 	}
 
-	msg = "gRPC server with mTLS"
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	certPath := cmd.String("grpc-client-cert")
+	keyPath := cmd.String("grpc-client-key")
+	caPath := cmd.String("grpc-server-ca-cert")
+
+	r, err := newCertReloader(certPath, keyPath, caPath)
 	if err != nil {
-		logger.FatalError(ctx, "failed to load server PEM key pair for "+msg,
-			err, slog.String("cert", certPath), slog.String("key", keyPath))
+		logger.FatalError(ctx, "failed to create credentials for gRPC client", err, slog.String("client_cert", certPath),
+			slog.String("client_key", keyPath), slog.String("server_ca_cert", caPath))
 	}
 
-	slog.Info("using "+msg, slog.String("server_cert", certPath), slog.String("server_key", keyPath),
-		slog.String("client_ca_cert", caPath))
+	// Certs are reloaded when their files change, or on SIGHUP.
+	go r.watch(ctx)
+
+	return &reloadingClientCreds{TransportCredentials: creds, r: r, serverName: cmd.String("grpc-server-name-override")}
+}
+
+// reloadingClientCreds are gRPC client credentials which use the
+// current certs of a [certReloader] in each new TLS handshake.
+type reloadingClientCreds struct {
+	credentials.TransportCredentials
+
+	r          *certReloader
+	serverName string
+}
+
+func (c *reloadingClientCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.r.clientConfig(c.serverName)).ClientHandshake(ctx, authority, conn)
+}
 
-	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(&tls.Config{
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		Certificates: []tls.Certificate{cert},
-		ClientCAs:    ca,
-		MinVersion:   tls.VersionTLS13,
-	}))}
+func (c *reloadingClientCreds) Clone() credentials.TransportCredentials {
+	return &reloadingClientCreds{TransportCredentials: c.TransportCredentials.Clone(), r: c.r, serverName: c.serverName}
 }
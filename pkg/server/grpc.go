@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"strings"
 
 	"github.com/lithammer/shortuuid/v4"
@@ -13,12 +15,15 @@ import (
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
 	intlinks "github.com/tzrikka/thrippy/internal/links"
 	"github.com/tzrikka/thrippy/internal/logger"
+	"github.com/tzrikka/thrippy/pkg/client"
 	"github.com/tzrikka/thrippy/pkg/links"
 	"github.com/tzrikka/thrippy/pkg/oauth"
 	"github.com/tzrikka/thrippy/pkg/secrets"
@@ -32,28 +37,61 @@ type grpcServer struct {
 
 // startGRPCServer starts a gRPC server for the [Thrippy service].
 // This is non-blocking, in order to let Thrippy run an HTTP server as well.
+// It returns the server's address, and a function that stops the server
+// gracefully (see [gracefulStop]).
 //
 // [Thrippy service]: https://github.com/tzrikka/thrippy-api/blob/main/proto/thrippy/v1/thrippy.proto
-func startGRPCServer(ctx context.Context, cmd *cli.Command, sm secrets.Manager) (string, error) {
-	lc := net.ListenConfig{}
+func startGRPCServer(ctx context.Context, cmd *cli.Command, sm secrets.Manager) (string, func(), error) {
+	acl, err := parseNamespaceACL(cmd.String("grpc-namespace-acl"))
+	if err != nil {
+		slog.Error("invalid gRPC namespace ACL", slog.Any("error", err))
+		return "", nil, err
+	}
+
 	addr := cmd.String("grpc-addr")
-	lis, err := lc.Listen(ctx, "tcp", addr)
+	lis, err := listen(ctx, cmd, addr)
 	if err != nil {
 		slog.Error("failed to listen on gRPC address", slog.Any("error", err), slog.String("address", addr))
-		return "", err
+		return "", nil, err
 	}
 
-	srv := grpc.NewServer(GRPCCreds(ctx, cmd)...)
+	opts := GRPCCreds(ctx, cmd)
+	opts = append(opts, grpc.UnaryInterceptor(namespaceInterceptor(acl, secrets.DefaultNamespace(sm))))
+	srv := grpc.NewServer(opts...)
 	thrippypb.RegisterThrippyServiceServer(srv, &grpcServer{sm: sm})
+	registerHealthServer(ctx, srv, sm)
+	if cmd.Bool("grpc-reflection") {
+		reflection.Register(srv)
+		slog.Warn("gRPC reflection service enabled")
+	}
 	go func() {
 		err = srv.Serve(lis)
-		if err != nil {
+		if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 			logger.FatalError(ctx, "gRPC serving error", err)
 		}
 	}()
 
-	slog.Info("gRPC server listening on " + lis.Addr().String())
-	return lis.Addr().String(), nil
+	addr = lis.Addr().String()
+	if lis.Addr().Network() == "unix" {
+		addr = "unix:" + addr
+	}
+
+	slog.Info("gRPC server listening on " + addr)
+	return addr, func() { gracefulStop(srv, shutdownTimeout(cmd)) }, nil
+}
+
+// listen supports both TCP addresses and Unix domain socket addresses (see [client.UnixSocketPath]).
+func listen(ctx context.Context, cmd *cli.Command, addr string) (net.Listener, error) {
+	if path, ok := client.UnixSocketPath(addr); ok {
+		mode := cmd.String("grpc-socket-mode")
+		if mode == "" {
+			mode = defaultSocketMode
+		}
+		return listenUnix(ctx, path, mode, cmd.String("grpc-socket-group"))
+	}
+
+	lc := net.ListenConfig{}
+	return lc.Listen(ctx, "tcp", addr)
 }
 
 func (s *grpcServer) CreateLink(ctx context.Context, in *thrippypb.CreateLinkRequest) (*thrippypb.CreateLinkResponse, error) {
@@ -75,6 +113,10 @@ func (s *grpcServer) CreateLink(ctx context.Context, in *thrippypb.CreateLinkReq
 		l.Warn("missing OAuth client ID")
 		return nil, status.Error(codes.InvalidArgument, "missing OAuth client ID")
 	}
+	if templ.ClientCredentialsGrant() && (o == nil || o.Config.Endpoint.TokenURL == "" || o.Config.ClientID == "") {
+		l.Warn("missing OAuth token URL or client ID")
+		return nil, status.Error(codes.InvalidArgument, "missing OAuth token URL or client ID")
+	}
 
 	// Save the input template.
 	if err := s.sm.Set(ctx, id+"/template", t); err != nil {
@@ -195,18 +237,13 @@ func (s *grpcServer) SetCredentials(ctx context.Context, in *thrippypb.SetCreden
 		return nil, err
 	}
 
-	// OAuth-based links: change the nonce, now that the old one was used successfully.
+	// OAuth-based links: add scopes which were requested in the OAuth flow
+	// that issued this token (see "thrippy add-scopes"), if there are any.
 	o := oauth.FromProto(oauthProto)
-	if o.IsUsable() {
-		j, err := o.ToJSON()
-		if err != nil {
-			l.Error("failed to convert OAuth proto into JSON", slog.Any("error", err))
-			return nil, status.Error(codes.Internal, "secrets manager parse error")
-		}
-
-		if err := s.sm.Set(ctx, id+"/oauth", j); err != nil {
-			l.Error("secrets manager write error", slog.Any("error", err))
-			return nil, status.Error(codes.Internal, "secrets manager write error")
+	if scopes, userScopes := addedScopes(ctx); in.GetToken() != nil && (len(scopes) > 0 || len(userScopes) > 0) {
+		if err := intlinks.AddScopesByTemplate(o, links.Templates[template], scopes, userScopes); err != nil {
+			l.Warn("invalid scopes to add", slog.Any("error", err))
+			return nil, status.Error(codes.InvalidArgument, "invalid scopes to add: "+err.Error())
 		}
 	}
 
@@ -214,11 +251,18 @@ func (s *grpcServer) SetCredentials(ctx context.Context, in *thrippypb.SetCreden
 	// For OAuth tokens: persist extra secrets if already set.
 	token := in.GetToken()
 	m := in.GetGenericCreds()
-	if strings.Contains(template, "oauth") {
+	if strings.Contains(template, "oauth") || links.Templates[template].ClientCredentialsGrant() {
 		if token == nil {
 			token = thrippypb.OAuthToken_builder{Raw: m}.Build()
 		} else {
-			token.SetRaw(s.getRaw(ctx, id))
+			token.SetRaw(mergeRaw(s.getRaw(ctx, id), token.GetRaw()))
+			// Third-party services may omit the refresh token when users reauthorize
+			// an existing link (e.g. to add scopes), but the existing one remains valid.
+			if token.GetRefreshToken() == "" {
+				if rt, ok := s.getStoredCreds(ctx, id)["refresh_token"].(string); ok && rt != "" {
+					token.SetRefreshToken(rt)
+				}
+			}
 		}
 	}
 
@@ -243,6 +287,22 @@ func (s *grpcServer) SetCredentials(ctx context.Context, in *thrippypb.SetCreden
 		return nil, status.Error(codes.Internal, "credentials check error: "+err.Error())
 	}
 
+	// Links which mint short-lived tokens: mint the first one now, and store it alongside the
+	// static credentials, so [grpcServer.GetCredentials] doesn't need to check the template.
+	if templ := links.Templates[template]; templ.MintsTokens() && token == nil {
+		t, err := templ.MintToken(ctx, m)
+		if err != nil {
+			l.Error("failed to mint access token", slog.Any("error", err))
+			return nil, status.Error(codes.Unavailable, "access token minting error")
+		}
+		if t != nil {
+			if j, err = json.Marshal(mintedCreds(t, m)); err != nil {
+				l.Error("failed to convert credentials into JSON", slog.Any("error", err))
+				return nil, status.Error(codes.Internal, "secrets manager parse error")
+			}
+		}
+	}
+
 	if err := s.sm.Set(ctx, id+"/creds", string(j)); err != nil {
 		l.Error("secrets manager write error", slog.Any("error", err))
 		return nil, status.Error(codes.Internal, "secrets manager write error")
@@ -255,9 +315,37 @@ func (s *grpcServer) SetCredentials(ctx context.Context, in *thrippypb.SetCreden
 		}
 	}
 
+	// OAuth-based links: change the nonce, now that the old one was used successfully,
+	// and save the added scopes (if any) only together with the token that grants them.
+	if o.IsUsable() {
+		j, err := o.ToJSON()
+		if err != nil {
+			l.Error("failed to convert OAuth proto into JSON", slog.Any("error", err))
+			return nil, status.Error(codes.Internal, "secrets manager parse error")
+		}
+
+		if err := s.sm.Set(ctx, id+"/oauth", j); err != nil {
+			l.Error("secrets manager write error", slog.Any("error", err))
+			return nil, status.Error(codes.Internal, "secrets manager write error")
+		}
+	}
+
 	return &thrippypb.SetCredentialsResponse{}, nil
 }
 
+// addedScopes returns the OAuth scopes to add to the configuration of a
+// link, from the metadata of an incoming gRPC request (see [client.WithAddedScopes]).
+func addedScopes(ctx context.Context) (scopes, userScopes []string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(client.ScopesMetadataKey) {
+		scopes = append(scopes, strings.Split(v, ",")...)
+	}
+	for _, v := range md.Get(client.UserScopesMetadataKey) {
+		userScopes = append(userScopes, strings.Split(v, ",")...)
+	}
+	return scopes, userScopes
+}
+
 func (s *grpcServer) templateAndOAuth(ctx context.Context, id string) (string, *thrippypb.OAuthConfig, error) {
 	l := logger.FromContext(ctx)
 
@@ -289,21 +377,26 @@ func (s *grpcServer) templateAndOAuth(ctx context.Context, id string) (string, *
 	return t, m, nil
 }
 
-// getRaw retrieves the "raw" credentials map from an OAuth token stored in the
-// secrets manager. This is used to preserve extra secrets alongside OAuth tokens.
-// If there is any error, or if there are no extra secrets, this function returns nil.
-func (s *grpcServer) getRaw(ctx context.Context, id string) map[string]string {
+// getStoredCreds retrieves the current credentials of a link from the secrets manager.
+// If there is any error, or if there are no credentials, this function returns nil.
+func (s *grpcServer) getStoredCreds(ctx context.Context, id string) map[string]any {
 	j, err := s.sm.Get(ctx, id+"/creds")
 	if err != nil {
 		return nil
 	}
 
-	var token map[string]any
-	if err := json.Unmarshal([]byte(j), &token); err != nil {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(j), &m); err != nil {
 		return nil
 	}
+	return m
+}
 
-	raw, ok := token["raw"].(map[string]any)
+// getRaw retrieves the "raw" credentials map from an OAuth token stored in the
+// secrets manager. This is used to preserve extra secrets alongside OAuth tokens.
+// If there is any error, or if there are no extra secrets, this function returns nil.
+func (s *grpcServer) getRaw(ctx context.Context, id string) map[string]string {
+	raw, ok := s.getStoredCreds(ctx, id)["raw"].(map[string]any)
 	if !ok {
 		return nil
 	}
@@ -315,6 +408,23 @@ func (s *grpcServer) getRaw(ctx context.Context, id string) map[string]string {
 	return m
 }
 
+// mergeRaw returns the extra secrets and details of a stored
+// OAuth token, overridden by those of a new token (if any).
+func mergeRaw(stored, updated map[string]string) map[string]string {
+	if len(updated) == 0 {
+		return stored
+	}
+
+	m := make(map[string]string, len(stored)+len(updated))
+	for k, v := range stored {
+		m[k] = v
+	}
+	for k, v := range updated {
+		m[k] = v
+	}
+	return m
+}
+
 func (s *grpcServer) GetCredentials(ctx context.Context, in *thrippypb.GetCredentialsRequest) (*thrippypb.GetCredentialsResponse, error) {
 	id := in.GetLinkId()
 	l := logger.FromContext(ctx).With(slog.String("grpc_handler", "GetCredentials"), slog.String("link_id", id))
@@ -325,15 +435,48 @@ func (s *grpcServer) GetCredentials(ctx context.Context, in *thrippypb.GetCreden
 		return nil, err
 	}
 
-	// Refresh OAuth token, if needed.
-	if t, ok := oauth.TokenFromMap(ma); ok && !t.Valid() {
-		if updated, err := s.refreshOAuthToken(ctx, id, t); err == nil {
-			ma = updated
+	// Fetch or refresh OAuth token, if needed. The link's template is needed only in
+	// two cases: to distinguish the client credentials grant, minting, and refreshing
+	// when a token is expired, and to fetch the first token of links which use the
+	// client credentials grant, which don't have one until the first time their
+	// credentials are requested (but they may already have extra secrets, such as a
+	// private key). Links which mint short-lived tokens from static credentials store
+	// their first token when they're set (see [grpcServer.SetCredentials]).
+	t, ok := oauth.TokenFromMap(ma)
+	switch {
+	case ok && !t.Valid():
+		switch templ := s.linkTemplate(ctx, id); {
+		case templ.ClientCredentialsGrant():
+			if ma, err = s.clientCredentialsToken(ctx, id); err != nil {
+				return nil, err
+			}
+		case templ.MintsTokens():
+			if ma, err = s.mintToken(ctx, id, templ, ma); err != nil {
+				return nil, err
+			}
+		default:
+			if updated, err := s.refreshOAuthToken(ctx, id, t); err == nil {
+				ma = updated
+			}
+		}
+	case !ok && !hasStaticCreds(ma):
+		if s.linkTemplate(ctx, id).ClientCredentialsGrant() {
+			if ma, err = s.clientCredentialsToken(ctx, id); err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	// Minted tokens replace the static credentials they're based on
+	// (other tokens are never stored alongside static credentials).
+	_, minted := oauth.TokenFromMap(ma)
+	minted = minted && hasStaticCreds(ma)
+
 	ms := make(map[string]string, len(ma))
 	for k, v := range ma {
+		if minted && !slices.Contains(mintedTokenFields, k) {
+			continue
+		}
 		if k != "raw" {
 			ms[k] = fmt.Sprintf("%v", v)
 			continue
@@ -351,6 +494,12 @@ func (s *grpcServer) GetCredentials(ctx context.Context, in *thrippypb.GetCreden
 		if ws, ok := raw["webhook_secret"].(string); ok { // Bitbucket, GitHub.
 			ms["webhook_secret"] = ws
 		}
+		if ut, ok := raw["user_access_token"].(string); ok { // Slack.
+			ms["user_access_token"] = ut
+		}
+		if wu, ok := raw["incoming_webhook_url"].(string); ok { // Slack.
+			ms["incoming_webhook_url"] = wu
+		}
 	}
 
 	return thrippypb.GetCredentialsResponse_builder{Credentials: ms}.Build(), nil
@@ -404,7 +553,101 @@ func (s *grpcServer) getSecrets(ctx context.Context, linkID, keySuffix string) (
 	return m, nil
 }
 
-func (s *grpcServer) refreshOAuthToken(ctx context.Context, id string, t *oauth2.Token) (map[string]any, error) {
+// linkTemplate returns the template of the given link, or an
+// empty one (i.e. with no special features) if there's an error.
+func (s *grpcServer) linkTemplate(ctx context.Context, id string) intlinks.Template {
+	t, err := s.sm.Get(ctx, id+"/template")
+	if err != nil {
+		return intlinks.Template{}
+	}
+	return links.Templates[t]
+}
+
+// clientCredentialsToken fetches a new OAuth token with the client credentials
+// grant, and caches it in the secrets manager until it expires.
+func (s *grpcServer) clientCredentialsToken(ctx context.Context, id string) (map[string]any, error) {
+	l := logger.FromContext(ctx)
+
+	o, err := s.oauthConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := o.ClientCredentialsToken(ctx, s.getRaw(ctx, id)[oauth.PrivateKeyCred])
+	if err != nil {
+		l.Error("failed to fetch OAuth token with client credentials", slog.Any("error", err))
+		return nil, status.Error(codes.Unavailable, "OAuth client credentials grant error")
+	}
+
+	return s.saveOAuthToken(ctx, id, m)
+}
+
+// mintedTokenFields are the only credentials which are returned for links
+// with minted tokens, so their static credentials stay on the server.
+var mintedTokenFields = []string{"access_token", "expiry", "token_type"}
+
+// hasStaticCreds reports whether the given stored credentials contain
+// fields other than those of an OAuth token and its extra secrets,
+// i.e. static credentials which a minted token may be based on.
+func hasStaticCreds(m map[string]any) bool {
+	for k := range m {
+		if k != "raw" && !slices.Contains(intlinks.OAuthCredFields, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// mintToken mints a new short-lived access token based on the given static
+// credentials, if they're configured for it, and caches it in the secrets
+// manager (alongside the static credentials) until it expires.
+func (s *grpcServer) mintToken(ctx context.Context, id string, templ intlinks.Template, ma map[string]any) (map[string]any, error) {
+	l := logger.FromContext(ctx)
+
+	creds := make(map[string]string, len(ma))
+	for k, v := range ma {
+		if !slices.Contains(intlinks.OAuthCredFields, k) {
+			creds[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	t, err := templ.MintToken(ctx, creds)
+	if err != nil {
+		l.Error("failed to mint access token", slog.Any("error", err))
+		return nil, status.Error(codes.Unavailable, "access token minting error")
+	}
+	if t == nil {
+		return ma, nil
+	}
+
+	m := mintedCreds(t, creds)
+	j, err := json.Marshal(m)
+	if err != nil {
+		l.Error("failed to convert map into JSON", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "secrets manager parse error")
+	}
+
+	// Minting is an automatic update, so it doesn't record a new credentials version.
+	if err := s.sm.Set(secrets.WithoutNewVersion(ctx), id+"/creds", string(j)); err != nil {
+		l.Error("secrets manager write error", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "secrets manager write error")
+	}
+
+	return m, nil
+}
+
+// mintedCreds returns the given minted token, alongside the static credentials it's based on.
+func mintedCreds(t *oauth2.Token, creds map[string]string) map[string]any {
+	m := oauth.TokenToMap(t)
+	delete(m, "refresh_token")
+	for k, v := range creds {
+		m[k] = v
+	}
+	return m
+}
+
+// oauthConfig retrieves the OAuth configuration of the given link from the secrets manager.
+func (s *grpcServer) oauthConfig(ctx context.Context, id string) (*oauth.Config, error) {
 	l := logger.FromContext(ctx)
 
 	jsonConfig, err := s.sm.Get(ctx, id+"/oauth")
@@ -419,17 +662,42 @@ func (s *grpcServer) refreshOAuthToken(ctx context.Context, id string, t *oauth2
 		return nil, status.Error(codes.Internal, "secrets manager parse error")
 	}
 
-	m, err := oauth.FromProto(o).RefreshToken(ctx, t, false)
+	return oauth.FromProto(o), nil
+}
+
+func (s *grpcServer) refreshOAuthToken(ctx context.Context, id string, t *oauth2.Token) (map[string]any, error) {
+	l := logger.FromContext(ctx)
+
+	o, err := s.oauthConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.linkTemplate(ctx, id).RefreshToken(ctx, o, t)
 	if err != nil {
 		l.Error("failed to refresh OAuth token", slog.Any("error", err))
 		return nil, status.Error(codes.Internal, "OAuth token refresh error")
 	}
 
-	if raw := s.getRaw(ctx, id); raw != nil {
-		rawAny := make(map[string]any, len(raw))
+	return s.saveOAuthToken(ctx, id, m)
+}
+
+// saveOAuthToken stores a new or refreshed OAuth token (as a map) in the
+// secrets manager, along with the extra secrets of the previous token.
+// Extra details of the new token (if any) override those of the previous one.
+// This is an automatic update, so it doesn't record a new credentials version.
+func (s *grpcServer) saveOAuthToken(ctx context.Context, id string, m map[string]any) (map[string]any, error) {
+	l := logger.FromContext(ctx)
+
+	newRaw, _ := m["raw"].(map[string]any)
+	if raw := s.getRaw(ctx, id); raw != nil || newRaw != nil {
+		rawAny := make(map[string]any, len(raw)+len(newRaw))
 		for k, v := range raw {
 			rawAny[k] = v
 		}
+		for k, v := range newRaw {
+			rawAny[k] = v
+		}
 		m["raw"] = rawAny
 	}
 
@@ -439,7 +707,7 @@ func (s *grpcServer) refreshOAuthToken(ctx context.Context, id string, t *oauth2
 		return nil, status.Error(codes.Internal, "secrets manager parse error")
 	}
 
-	if err := s.sm.Set(ctx, id+"/creds", string(jsonToken)); err != nil {
+	if err := s.sm.Set(secrets.WithoutNewVersion(ctx), id+"/creds", string(jsonToken)); err != nil {
 		l.Error("secrets manager write error", slog.Any("error", err))
 		return nil, status.Error(codes.Internal, "secrets manager write error")
 	}
@@ -1,17 +1,33 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/lithammer/shortuuid/v4"
 	"github.com/urfave/cli/v3"
+	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
 	intlinks "github.com/tzrikka/thrippy/internal/links"
+	"github.com/tzrikka/thrippy/pkg/client"
 	"github.com/tzrikka/thrippy/pkg/links"
+	"github.com/tzrikka/thrippy/pkg/oauth"
 	"github.com/tzrikka/thrippy/pkg/secrets"
 )
 
@@ -26,7 +42,7 @@ func TestCreateLink(t *testing.T) {
 			Value: true,
 		},
 	}}
-	addr, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -97,7 +113,7 @@ func TestDeleteLinkOAuth(t *testing.T) {
 			Value: true,
 		},
 	}}
-	addr, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,7 +206,7 @@ func TestGetLinkOAuth(t *testing.T) {
 			Value: true,
 		},
 	}}
-	addr, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -281,7 +297,7 @@ func TestGetLinkNonOAuth(t *testing.T) {
 			Value: true,
 		},
 	}}
-	addr, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -332,7 +348,7 @@ func TestSetAndGetCredentials(t *testing.T) {
 			Value: true,
 		},
 	}}
-	addr, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -417,3 +433,518 @@ func TestSetAndGetCredentials(t *testing.T) {
 		})
 	}
 }
+
+func TestSetCredentialsKeepsRefreshToken(t *testing.T) {
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := thrippypb.NewThrippyServiceClient(conn)
+	resp, err := client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template:    new("generic-oauth"),
+		OauthConfig: thrippypb.OAuthConfig_builder{ClientId: new("111")}.Build(),
+	}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	id := resp.GetLinkId()
+
+	// Initial authorization, and then a reauthorization without a new refresh token.
+	for _, rt := range []string{"refresh_token", ""} {
+		token := thrippypb.OAuthToken_builder{AccessToken: new("access_token"), Expiry: new("2100-01-01T00:00:00Z")}.Build()
+		if rt != "" {
+			token.SetRefreshToken(rt)
+		}
+		req := thrippypb.SetCredentialsRequest_builder{LinkId: new(id), Token: token}.Build()
+		if _, err := client.SetCredentials(t.Context(), req); err != nil {
+			t.Fatalf("SetCredentials() error = %v", err)
+		}
+	}
+
+	got, err := client.GetCredentials(t.Context(), thrippypb.GetCredentialsRequest_builder{LinkId: new(id)}.Build())
+	if err != nil {
+		t.Fatalf("GetCredentials() error = %v", err)
+	}
+	if rt := got.GetCredentials()["refresh_token"]; rt != "refresh_token" {
+		t.Errorf("GetCredentials() refresh token = %q, want %q", rt, "refresh_token")
+	}
+}
+
+func TestSetCredentialsAddedScopes(t *testing.T) {
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := thrippypb.NewThrippyServiceClient(conn)
+	resp, err := c.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template:    new("generic-oauth"),
+		OauthConfig: thrippypb.OAuthConfig_builder{ClientId: new("111"), Scopes: []string{"b"}}.Build(),
+	}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	id := resp.GetLinkId()
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		userScopes []string
+		wantCode   codes.Code
+		wantScopes []string
+	}{
+		{
+			name:       "invalid_user_scopes",
+			scopes:     []string{"a"},
+			userScopes: []string{"c"},
+			wantCode:   codes.InvalidArgument,
+			wantScopes: []string{"b"},
+		},
+		{
+			name:       "added_scopes",
+			scopes:     []string{"a", "b"},
+			wantScopes: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := thrippypb.OAuthToken_builder{AccessToken: new("access_token"), Expiry: new("2100-01-01T00:00:00Z")}.Build()
+			req := thrippypb.SetCredentialsRequest_builder{LinkId: new(id), Token: token}.Build()
+			ctx := client.WithAddedScopes(t.Context(), tt.scopes, tt.userScopes)
+			if _, err := c.SetCredentials(ctx, req); status.Code(err) != tt.wantCode {
+				t.Fatalf("SetCredentials() error = %v, want code %v", err, tt.wantCode)
+			}
+
+			got, err := c.GetLink(t.Context(), thrippypb.GetLinkRequest_builder{LinkId: new(id)}.Build())
+			if err != nil {
+				t.Fatalf("GetLink() error = %v", err)
+			}
+			if scopes := got.GetOauthConfig().GetScopes(); !reflect.DeepEqual(scopes, tt.wantScopes) {
+				t.Errorf("GetLink() scopes = %v, want %v", scopes, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestGetCredentialsClientCredentials(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("audience") != "https://api.example.com" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":3600}`, requests.Load())
+	}))
+	defer ts.Close()
+
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := thrippypb.NewThrippyServiceClient(conn)
+	_, err = client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template: new("generic-client-credentials"),
+	}.Build())
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("CreateLink() without a token URL error = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	resp, err := client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template: new("generic-client-credentials"),
+		OauthConfig: thrippypb.OAuthConfig_builder{
+			TokenUrl:     new(ts.URL),
+			ClientId:     new("id"),
+			ClientSecret: new("secret"),
+			Params:       map[string]string{"audience": "https://api.example.com"},
+		}.Build(),
+	}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+
+	// The first request fetches a new token, and the second one uses the cached token.
+	for range 2 {
+		got, err := client.GetCredentials(t.Context(), thrippypb.GetCredentialsRequest_builder{
+			LinkId: new(resp.GetLinkId()),
+		}.Build())
+		if err != nil {
+			t.Fatalf("GetCredentials() error = %v", err)
+		}
+		if token := got.GetCredentials()["access_token"]; token != "token1" {
+			t.Errorf("GetCredentials() access token = %q, want %q", token, "token1")
+		}
+	}
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("token endpoint requests = %d, want 1", n)
+	}
+}
+
+func TestGetCredentialsJWTBearer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		_, err := jwt.Parse(r.PostForm.Get("assertion"), func(_ *jwt.Token) (any, error) { return &key.PublicKey, nil },
+			jwt.WithIssuer("id"), jwt.WithSubject("user@example.com"), jwt.WithExpirationRequired())
+		if err != nil {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := thrippypb.NewThrippyServiceClient(conn)
+	resp, err := client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template: new("generic-client-credentials"),
+		OauthConfig: thrippypb.OAuthConfig_builder{
+			TokenUrl: new(ts.URL),
+			ClientId: new("id"),
+			Params:   map[string]string{"grant_type": "jwt-bearer", "subject": "user@example.com"},
+		}.Build(),
+	}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+
+	id := new(resp.GetLinkId())
+	_, err = client.SetCredentials(t.Context(), thrippypb.SetCredentialsRequest_builder{
+		LinkId:       id,
+		GenericCreds: map[string]string{"private_key": string(pemKey)},
+	}.Build())
+	if err != nil {
+		t.Fatalf("SetCredentials() error = %v", err)
+	}
+
+	got, err := client.GetCredentials(t.Context(), thrippypb.GetCredentialsRequest_builder{LinkId: id}.Build())
+	if err != nil {
+		t.Fatalf("GetCredentials() error = %v", err)
+	}
+	if token := got.GetCredentials()["access_token"]; token != "token" {
+		t.Errorf("GetCredentials() access token = %q, want %q", token, "token")
+	}
+	if _, found := got.GetCredentials()["private_key"]; found {
+		t.Error("GetCredentials() returned the private key")
+	}
+}
+
+func TestGetCredentialsMintedToken(t *testing.T) {
+	var mints atomic.Int32
+	links.Templates["test-minted-token"] = intlinks.NewTemplate("", nil, nil, nil, nil).WithTokenFunc(
+		func(_ context.Context, m map[string]string) (*oauth2.Token, error) {
+			if m["scopes"] == "" {
+				return nil, nil
+			}
+			mints.Add(1)
+			return &oauth2.Token{AccessToken: "token-" + m["key"], TokenType: "Bearer", ExpiresIn: 3600}, nil
+		})
+	t.Cleanup(func() { delete(links.Templates, "test-minted-token") })
+
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := thrippypb.NewThrippyServiceClient(conn)
+
+	tests := []struct {
+		name  string
+		creds map[string]string
+		want  map[string]string
+	}{
+		{
+			name:  "static_creds_only",
+			creds: map[string]string{"key": "secret"},
+			want:  map[string]string{"key": "secret"},
+		},
+		{
+			name:  "minted_token",
+			creds: map[string]string{"key": "secret", "scopes": "a,b"},
+			want:  map[string]string{"access_token": "token-secret", "token_type": "Bearer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+				Template: new("test-minted-token"),
+			}.Build())
+			if err != nil {
+				t.Fatalf("CreateLink() error = %v", err)
+			}
+			id := new(resp.GetLinkId())
+
+			_, err = client.SetCredentials(t.Context(), thrippypb.SetCredentialsRequest_builder{
+				LinkId:       id,
+				GenericCreds: tt.creds,
+			}.Build())
+			if err != nil {
+				t.Fatalf("SetCredentials() error = %v", err)
+			}
+
+			// The first request may mint a new token, and the second one uses the cached token.
+			mints.Store(0)
+			for range 2 {
+				got, err := client.GetCredentials(t.Context(), thrippypb.GetCredentialsRequest_builder{LinkId: id}.Build())
+				if err != nil {
+					t.Fatalf("GetCredentials() error = %v", err)
+				}
+
+				creds := got.GetCredentials()
+				delete(creds, "expiry")
+				if !reflect.DeepEqual(creds, tt.want) {
+					t.Errorf("GetCredentials() = %v, want %v", creds, tt.want)
+				}
+			}
+
+			if n := mints.Load(); n > 1 {
+				t.Errorf("minted tokens = %d, want at most 1", n)
+			}
+		})
+	}
+}
+
+// templateReadsManager counts the reads of link templates.
+type templateReadsManager struct {
+	secrets.Manager
+	reads atomic.Int32
+}
+
+func (m *templateReadsManager) Get(ctx context.Context, key string) (string, error) {
+	if strings.HasSuffix(key, "/template") {
+		m.reads.Add(1)
+	}
+	return m.Manager.Get(ctx, key)
+}
+
+func TestGetCredentialsTemplateReads(t *testing.T) {
+	sm := &templateReadsManager{Manager: secrets.NewTestManager()}
+	id := shortuuid.New()
+	if err := sm.Set(t.Context(), id+"/template", "generic-oauth"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &grpcServer{sm: sm}
+	req := thrippypb.GetCredentialsRequest_builder{LinkId: new(id)}.Build()
+
+	tests := []struct {
+		name      string
+		creds     string
+		wantReads int32
+	}{
+		{
+			name:      "valid_token",
+			creds:     `{"access_token":"token","expiry":"2100-01-01T00:00:00Z","raw":{"signing_secret":"secret"}}`,
+			wantReads: 0,
+		},
+		{
+			name:      "expired_token",
+			creds:     `{"access_token":"token","expiry":"2000-01-01T00:00:00Z"}`,
+			wantReads: 1,
+		},
+		{
+			name:      "static_creds",
+			creds:     `{"api_key":"key"}`,
+			wantReads: 0,
+		},
+		{
+			name:      "no_token_yet",
+			creds:     `{"raw":{"private_key":"key"}}`,
+			wantReads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sm.Set(t.Context(), id+"/creds", tt.creds); err != nil {
+				t.Fatal(err)
+			}
+
+			sm.reads.Store(0)
+			if _, err := s.GetCredentials(t.Context(), req); err != nil {
+				t.Fatalf("GetCredentials() error = %v", err)
+			}
+			if n := sm.reads.Load(); n != tt.wantReads {
+				t.Errorf("GetCredentials() template reads = %d, want %d", n, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestGetCredentialsRefreshFunc(t *testing.T) {
+	links.Templates["test-oauth-refresh"] = intlinks.NewTemplate("", nil, nil, nil, nil).WithRefreshFunc(
+		func(_ context.Context, _ *oauth.Config, ot *oauth2.Token) (*oauth2.Token, error) {
+			if ot.RefreshToken != "refresh1" {
+				return nil, fmt.Errorf("unexpected refresh token: %q", ot.RefreshToken)
+			}
+			nt := &oauth2.Token{AccessToken: "access2", RefreshToken: "refresh2", ExpiresIn: 3600}
+			return nt.WithExtra(map[string]any{"user": "user2"}), nil
+		}).WithTokenExtras(func(ot *oauth2.Token) map[string]string {
+		return map[string]string{"user_access_token": fmt.Sprintf("%v", ot.Extra("user"))}
+	})
+	t.Cleanup(func() { delete(links.Templates, "test-oauth-refresh") })
+
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	sm := secrets.NewTestManager()
+	addr, _, err := startGRPCServer(t.Context(), cmd, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := thrippypb.NewThrippyServiceClient(conn)
+	resp, err := client.CreateLink(t.Context(), thrippypb.CreateLinkRequest_builder{
+		Template: new("test-oauth-refresh"),
+		OauthConfig: thrippypb.OAuthConfig_builder{
+			TokenUrl: new("https://example.com/token"),
+			ClientId: new("id"),
+		}.Build(),
+	}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+
+	// An expired token, with extra secrets and details.
+	id := resp.GetLinkId()
+	creds := `{"access_token":"access1","expiry":"2000-01-01T00:00:00Z","refresh_token":"refresh1",` +
+		`"raw":{"signing_secret":"secret","user_access_token":"user1"}}`
+	if err := sm.Set(t.Context(), id+"/creds", creds); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetCredentials(t.Context(), thrippypb.GetCredentialsRequest_builder{LinkId: new(id)}.Build())
+	if err != nil {
+		t.Fatalf("GetCredentials() error = %v", err)
+	}
+
+	want := map[string]string{
+		"access_token":      "access2",
+		"refresh_token":     "refresh2",
+		"signing_secret":    "secret",
+		"user_access_token": "user2",
+	}
+	for k, v := range want {
+		if got.GetCredentials()[k] != v {
+			t.Errorf("GetCredentials()[%q] = %q, want %q", k, got.GetCredentials()[k], v)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+const (
+	healthProbeInterval = 15 * time.Second
+)
+
+// registerHealthServer registers the standard gRPC health checking service, whose
+// serving status (of the server as a whole, and of the Thrippy service) is derived
+// from periodic probes of the secrets manager, until the context is canceled.
+func registerHealthServer(ctx context.Context, srv *grpc.Server, sm secrets.Manager) {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+
+	// The initial status is based on a synchronous probe.
+	st := probeSecretsManager(ctx, hs, sm, healthpb.HealthCheckResponse_UNKNOWN)
+	go func() {
+		t := time.NewTicker(healthProbeInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				hs.Shutdown()
+				return
+			case <-t.C:
+				st = probeSecretsManager(ctx, hs, sm, st)
+			}
+		}
+	}()
+}
+
+// probeSecretsManager updates the serving status of the health server
+// based on a single probe, and logs changes compared to the previous status.
+func probeSecretsManager(ctx context.Context, hs *health.Server, sm secrets.Manager, prev healthpb.HealthCheckResponse_ServingStatus) healthpb.HealthCheckResponse_ServingStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	st := healthpb.HealthCheckResponse_SERVING
+	err := secrets.Probe(ctx, sm)
+	if err != nil {
+		st = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	if st != prev {
+		if err != nil {
+			slog.Error("secrets manager probe failed", slog.Any("error", err))
+		} else {
+			slog.Info("secrets manager probe succeeded")
+		}
+	}
+
+	hs.SetServingStatus("", st)
+	hs.SetServingStatus(thrippypb.ThrippyService_ServiceDesc.ServiceName, st)
+	return st
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+type unreachableManager struct{}
+
+func (unreachableManager) Set(_ context.Context, _, _ string) error {
+	return errors.New("unreachable")
+}
+
+func (unreachableManager) Get(_ context.Context, _ string) (string, error) {
+	return "", errors.New("unreachable")
+}
+
+func (unreachableManager) Delete(_ context.Context, _ string) error {
+	return errors.New("unreachable")
+}
+
+func TestHealthServer(t *testing.T) {
+	tests := []struct {
+		name string
+		sm   secrets.Manager
+		want healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name: "serving",
+			sm:   secrets.NewTestManager(),
+			want: healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name: "not_serving",
+			sm:   unreachableManager{},
+			want: healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cli.Command{Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "grpc-addr",
+					Value: "127.0.0.1:0",
+				},
+				&cli.BoolFlag{
+					Name:  "dev",
+					Value: true,
+				},
+			}}
+			addr, _, err := startGRPCServer(t.Context(), cmd, tt.sm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			c := healthpb.NewHealthClient(conn)
+			for _, svc := range []string{"", thrippypb.ThrippyService_ServiceDesc.ServiceName} {
+				resp, err := c.Check(t.Context(), &healthpb.HealthCheckRequest{Service: svc})
+				if err != nil {
+					t.Fatalf("Check(%q) error = %v", svc, err)
+				}
+				if got := resp.GetStatus(); got != tt.want {
+					t.Errorf("Check(%q) = %v, want %v", svc, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCGracefulStop(t *testing.T) {
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, stop, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := healthpb.NewHealthClient(conn).Check(t.Context(), &healthpb.HealthCheckRequest{}); err == nil {
+		t.Error("Check() after stop error = nil")
+	}
+}
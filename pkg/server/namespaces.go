@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/tzrikka/thrippy/internal/logger"
+	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+// anyone is a wildcard in namespace ACLs: as an identity, it
+// matches all callers, including unauthenticated ones (i.e. without
+// mTLS), and as a namespace, it matches all the namespaces.
+const anyone = "*"
+
+// namespaceACL maps caller identities to the secrets namespaces which they are
+// allowed to select in gRPC requests (see [client.NamespaceMetadataKey]).
+type namespaceACL map[string]map[string]bool
+
+// parseNamespaceACL parses semicolon-separated entries, each of them in the format
+// "<identity>=<namespace>[,<namespace>...]". Identities are matched against the
+// subject common name and SANs (DNS names, URIs, and email addresses) of mTLS
+// client certs, and the peer credentials of Unix domain socket clients ("uid:<N>"
+// and "gid:<N>"). For example: "ci.example.com=dev,staging; uid:1000=*".
+func parseNamespaceACL(s string) (namespaceACL, error) {
+	acl := namespaceACL{}
+	for entry := range strings.SplitSeq(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, nss, ok := strings.Cut(entry, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid namespace ACL entry %q, expecting \"identity=ns1,ns2\"", entry)
+		}
+
+		if acl[id] == nil {
+			acl[id] = map[string]bool{}
+		}
+		for ns := range strings.SplitSeq(nss, ",") {
+			ns = strings.TrimSpace(ns)
+			if ns == "" {
+				continue
+			}
+			if ns != anyone {
+				if err := secrets.ValidateNamespace(ns); err != nil {
+					return nil, err
+				}
+			}
+			acl[id][ns] = true
+		}
+	}
+	return acl, nil
+}
+
+// allowed checks whether any of the given caller identities is allowed to use the given namespace.
+func (acl namespaceACL) allowed(ids []string, ns string) bool {
+	for _, id := range append(ids, anyone) {
+		if acl[id][ns] || acl[id][anyone] {
+			return true
+		}
+	}
+	return false
+}
+
+// callerIdentities returns the identities in the verified mTLS client cert of
+// a gRPC request, or the peer credentials of a Unix domain socket client.
+func callerIdentities(ctx context.Context) []string {
+	if cred, ok := PeerCredentials(ctx); ok {
+		return []string{fmt.Sprintf("uid:%d", cred.UID), fmt.Sprintf("gid:%d", cred.GID)}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return certIdentities(info.State.VerifiedChains[0][0])
+}
+
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return append(ids, cert.EmailAddresses...)
+}
+
+// namespaceInterceptor applies the secrets namespace which is selected in the metadata
+// of incoming gRPC requests, if the caller is authorized to use it. Requests without
+// this metadata, or with the server's default namespace, are always allowed.
+func namespaceInterceptor(acl namespaceACL, defaultNamespace string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		nss := md.Get(client.NamespaceMetadataKey)
+		if len(nss) == 0 {
+			return handler(ctx, req)
+		}
+
+		l := logger.FromContext(ctx).With(slog.String("grpc_method", info.FullMethod))
+		ctx, err := authorizeNamespace(logger.WithContext(ctx, l), acl, defaultNamespace, nss, callerIdentities(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authorizeNamespace checks that the given caller identities are allowed to use the
+// selected namespace, and if so, returns a copy of the given context which applies it.
+// Errors are gRPC status errors, to simplify their use in both gRPC and HTTP handlers.
+func authorizeNamespace(ctx context.Context, acl namespaceACL, defaultNamespace string, nss, ids []string) (context.Context, error) {
+	l := logger.FromContext(ctx).With(slog.String("namespace", nss[0]))
+	if len(nss) > 1 {
+		l.Warn("multiple namespaces in request")
+		return nil, status.Error(codes.InvalidArgument, "multiple namespaces")
+	}
+
+	ns := nss[0]
+	if err := secrets.ValidateNamespace(ns); err != nil {
+		l.Warn("invalid namespace in request", slog.Any("error", err))
+		return nil, status.Error(codes.InvalidArgument, "invalid namespace")
+	}
+
+	if ns != defaultNamespace && !acl.allowed(ids, ns) {
+		l.Warn("caller not allowed to use namespace", slog.Any("identities", ids))
+		return nil, status.Error(codes.PermissionDenied, "namespace not allowed")
+	}
+
+	return secrets.WithNamespace(logger.WithContext(ctx, l), ns), nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+func TestParseNamespaceACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    namespaceACL
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: namespaceACL{},
+		},
+		{
+			name: "multiple",
+			s:    " ci.example.com = dev,staging ; spiffe://example.com/ops=*;",
+			want: namespaceACL{
+				"ci.example.com":           {"dev": true, "staging": true},
+				"spiffe://example.com/ops": {"*": true},
+			},
+		},
+		{
+			name:    "missing_namespaces",
+			s:       "ci.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "missing_identity",
+			s:       "=dev",
+			wantErr: true,
+		},
+		{
+			name:    "invalid_namespace",
+			s:       "ci.example.com=../prod",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNamespaceACL(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseNamespaceACL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNamespaceACL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceACLAllowed(t *testing.T) {
+	acl, err := parseNamespaceACL("ci.example.com=dev,staging; ops@example.com=*; *=sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ids  []string
+		ns   string
+		want bool
+	}{
+		{name: "allowed", ids: []string{"other", "ci.example.com"}, ns: "dev", want: true},
+		{name: "not_allowed", ids: []string{"ci.example.com"}, ns: "prod"},
+		{name: "wildcard_namespace", ids: []string{"ops@example.com"}, ns: "prod", want: true},
+		{name: "wildcard_identity", ns: "sandbox", want: true},
+		{name: "anonymous", ns: "dev"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acl.allowed(tt.ids, tt.ns); got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertIdentities(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "cn"},
+		DNSNames:       []string{"ci.example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/ci"}},
+		EmailAddresses: []string{"ci@example.com"},
+	}
+
+	want := []string{"cn", "ci.example.com", "spiffe://example.com/ci", "ci@example.com"}
+	if got := certIdentities(cert); !reflect.DeepEqual(got, want) {
+		t.Errorf("certIdentities() = %v, want %v", got, want)
+	}
+}
+
+func TestNamespaceInterceptor(t *testing.T) {
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+		&cli.StringFlag{
+			Name:  "grpc-namespace-acl",
+			Value: "*=team-a",
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := grpc.WithTransportCredentials(insecure.NewCredentials())
+	conn, err := grpc.NewClient(addr, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := thrippypb.NewThrippyServiceClient(conn)
+	ctx := client.WithNamespace(t.Context(), "team-a")
+	resp, err := c.CreateLink(ctx, thrippypb.CreateLinkRequest_builder{Template: new("generic-oauth")}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	req := thrippypb.GetLinkRequest_builder{LinkId: new(resp.GetLinkId())}.Build()
+
+	tests := []struct {
+		name     string
+		ns       string
+		wantCode codes.Code
+	}{
+		{name: "same_namespace", ns: "team-a", wantCode: codes.OK},
+		{name: "default_namespace", wantCode: codes.NotFound},
+		{name: "explicit_default_namespace", ns: "test", wantCode: codes.NotFound},
+		{name: "not_allowed", ns: "team-b", wantCode: codes.PermissionDenied},
+		{name: "invalid", ns: "../test", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.GetLink(client.WithNamespace(t.Context(), tt.ns), req)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("GetLink() error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
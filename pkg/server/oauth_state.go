@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStateTTL = 10 * time.Minute
+
+	// maxMemoLen limits the size of memos, which are embedded in OAuth state parameters.
+	maxMemoLen = 256
+
+	// minStateKeyLen is the minimum length of HMAC keys for OAuth state parameters.
+	minStateKeyLen = 32
+)
+
+var (
+	errStateInvalid = errors.New("invalid OAuth state parameter")
+	errStateExpired = errors.New("expired OAuth state parameter")
+)
+
+// oauthState describes a single 3-legged OAuth 2.0 flow. It's encoded in the
+// state parameter when the flow starts, and decoded and verified when the
+// third-party service redirects back to Thrippy (see [stateCodec]).
+type oauthState struct {
+	namespace string // Optional: secrets namespace of the link.
+	linkID    string
+	template  string // The link's template name, for display purposes.
+	memo      string // Optional: short, opaque, but not secret memo from the caller.
+	returnTo  string // Optional: validated URL to return the user to when the flow ends.
+	created   time.Time
+
+	// Optional: OAuth scopes to add to the link's configuration
+	// when the flow is completed (see [client.WithAddedScopes]).
+	scopes     []string
+	userScopes []string
+}
+
+// stateCodec encodes [oauthState] records in self-contained state parameters, so
+// any replica of the HTTP server can verify them, even after restarts. Their
+// contents are readable but not secret, and they are signed with HMAC-SHA256,
+// keyed with the link's nonce (and with an optional server-wide key), so they
+// can't be tampered with. They expire after a configurable TTL, and they can be
+// used only once, because the link's nonce is rotated when a flow is completed
+// successfully, which invalidates all the other pending flows of the same link.
+type stateCodec struct {
+	ttl time.Duration
+	key []byte // Optional HMAC key, in addition to the link's nonce.
+	now func() time.Time
+}
+
+// newStateCodec initializes a codec. If the TTL is not positive, the
+// default one is used. The HMAC key is optional, but if it's specified
+// it must be at least [minStateKeyLen] bytes long.
+func newStateCodec(ttl time.Duration, key string) (*stateCodec, error) {
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+	if key != "" && len(key) < minStateKeyLen {
+		return nil, fmt.Errorf("OAuth state HMAC key must be at least %d bytes long", minStateKeyLen)
+	}
+
+	c := &stateCodec{ttl: ttl, now: time.Now}
+	if key != "" {
+		c.key = []byte(key)
+	}
+	return c, nil
+}
+
+// encode returns the state parameter of a new flow, signed with the link's current nonce.
+func (c *stateCodec) encode(st oauthState, nonce string) string {
+	q := url.Values{}
+	q.Set("id", st.linkID)
+	q.Set("created", strconv.FormatInt(c.now().Unix(), 10))
+	setIfNotEmpty(q, "ns", st.namespace)
+	setIfNotEmpty(q, "template", st.template)
+	setIfNotEmpty(q, "memo", st.memo)
+	setIfNotEmpty(q, "return_to", st.returnTo)
+	setIfNotEmpty(q, "scopes", strings.Join(st.scopes, ","))
+	setIfNotEmpty(q, "user_scopes", strings.Join(st.userScopes, ","))
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(q.Encode()))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.mac(payload, nonce))
+}
+
+func setIfNotEmpty(q url.Values, k, v string) {
+	if v != "" {
+		q.Set(k, v)
+	}
+}
+
+// decode parses the given state parameter, but doesn't verify it, because that
+// requires the nonce of the link it refers to (see [stateCodec.verify]). Until
+// then, none of its contents should be trusted, except for logging.
+func (c *stateCodec) decode(state string) (oauthState, error) {
+	payload, _, ok := strings.Cut(state, ".")
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if !ok || err != nil {
+		return oauthState{}, errStateInvalid
+	}
+
+	q, err := url.ParseQuery(string(b))
+	if err != nil || q.Get("id") == "" {
+		return oauthState{}, errStateInvalid
+	}
+
+	created, err := strconv.ParseInt(q.Get("created"), 10, 64)
+	if err != nil {
+		return oauthState{}, errStateInvalid
+	}
+
+	return oauthState{
+		namespace:  q.Get("ns"),
+		linkID:     q.Get("id"),
+		template:   q.Get("template"),
+		memo:       q.Get("memo"),
+		returnTo:   q.Get("return_to"),
+		created:    time.Unix(created, 0),
+		scopes:     splitScopes(q.Get("scopes")),
+		userScopes: splitScopes(q.Get("user_scopes")),
+	}, nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// verify checks the signature of the given state parameter with the link's
+// current nonce, and then its expiry time. If the signature is valid but the
+// state is expired, the caller may still trust its contents.
+func (c *stateCodec) verify(state, nonce string) error {
+	payload, sig, _ := strings.Cut(state, ".")
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(b, c.mac(payload, nonce)) {
+		return errStateInvalid
+	}
+
+	st, err := c.decode(state)
+	if err != nil {
+		return err
+	}
+	if c.now().Sub(st.created) > c.ttl {
+		return errStateExpired
+	}
+	return nil
+}
+
+// mac is an HMAC-SHA256 of the encoded state, keyed with the link's nonce,
+// or with an HMAC-SHA256 of the nonce if there is also a server-wide key.
+func (c *stateCodec) mac(payload, nonce string) []byte {
+	key := []byte(nonce)
+	if c.key != nil {
+		h := hmac.New(sha256.New, c.key)
+		h.Write(key)
+		key = h.Sum(nil)
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
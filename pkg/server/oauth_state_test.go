@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{
+			name: "without_hmac_key",
+		},
+		{
+			name: "with_hmac_key",
+			key:  strings.Repeat("k", minStateKeyLen),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newStateCodec(time.Minute, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			c.now = func() time.Time { return now }
+
+			want := oauthState{
+				namespace: "team-a", linkID: "id", template: "slack-oauth", memo: "a&b", returnTo: "https://example.com/?x=1",
+				scopes: []string{"a", "b"}, userScopes: []string{"c"},
+			}
+			state := c.encode(want, "nonce")
+			if strings.Contains(state, "nonce") {
+				t.Errorf("encode() = %q, should not expose the nonce", state)
+			}
+
+			got, err := c.decode(state)
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			want.created = time.Unix(now.Unix(), 0)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decode() = %+v, want %+v", got, want)
+			}
+
+			if err := c.verify(state, "nonce"); err != nil {
+				t.Errorf("verify() error = %v", err)
+			}
+
+			// Completed flows rotate the link's nonce.
+			if err := c.verify(state, "rotated-nonce"); !errors.Is(err, errStateInvalid) {
+				t.Errorf("verify(rotated nonce) error = %v, want %v", err, errStateInvalid)
+			}
+		})
+	}
+}
+
+func TestStateCodecExpiry(t *testing.T) {
+	c, err := newStateCodec(time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	state := c.encode(oauthState{linkID: "id"}, "nonce")
+
+	now = now.Add(2 * time.Minute)
+	if err := c.verify(state, "nonce"); !errors.Is(err, errStateExpired) {
+		t.Errorf("verify() error = %v, want %v", err, errStateExpired)
+	}
+}
+
+func TestStateCodecTampering(t *testing.T) {
+	c, err := newStateCodec(0, strings.Repeat("k", minStateKeyLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newStateCodec(0, strings.Repeat("x", minStateKeyLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := c.encode(oauthState{linkID: "id", memo: "memo"}, "nonce")
+	_, sig, _ := strings.Cut(state, ".")
+
+	// Same signature, different contents.
+	payload := base64.RawURLEncoding.EncodeToString([]byte("created=9999999999&id=id&memo=other"))
+
+	for _, bad := range []string{"", ".", state + "A", payload + "." + sig, other.encode(oauthState{linkID: "id"}, "nonce")} {
+		if err := c.verify(bad, "nonce"); !errors.Is(err, errStateInvalid) {
+			t.Errorf("verify(%q) error = %v, want %v", bad, err, errStateInvalid)
+		}
+	}
+
+	for _, bad := range []string{"", "id", "!.sig", base64.RawURLEncoding.EncodeToString([]byte("id=id")) + ".sig"} {
+		if _, err := c.decode(bad); !errors.Is(err, errStateInvalid) {
+			t.Errorf("decode(%q) error = %v, want %v", bad, err, errStateInvalid)
+		}
+	}
+}
+
+func TestNewStateCodec(t *testing.T) {
+	if _, err := newStateCodec(0, "short"); err == nil {
+		t.Error("newStateCodec(short key) error = nil")
+	}
+
+	c, err := newStateCodec(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ttl != defaultStateTTL {
+		t.Errorf("newStateCodec(0) TTL = %v, want %v", c.ttl, defaultStateTTL)
+	}
+}
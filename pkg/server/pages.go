@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tzrikka/thrippy/pkg/links"
+)
+
+// HTML page names. Each page is an [html/template] file named "<page>.html".
+const (
+	startPage   = "start"
+	successPage = "success"
+	errorPage   = "error"
+
+	// styleTemplate is an optional file with shared
+	// definitions which all the pages may use (e.g. "style").
+	styleTemplate = "style.tmpl"
+)
+
+// Error categories in HTML error pages, for statuses without more specific error
+// codes. Pages of failed OAuth flows use the same codes as return URLs (see [returnToURL]).
+const (
+	errCodeInvalidRequest = "invalid_request"
+	errCodeForbidden      = "forbidden"
+	errCodeUnavailable    = "unavailable"
+)
+
+//go:embed pages/*.html pages/*.tmpl
+var defaultPages embed.FS
+
+// pageData is the structured data which HTML page templates receive.
+// Fields which are irrelevant to a page, or unknown, are empty.
+type pageData struct {
+	Page   string // "start", "success", or "error".
+	Status int    // HTTP status code.
+
+	Title   string
+	Header  string
+	Message string // Human-readable, but generic: see also ErrorCategory.
+
+	Template      string // Name of the link's template, e.g. "slack-oauth".
+	Provider      string // Description of the link's template, e.g. "Slack app using OAuth 2.0".
+	ErrorCategory string // Only in error pages, e.g. "access_denied" or "expired".
+	LinkID        string
+	Memo          string // The caller's memo, if there is one.
+
+	AuthURL  string // Only in the start page: the third-party authorization URL.
+	CSPNonce string // For inline "<style>" and "<script>" elements.
+}
+
+// pages contains parsed HTML page templates.
+type pages map[string]*template.Template
+
+// loadPages parses the HTML page templates. Operator-supplied files
+// in the given directory (if it's specified and contains them)
+// override the embedded defaults, one by one.
+func loadPages(dir string) (pages, error) {
+	style, err := readPageFile(dir, styleTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pages{}
+	for _, name := range []string{startPage, successPage, errorPage} {
+		b, err := readPageFile(dir, name+".html")
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := template.New(name).Parse(string(style))
+		if err == nil {
+			t, err = t.Parse(string(b))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s page template: %w", name, err)
+		}
+		p[name] = t
+	}
+	return p, nil
+}
+
+// readPageFile reads an operator-supplied file, or the embedded default if it doesn't exist.
+func readPageFile(dir, filename string) ([]byte, error) {
+	if dir != "" {
+		path := filepath.Join(dir, filename)
+		b, err := os.ReadFile(path) //gosec:disable G304 // Specified by admin by design.
+		if err == nil {
+			slog.Info("using custom HTML page template", slog.String("path", path))
+			return b, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read HTML page template: %w", err)
+		}
+	}
+	return fs.ReadFile(defaultPages, "pages/"+filename)
+}
+
+// render writes the given page, with the given status code and data,
+// and a Content Security Policy which allows only inline elements
+// that have the response's random nonce, and images.
+func (p pages) render(w http.ResponseWriter, status int, page string, d pageData) {
+	nonce := cspNonce()
+	d.Page, d.Status, d.CSPNonce = page, status, nonce
+	if d.Title == "" {
+		d.Title, d.Header = pageTitle(status)
+	}
+	if d.Message != "" && !strings.HasSuffix(d.Message, ".") {
+		d.Message += "."
+	}
+	if d.Template != "" && d.Provider == "" {
+		if t, ok := links.Templates[d.Template]; ok {
+			d.Provider = t.Description()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p[page].Execute(&buf, d); err != nil {
+		slog.Error("failed to render HTML page", slog.String("page", page), slog.Any("error", err))
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; style-src 'nonce-%[1]s'; "+
+		"script-src 'nonce-%[1]s'; img-src 'self' data: https:; base-uri 'none'; form-action 'none'; "+
+		"frame-ancestors 'none'", nonce))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func pageTitle(status int) (title, header string) {
+	if status >= http.StatusBadRequest {
+		return "Error", fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	return "Success", "Success!"
+}
+
+// errorCategory returns a generic error category for the given HTTP status code.
+func errorCategory(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return ""
+	case status == http.StatusForbidden:
+		return errCodeForbidden
+	case status == http.StatusServiceUnavailable:
+		return errCodeUnavailable
+	case status < http.StatusInternalServerError:
+		return errCodeInvalidRequest
+	default:
+		return errCodeInternal
+	}
+}
+
+func cspNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// securityHeaders adds security-related HTTP headers to all the responses of the given
+// handler. HTML pages override the default Content Security Policy (see [pages.render]).
+// Most importantly, responses must never leak OAuth codes and states in the callback
+// URL to other sites (with the "Referer" header), or be cached.
+func securityHeaders(next http.Handler, hsts bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		h.Set("Cache-Control", "no-store")
+		if hsts {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			wantBody: "<h1>Success!</h1>",
+		},
+		{
+			name:     "custom_page",
+			files:    map[string]string{"success.html": `<p>{{.Template}} {{.Provider}} {{.Memo}}</p>`},
+			wantBody: "<p>slack-oauth Slack app using OAuth v2 memo</p>",
+		},
+		{
+			name: "custom_style",
+			files: map[string]string{
+				"style.tmpl":   `{{define "style"}}<style nonce="{{.CSPNonce}}">p {}</style>{{end}}`,
+				"success.html": `{{template "style" .}}`,
+			},
+			wantBody: "p {}</style>",
+		},
+		{
+			name:    "invalid_template",
+			files:   map[string]string{"error.html": `{{.Foo`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p, err := loadPages(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadPages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			w := httptest.NewRecorder()
+			p.render(w, http.StatusOK, successPage, pageData{Template: "slack-oauth", Memo: "memo"})
+			if body := w.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("render() body = %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPagesRender(t *testing.T) {
+	p, err := loadPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	p.render(w, http.StatusForbidden, errorPage, pageData{Message: "<b>bad</b>", ErrorCategory: errCodeExpired, LinkID: "id"})
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("render() status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	csp := w.Header().Get("Content-Security-Policy")
+	_, nonce, found := strings.Cut(csp, "style-src 'nonce-")
+	nonce, _, _ = strings.Cut(nonce, "'")
+	if !found || nonce == "" {
+		t.Fatalf("render() CSP = %q", csp)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{`<style nonce="` + nonce + `">`, "&lt;b&gt;bad&lt;/b&gt;.", "Error code: expired", "Link ID: id", "403 Forbidden"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("render() body = %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusBadRequest, want: errCodeInvalidRequest},
+		{status: http.StatusForbidden, want: errCodeForbidden},
+		{status: http.StatusInternalServerError, want: errCodeInternal},
+		{status: http.StatusServiceUnavailable, want: errCodeUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			if got := errorCategory(tt.status); got != tt.want {
+				t.Errorf("errorCategory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuccessHandler(t *testing.T) {
+	p, err := loadPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &httpServer{pages: p}
+
+	tests := []struct {
+		name     string
+		query    string
+		want     []string
+		dontWant []string
+	}{
+		{
+			name:     "no_params",
+			want:     []string{"You may now close this browser tab."},
+			dontWant: []string{"Link ID"},
+		},
+		{
+			name:  "valid_params",
+			query: "link_id=Lpab3Rf2SQCMBhK6UnBELi&template=slack-oauth",
+			want:  []string{"Link ID: Lpab3Rf2SQCMBhK6UnBELi", "Slack app using OAuth v2"},
+		},
+		{
+			name:     "invalid_params",
+			query:    "link_id=%3Cscript%3E&template=foo",
+			dontWant: []string{"Link ID", "script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.successHandler(w, httptest.NewRequest(http.MethodGet, "/success?"+tt.query, nil))
+
+			body := w.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("successHandler() body = %q, want it to contain %q", body, want)
+				}
+			}
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(body, dontWant) {
+					t.Errorf("successHandler() body = %q, want it to not contain %q", body, dontWant)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		hsts     bool
+		wantHSTS string
+	}{
+		{
+			name: "http",
+		},
+		{
+			name:     "https",
+			hsts:     true,
+			wantHSTS: "max-age=31536000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tt.hsts)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if got := w.Header().Get("Referrer-Policy"); got != "no-referrer" {
+				t.Errorf("Referrer-Policy = %q, want %q", got, "no-referrer")
+			}
+			if got := w.Header().Get("X-Frame-Options"); got != "DENY" {
+				t.Errorf("X-Frame-Options = %q, want %q", got, "DENY")
+			}
+			if got := w.Header().Get("Content-Security-Policy"); !strings.Contains(got, "default-src 'none'") {
+				t.Errorf("Content-Security-Policy = %q", got)
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tt.wantHSTS)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// getPeerCred returns the credentials of the process on the
+// other side of the given Unix domain socket, using SO_PEERCRED.
+func getPeerCred(conn *net.UnixConn) (PeerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+
+	var ucred *syscall.Ucred
+	var uerr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, uerr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED) //gosec:disable G115 // File descriptors fit in an int.
+	})
+	if err != nil {
+		return PeerCred{}, err
+	}
+	if uerr != nil {
+		return PeerCred{}, uerr
+	}
+
+	return PeerCred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"net"
+)
+
+// getPeerCred is not supported on non-Linux platforms, so Unix domain socket
+// connections there are authenticated only by the socket file's permissions.
+func getPeerCred(_ *net.UnixConn) (PeerCred, error) {
+	return PeerCred{}, errPeerCredNotSupported
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// certReloadInterval is how often [certReloader] checks whether its files have changed.
+const certReloadInterval = 30 * time.Second
+
+// certReloader loads an X.509 key pair and/or a CA cert pool (for client
+// authentication in servers, or server verification in clients), and
+// reloads them when their files are modified (e.g. rotated by cert-manager)
+// or when the process receives a SIGHUP signal. Failed reloads are logged,
+// and the previously-loaded certs remain in use until the next successful one.
+type certReloader struct {
+	certPath, keyPath, caPath string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	ca    *x509.CertPool
+	stamp map[string]fileStamp
+}
+
+// fileStamp identifies a specific version of a file, without reading it.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newCertReloader loads the given files for the first time. The CA cert path is
+// optional in servers, and the key pair paths are optional in TLS (not mTLS) clients.
+func newCertReloader(certPath, keyPath, caPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath, caPath: caPath}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads and parses all the files of the reloader, and replaces
+// the current certs only if all of them were loaded successfully.
+func (r *certReloader) load() error {
+	stamp := r.stat()
+
+	var cert *tls.Certificate
+	if r.certPath != "" || r.keyPath != "" {
+		c, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load PEM key pair: %w", err)
+		}
+		cert = &c
+	}
+
+	var ca *x509.CertPool
+	if r.caPath != "" {
+		pem, err := os.ReadFile(r.caPath) //gosec:disable G304 // Specified by admin by design.
+		if err != nil {
+			return fmt.Errorf("failed to read CA cert file: %w", err)
+		}
+		ca = x509.NewCertPool()
+		if !ca.AppendCertsFromPEM(pem) {
+			return errors.New("failed to parse CA cert file")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = cert
+	r.ca = ca
+	r.stamp = stamp
+	return nil
+}
+
+// stat returns the current stamps of all the files of the reloader. Files are
+// stat'ed by path (following symbolic links), so atomic replacements of
+// Kubernetes secret volumes, which swap a symbolic link, are detected too.
+func (r *certReloader) stat() map[string]fileStamp {
+	stamp := map[string]fileStamp{}
+	for _, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			stamp[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamp
+}
+
+// changed reports whether any of the files were modified since they were last loaded.
+func (r *certReloader) changed() bool {
+	stamp := r.stat()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(stamp) != len(r.stamp) {
+		return true
+	}
+	for path, s := range stamp {
+		if prev, ok := r.stamp[path]; !ok || !prev.modTime.Equal(s.modTime) || prev.size != s.size {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the files when they change, or when the process receives a
+// SIGHUP signal, until the given context is canceled. This is blocking.
+func (r *certReloader) watch(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	ticker := time.NewTicker(certReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			r.reload("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reload("file change")
+			}
+		}
+	}
+}
+
+func (r *certReloader) reload(reason string) {
+	l := slog.With(slog.String("reason", reason))
+	if r.certPath != "" {
+		l = l.With(slog.String("cert", r.certPath), slog.String("key", r.keyPath))
+	}
+	if r.caPath != "" {
+		l = l.With(slog.String("ca_cert", r.caPath))
+	}
+
+	if err := r.load(); err != nil {
+		l.Error("failed to reload TLS certs, still using the previous ones", slog.Any("error", err))
+		return
+	}
+	l.Info("reloaded TLS certs")
+}
+
+// getCertificate implements [tls.Config.GetCertificate].
+func (r *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// serverConfig returns a TLS server configuration which always uses the
+// current certs. If the reloader has a CA cert, clients must present
+// a valid cert signed by it (mTLS).
+func (r *certReloader) serverConfig() *tls.Config {
+	if r.caPath == "" {
+		return &tls.Config{
+			GetCertificate: r.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	return &tls.Config{
+		GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.ca,
+				MinVersion:   tls.VersionTLS13,
+			}, nil
+		},
+		MinVersion: tls.VersionTLS13,
+	}
+}
+
+// clientConfig returns a TLS client configuration with the current certs:
+// the CA cert pool to verify the server, and the client's own key pair for
+// mTLS (if there is one). The server name is optional (see [tls.Config]).
+func (r *certReloader) clientConfig(serverName string) *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg := &tls.Config{
+		RootCAs:    r.ca,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS13,
+	}
+	if r.cert != nil {
+		cfg.Certificates = []tls.Certificate{*r.cert}
+	}
+	return cfg
+}
+
+// handleSIGHUP prevents SIGHUP signals from terminating the process, which is
+// their default behavior, even if there aren't any [certReloader]s to handle
+// them, until the given context is canceled. This is non-blocking.
+func handleSIGHUP(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+				slog.Info("received SIGHUP")
+			}
+		}
+	}()
+}
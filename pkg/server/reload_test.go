@@ -0,0 +1,191 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a new self-signed cert and its private key to the given paths.
+func writeTestCert(t *testing.T, certPath, keyPath, cn string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedCommonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	cert, err := r.getCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+	writeTestCert(t, certPath, keyPath, "first")
+	writeTestCert(t, caPath, filepath.Join(dir, "ca.key"), "ca")
+
+	r, err := newCertReloader(certPath, keyPath, caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servedCommonName(t, r); got != "first" {
+		t.Errorf("initial cert CN = %q, want %q", got, "first")
+	}
+	if r.changed() {
+		t.Error("changed() = true, want false")
+	}
+
+	// Rotation.
+	writeTestCert(t, certPath, keyPath, "second")
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !r.changed() {
+		t.Fatal("changed() = false, want true")
+	}
+
+	r.reload("test")
+	if got := servedCommonName(t, r); got != "second" {
+		t.Errorf("rotated cert CN = %q, want %q", got, "second")
+	}
+	if r.changed() {
+		t.Error("changed() after reload = true, want false")
+	}
+
+	// Failed reloads keep the previous certs.
+	if err := os.WriteFile(keyPath, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r.reload("test")
+	if got := servedCommonName(t, r); got != "second" {
+		t.Errorf("cert CN after failed reload = %q, want %q", got, "second")
+	}
+
+	cfg, err := r.serverConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil {
+		t.Errorf("serverConfig() with CA cert = %v, %v, want mTLS", cfg.ClientAuth, cfg.ClientCAs)
+	}
+}
+
+func TestNewCertReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	writeTestCert(t, certPath, keyPath, "test")
+
+	if _, err := newCertReloader(certPath, filepath.Join(dir, "missing.key"), ""); err == nil {
+		t.Error("newCertReloader(missing key) error = nil")
+	}
+	if _, err := newCertReloader(certPath, keyPath, keyPath); err == nil {
+		t.Error("newCertReloader(invalid CA cert) error = nil")
+	}
+}
+
+func TestCertReloaderClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.crt")
+	writeTestCert(t, caPath, filepath.Join(dir, "ca.key"), "first")
+
+	// TLS client: only the server's CA cert, without a client key pair.
+	r, err := newCertReloader("", "", caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := r.clientConfig("server")
+	if cfg.RootCAs == nil || len(cfg.Certificates) > 0 || cfg.ServerName != "server" {
+		t.Errorf("clientConfig() = %+v, want only root CAs and server name", cfg)
+	}
+
+	// Rotation applies to new configurations.
+	writeTestCert(t, caPath, filepath.Join(dir, "ca.key"), "second")
+	r.reload("test")
+	if r.clientConfig("").RootCAs.Equal(cfg.RootCAs) {
+		t.Error("clientConfig() after reload uses the previous root CAs")
+	}
+
+	// mTLS client.
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	writeTestCert(t, certPath, keyPath, "client")
+	r, err = newCertReloader(certPath, keyPath, caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := r.clientConfig(""); len(cfg.Certificates) != 1 {
+		t.Errorf("clientConfig() with key pair = %d certs, want 1", len(cfg.Certificates))
+	}
+}
+
+func TestHandleSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported on Windows")
+	}
+
+	handleSIGHUP(t.Context())
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test process would be terminated if the signal wasn't handled.
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
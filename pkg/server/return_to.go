@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tzrikka/thrippy/pkg/oauth"
+)
+
+// Error codes in return URLs, in addition to the OAuth 2.0
+// error codes which are reported by third-party services.
+const (
+	errCodeExpired          = "expired"
+	errCodeInvalidLink      = "invalid_link"
+	errCodeApprovalRequired = "approval_required"
+	errCodeMissingCode      = "missing_code"
+	errCodeExchangeFailed   = "exchange_failed"
+	errCodeInternal         = "internal_error"
+	errCodeProvider         = "provider_error"
+)
+
+// oauthErrorCode matches the format of OAuth 2.0 error codes (RFC 6749 section 4.1.2.1),
+// in a stricter way, to pass them safely from third-party services to return URLs.
+var oauthErrorCode = regexp.MustCompile(`^[a-z][a-z_]{0,63}$`)
+
+// parseReturnToAllowlist parses a list of allowed return URLs. Each
+// entry may contain multiple space-separated URLs (see [oauth.ReturnToParam]).
+func parseReturnToAllowlist(entries []string) ([]*url.URL, error) {
+	var allowlist []*url.URL
+	for _, e := range entries {
+		for s := range strings.FieldsSeq(e) {
+			u, err := parseReturnToURL(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid return URL allowlist entry %q: %w", s, err)
+			}
+			allowlist = append(allowlist, u)
+		}
+	}
+	return allowlist, nil
+}
+
+// parseReturnToURL accepts only absolute HTTP(S) URLs, without user info, fragments,
+// or dot segments in their paths (which browsers resolve, to escape allowed paths).
+func parseReturnToURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, errors.New("unsupported URL scheme")
+	}
+	if u.Host == "" || u.User != nil || u.Fragment != "" || strings.Contains(u.Path, "\\") {
+		return nil, errors.New("invalid URL")
+	}
+	for seg := range strings.SplitSeq(u.Path, "/") {
+		if seg == "." || seg == ".." {
+			return nil, errors.New("invalid URL path")
+		}
+	}
+	return u, nil
+}
+
+// checkReturnTo returns an error if the given return URL isn't valid, or not allowed by
+// the server-wide allowlist nor by the link's own allowlist (see [oauth.ReturnToParam]).
+func (s *httpServer) checkReturnTo(o *oauth.Config, returnTo string) error {
+	u, err := parseReturnToURL(returnTo)
+	if err != nil {
+		return err
+	}
+
+	allowlist := s.returnToAllowlist
+	if o != nil && o.Params[oauth.ReturnToParam] != "" {
+		linkAllowlist, err := parseReturnToAllowlist([]string{o.Params[oauth.ReturnToParam]})
+		if err != nil {
+			return err
+		}
+		allowlist = append(linkAllowlist, allowlist...)
+	}
+
+	for _, a := range allowlist {
+		if returnToAllowed(a, u) {
+			return nil
+		}
+	}
+	return errors.New("URL not in allowlist")
+}
+
+// returnToAllowed checks whether the given return URL has the same scheme and
+// host as the given allowlist entry, and whether its path is under the entry's.
+func returnToAllowed(allowed, u *url.URL) bool {
+	if !strings.EqualFold(u.Scheme, allowed.Scheme) || !strings.EqualFold(u.Host, allowed.Host) {
+		return false
+	}
+
+	prefix := strings.TrimSuffix(allowed.Path, "/")
+	if prefix == "" {
+		return true
+	}
+	return u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")
+}
+
+// returnToURL adds the results of an OAuth flow to the query of the given
+// (already validated) return URL: the link ID, the caller's memo (if there is
+// one), and an error code (if the flow failed).
+func returnToURL(returnTo string, st oauthState, errCode string) string {
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return returnTo // Unreachable: already validated.
+	}
+
+	q := u.Query()
+	q.Set("link_id", st.linkID)
+	if st.memo != "" {
+		q.Set("memo", st.memo)
+	}
+	if errCode != "" {
+		q.Set("error", errCode)
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// providerErrorCode returns the given error code of a third-party
+// service, if it's safe to pass it as-is to return URLs.
+func providerErrorCode(code string) string {
+	if oauthErrorCode.MatchString(code) {
+		return code
+	}
+	return errCodeProvider
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/oauth"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+func TestParseReturnToAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "multiple",
+			entries: []string{"https://a.example.com/oauth", " https://b.example.com http://localhost:8080 "},
+			want:    3,
+		},
+		{
+			name:    "relative_url",
+			entries: []string{"/oauth"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported_scheme",
+			entries: []string{"javascript://example.com/alert(1)"},
+			wantErr: true,
+		},
+		{
+			name:    "user_info",
+			entries: []string{"https://user@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReturnToAllowlist(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseReturnToAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseReturnToAllowlist() = %v, want %d entries", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReturnTo(t *testing.T) {
+	allowlist, err := parseReturnToAllowlist([]string{"https://portal.example.com/oauth/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &httpServer{returnToAllowlist: allowlist}
+	link := &oauth.Config{Params: map[string]string{oauth.ReturnToParam: "https://app.example.com"}}
+
+	tests := []struct {
+		name     string
+		o        *oauth.Config
+		returnTo string
+		wantErr  bool
+	}{
+		{
+			name:     "server_allowlist",
+			returnTo: "https://portal.example.com/oauth/done?x=1",
+		},
+		{
+			name:     "server_allowlist_exact_path",
+			returnTo: "https://portal.example.com/oauth",
+		},
+		{
+			name:     "server_allowlist_with_link",
+			o:        link,
+			returnTo: "https://portal.example.com/oauth/done",
+		},
+		{
+			name:     "link_allowlist",
+			o:        link,
+			returnTo: "https://app.example.com/any/path",
+		},
+		{
+			name:     "link_allowlist_other_link",
+			returnTo: "https://app.example.com/any/path",
+			wantErr:  true,
+		},
+		{
+			name:     "path_prefix_without_separator",
+			returnTo: "https://portal.example.com/oauthx",
+			wantErr:  true,
+		},
+		{
+			name:     "dot_segments",
+			returnTo: "https://portal.example.com/oauth/../admin",
+			wantErr:  true,
+		},
+		{
+			name:     "encoded_dot_segments",
+			returnTo: "https://portal.example.com/oauth/%2e%2e/admin",
+			wantErr:  true,
+		},
+		{
+			name:     "different_scheme",
+			returnTo: "http://portal.example.com/oauth/done",
+			wantErr:  true,
+		},
+		{
+			name:     "different_host",
+			returnTo: "https://portal.example.com.evil.com/oauth/done",
+			wantErr:  true,
+		},
+		{
+			name:     "scheme_relative",
+			returnTo: "//portal.example.com/oauth/done",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.checkReturnTo(tt.o, tt.returnTo); (err != nil) != tt.wantErr {
+				t.Errorf("checkReturnTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReturnToURL(t *testing.T) {
+	st := oauthState{linkID: "id", memo: "a&b"}
+
+	got := returnToURL("https://app.example.com/done?x=1", st, "")
+	want := "https://app.example.com/done?link_id=id&memo=a%26b&x=1"
+	if got != want {
+		t.Errorf("returnToURL() = %q, want %q", got, want)
+	}
+
+	got = returnToURL("https://app.example.com/done", oauthState{linkID: "id"}, errCodeExpired)
+	want = "https://app.example.com/done?error=expired&link_id=id"
+	if got != want {
+		t.Errorf("returnToURL() = %q, want %q", got, want)
+	}
+}
+
+func TestProviderErrorCode(t *testing.T) {
+	if got := providerErrorCode("access_denied"); got != "access_denied" {
+		t.Errorf("providerErrorCode() = %q, want %q", got, "access_denied")
+	}
+	if got := providerErrorCode("<script>"); got != errCodeProvider {
+		t.Errorf("providerErrorCode() = %q, want %q", got, errCodeProvider)
+	}
+}
+
+func TestOAuthExchangeHandlerReturnTo(t *testing.T) {
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "127.0.0.1:0",
+		},
+		&cli.BoolFlag{
+			Name:  "dev",
+			Value: true,
+		},
+	}}
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resp, err := thrippypb.NewThrippyServiceClient(conn).CreateLink(t.Context(),
+		thrippypb.CreateLinkRequest_builder{
+			Template: new("generic-oauth"),
+			OauthConfig: thrippypb.OAuthConfig_builder{
+				ClientId:     new("111"),
+				ClientSecret: new("222"),
+			}.Build(),
+		}.Build())
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	id := resp.GetLinkId()
+
+	_, o, err := client.LinkTemplateAndOAuthConfig(t.Context(), addr, insecure.NewCredentials(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := newStateCodec(time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := loadPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Any replica can verify state parameters, so this isn't the server that started the flow.
+	s := &httpServer{grpcAddr: addr, grpcCreds: insecure.NewCredentials(), states: states, pages: pages}
+	returnTo := "https://app.example.com/done"
+
+	tests := []struct {
+		name       string
+		query      func(state string) string
+		nonce      string // Signing nonce, if different from the link's.
+		expire     bool
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "provider_error",
+			query:      func(state string) string { return "error=access_denied&state=" + state },
+			wantStatus: http.StatusFound,
+			wantError:  "access_denied",
+		},
+		{
+			name:       "expired",
+			query:      func(state string) string { return "code=123&state=" + state },
+			expire:     true,
+			wantStatus: http.StatusFound,
+			wantError:  errCodeExpired,
+		},
+		{
+			name:       "forged_provider_error",
+			query:      func(state string) string { return "error=access_denied&state=" + state },
+			nonce:      "forged",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "forged",
+			query:      func(state string) string { return "code=123&state=" + state },
+			nonce:      "forged",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			states.now = func() time.Time { return now }
+
+			nonce := o.Nonce
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			state := states.encode(oauthState{linkID: id, memo: "memo", returnTo: returnTo}, nonce)
+			if tt.expire {
+				now = now.Add(2 * time.Minute)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/callback?"+tt.query(url.QueryEscape(state)), nil)
+			s.oauthExchangeHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("oauthExchangeHandler() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusFound {
+				return // Untrusted return URLs are not used.
+			}
+
+			u, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := u.Query()
+			if q.Get("error") != tt.wantError || q.Get("link_id") != id || q.Get("memo") != "memo" {
+				t.Errorf("oauthExchangeHandler() redirect = %q", u)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc"
+)
+
+// DefaultShutdownTimeout is the default value of the "shutdown-timeout" flag,
+// which is also used when the flag isn't set or is zero.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// shutdownTimeout is the maximum time to wait for in-flight requests
+// (e.g. OAuth code exchanges) to complete when stopping a server.
+func shutdownTimeout(cmd *cli.Command) time.Duration {
+	if d := cmd.Duration("shutdown-timeout"); d > 0 {
+		return d
+	}
+	return DefaultShutdownTimeout
+}
+
+// gracefulStop stops the given gRPC server from accepting new connections and
+// requests, and waits for pending requests to complete. If they don't complete
+// within the given timeout, it closes all the connections and aborts them.
+func gracefulStop(srv *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("gRPC server stopped")
+	case <-time.After(timeout):
+		slog.Warn("gRPC server shutdown timed out, aborting pending requests")
+		srv.Stop()
+	}
+}
+
+// shutdownHTTP stops the given HTTP server from accepting new connections, and
+// waits for active requests to complete. If they don't complete within the given
+// timeout, it closes all the connections and aborts them.
+func shutdownHTTP(srv *http.Server, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn(name+" shutdown timed out, aborting active requests", slog.Any("error", err))
+		return errors.Join(err, srv.Close())
+	}
+
+	slog.Info(name + " stopped")
+	return nil
+}
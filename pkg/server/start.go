@@ -1,11 +1,13 @@
-// Package server implements Thrippy's gRPC service,
-// and an HTTP server for OAuth webhooks.
+// Package server implements Thrippy's gRPC service, an optional
+// REST/JSON gateway to it, and an HTTP server for OAuth webhooks.
 package server
 
 import (
 	"context"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lmittmann/tint"
 	"github.com/urfave/cli/v3"
@@ -14,6 +16,11 @@ import (
 )
 
 // Start initializes Thrippy's gRPC and HTTP servers, and the default logger.
+//
+// This is blocking, until the process receives a SIGINT or SIGTERM signal.
+// The servers are then stopped gracefully: first the HTTP servers, which
+// wait for in-flight OAuth exchanges to complete, and then the gRPC server
+// (which they depend on), which waits for its own pending requests.
 func Start(ctx context.Context, cmd *cli.Command) error {
 	var handler slog.Handler
 	if cmd.Bool("dev") {
@@ -34,14 +41,34 @@ func Start(ctx context.Context, cmd *cli.Command) error {
 		slog.Warn("********** DEV MODE - UNSAFE IN PRODUCTION! **********")
 	}
 
+	// The secrets manager outlives the servers, to let them drain gracefully.
 	sm, err := secrets.NewManager(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	if _, err := startGRPCServer(ctx, cmd, sm); err != nil {
+	// SIGHUP reloads TLS certs (see [certReloader]), it doesn't stop the servers.
+	handleSIGHUP(ctx)
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_, stopGRPC, err := startGRPCServer(ctx, cmd, sm)
+	if err != nil {
+		return err
+	}
+	defer stopGRPC()
+
+	stopAPI, err := startAPIServer(ctx, cmd, sm)
+	if err != nil {
+		return err
+	}
+	defer stopAPI()
+
+	s, err := newHTTPServer(ctx, cmd)
+	if err != nil {
 		return err
 	}
 
-	return newHTTPServer(ctx, cmd).run()
+	return s.run(ctx)
 }
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	defaultSocketMode = "0600"
+)
+
+var errPeerCredNotSupported = errors.New("unix socket peer credentials are not supported on this platform")
+
+// PeerCred contains the OS-level credentials of the process on the
+// other side of a Unix domain socket, at the time it connected.
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// peerCredInfo is the [credentials.AuthInfo] of gRPC connections over Unix domain
+// sockets, which adds the client's [PeerCred] to the standard local credentials.
+type peerCredInfo struct {
+	credentials.AuthInfo
+
+	Cred PeerCred
+}
+
+// GetCommonAuthInfo exposes the security level of the underlying
+// local credentials, which gRPC checks for each request.
+func (i peerCredInfo) GetCommonAuthInfo() credentials.CommonAuthInfo {
+	if c, ok := i.AuthInfo.(interface {
+		GetCommonAuthInfo() credentials.CommonAuthInfo
+	}); ok {
+		return c.GetCommonAuthInfo()
+	}
+	return credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}
+}
+
+// PeerCredentials returns the OS-level credentials of the caller of a
+// gRPC request, if it was received over a Unix domain socket, and the
+// platform supports it (currently only Linux, with SO_PEERCRED).
+func PeerCredentials(ctx context.Context) (PeerCred, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return PeerCred{}, false
+	}
+	info, ok := p.AuthInfo.(peerCredInfo)
+	if !ok {
+		return PeerCred{}, false
+	}
+	return info.Cred, true
+}
+
+// peerCredsTransport is a wrapper of local gRPC server credentials, which extracts the
+// [PeerCred] of each Unix domain socket connection during the transport handshake.
+type peerCredsTransport struct {
+	credentials.TransportCredentials
+}
+
+func (t *peerCredsTransport) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := t.TransportCredentials.ServerHandshake(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, info, nil
+	}
+
+	cred, err := getPeerCred(uc)
+	if errors.Is(err, errPeerCredNotSupported) {
+		return conn, info, nil
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to get unix socket peer credentials: %w", err)
+	}
+
+	return conn, peerCredInfo{AuthInfo: info, Cred: cred}, nil
+}
+
+func (t *peerCredsTransport) Clone() credentials.TransportCredentials {
+	return &peerCredsTransport{TransportCredentials: t.TransportCredentials.Clone()}
+}
+
+// listenUnix listens on the given Unix domain socket path, after removing a stale
+// socket file from a previous run if necessary, and applies the configured
+// permissions to the new socket file (octal mode, and optionally a group).
+//
+// The socket is created in a private (0700) directory, and moved to the given
+// path only after applying its permissions, so other users can't connect to it
+// in the meantime, when its mode is still based on the process's umask.
+func listenUnix(ctx context.Context, path, mode, group string) (net.Listener, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return nil, fmt.Errorf("invalid unix socket file mode %q", mode)
+	}
+
+	gid := -1
+	if group != "" {
+		if gid, err = lookupGroupID(group); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := removeStaleSocket(ctx, path); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".thrippy-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(path))
+	lc := net.ListenConfig{}
+	lis, err := lc.Listen(ctx, "unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	ul, ok := lis.(*net.UnixListener)
+	if !ok {
+		_ = lis.Close()
+		return nil, fmt.Errorf("unexpected unix socket listener type: %T", lis)
+	}
+	ul.SetUnlinkOnClose(false) // The socket file is moved, see [unixListener.Close].
+
+	if err := os.Chmod(tmp, fs.FileMode(m)); err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+	if gid >= 0 {
+		if err := os.Chown(tmp, -1, gid); err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: ul, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener reports the final path of a Unix domain socket which was moved
+// after binding (see [listenUnix]), and removes that socket file when it's closed.
+type unixListener struct {
+	*net.UnixListener
+
+	addr *net.UnixAddr
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	if rerr := os.Remove(l.addr.Name); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// removeStaleSocket removes the given Unix domain socket file, unless another
+// server is still listening on it. Other types of files are not removed.
+func removeStaleSocket(ctx context.Context, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("not a unix socket: %s", path)
+	}
+
+	d := net.Dialer{}
+	if conn, err := d.DialContext(ctx, "unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket already in use: %s", path)
+	}
+
+	slog.Warn("removing stale unix socket file", slog.String("path", path))
+	return os.Remove(path)
+}
+
+// lookupGroupID accepts either a group name or a numeric group ID.
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
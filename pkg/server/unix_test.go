@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/local"
+	"google.golang.org/grpc/status"
+
+	thrippypb "github.com/tzrikka/thrippy-api/thrippy/v1"
+	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/secrets"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thrippy.sock")
+	acl := fmt.Sprintf("uid:%d=team-a", os.Getuid())
+
+	cmd := &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "grpc-addr",
+			Value: "unix://" + path,
+		},
+		&cli.StringFlag{
+			Name:  "grpc-socket-mode",
+			Value: "0660",
+		},
+		&cli.StringFlag{
+			Name:  "grpc-namespace-acl",
+			Value: acl,
+		},
+	}}
+
+	// A stale socket file from a previous run.
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = lis.Close()
+
+	addr, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "unix:"+path {
+		t.Errorf("startGRPCServer() = %q, want %q", addr, "unix:"+path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o660 || info.Mode().Type() != fs.ModeSocket {
+		t.Errorf("socket file mode = %v, want %v", info.Mode(), fs.ModeSocket|0o660)
+	}
+
+	// Another server can't take over a socket that's in use.
+	if _, _, err := startGRPCServer(t.Context(), cmd, secrets.NewTestManager()); err == nil {
+		t.Error("startGRPCServer(socket in use) error = nil")
+	}
+
+	conn, err := client.Connection(addr, local.NewCredentials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Peer credentials are used as caller identities in the namespace ACL.
+	wantCode := codes.OK
+	if runtime.GOOS != "linux" {
+		wantCode = codes.PermissionDenied
+	}
+
+	c := thrippypb.NewThrippyServiceClient(conn)
+	ctx := client.WithNamespace(t.Context(), "team-a")
+	_, err = c.CreateLink(ctx, thrippypb.CreateLinkRequest_builder{Template: new("generic-oauth")}.Build())
+	if got := status.Code(err); got != wantCode {
+		t.Errorf("CreateLink() error = %v, want code %v", err, wantCode)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "thrippy.sock")
+	lis, err := listenUnix(t.Context(), path, "0640", "")
+	if err != nil {
+		t.Fatalf("listenUnix() error = %v", err)
+	}
+
+	if got := lis.Addr().String(); got != path {
+		t.Errorf("listenUnix() address = %q, want %q", got, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("socket file mode = %v, want %v", info.Mode().Perm(), fs.FileMode(0o640))
+	}
+
+	// The private directory in which the socket was created is removed.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory entries = %v, want only the socket", entries)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("net.Dial() error = %v", err)
+	}
+	_ = conn.Close()
+
+	if err := lis.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Close() did not remove the socket file: %v", err)
+	}
+}
+
+func TestListenUnixInvalidMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thrippy.sock")
+	if _, err := listenUnix(t.Context(), path, "999", ""); err == nil {
+		t.Error("listenUnix() error = nil")
+	}
+}
+
+func TestRemoveStaleSocketRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thrippy.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(t.Context(), path); err == nil {
+		t.Error("removeStaleSocket(regular file) error = nil")
+	}
+}
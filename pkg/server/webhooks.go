@@ -2,11 +2,9 @@ package server
 
 import (
 	"context"
-	"crypto/subtle"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"html"
-	"html/template"
 	"log/slog"
 	"net"
 	"net/http"
@@ -19,10 +17,13 @@ import (
 	"github.com/urfave/cli/v3"
 	"google.golang.org/grpc/credentials"
 
+	intlinks "github.com/tzrikka/thrippy/internal/links"
 	"github.com/tzrikka/thrippy/internal/logger"
 	"github.com/tzrikka/thrippy/pkg/client"
+	"github.com/tzrikka/thrippy/pkg/links"
 	"github.com/tzrikka/thrippy/pkg/links/github"
 	"github.com/tzrikka/thrippy/pkg/oauth"
+	"github.com/tzrikka/thrippy/pkg/secrets"
 )
 
 const (
@@ -31,25 +32,71 @@ const (
 )
 
 type httpServer struct {
-	httpPort int // To initialize the HTTP server.
+	httpPort        int         // To initialize the HTTP server.
+	tlsConfig       *tls.Config // Optional, see [webhookTLSConfig].
+	shutdownTimeout time.Duration
 
 	grpcAddr  string // To communicate with the secrets manager.
 	grpcCreds credentials.TransportCredentials
 
+	states            *stateCodec // Signs and verifies the state parameters of OAuth flows.
+	returnToAllowlist []*url.URL  // Server-wide, see [httpServer.checkReturnTo].
+
+	pages     pages // HTML page templates, see [loadPages].
+	startPage bool  // Show the start page instead of redirecting immediately.
+
 	redirectURL string // The server's OAuth callback URL.
 	fallbackURL string // Optional destination for OAuth callbacks without a state.
 }
 
-func newHTTPServer(ctx context.Context, cmd *cli.Command) *httpServer {
+func newHTTPServer(ctx context.Context, cmd *cli.Command) (*httpServer, error) {
+	tlsConfig, err := webhookTLSConfig(ctx, cmd)
+	if err != nil {
+		slog.Error("invalid HTTP server TLS configuration", slog.Any("error", err))
+		return nil, err
+	}
+
+	states, err := newStateCodec(cmd.Duration("oauth-state-ttl"), cmd.String("oauth-state-key"))
+	if err != nil {
+		slog.Error("invalid OAuth state configuration", slog.Any("error", err))
+		return nil, err
+	}
+
+	allowlist, err := parseReturnToAllowlist(cmd.StringSlice("return-to-allowlist"))
+	if err != nil {
+		slog.Error("invalid return URL allowlist", slog.Any("error", err))
+		return nil, err
+	}
+
+	pages, err := loadPages(cmd.String("pages-dir"))
+	if err != nil {
+		slog.Error("invalid HTML page templates", slog.Any("error", err))
+		return nil, err
+	}
+
+	// With ACME, the public address of the server is known.
+	webhookAddr := cmd.String("webhook-addr")
+	if domains := acmeDomains(cmd.StringSlice("webhook-acme-domains")); webhookAddr == "" && len(domains) > 0 {
+		webhookAddr = domains[0]
+	}
+
 	return &httpServer{
-		httpPort: cmd.Int("webhook-port"),
+		httpPort:        cmd.Int("webhook-port"),
+		tlsConfig:       tlsConfig,
+		shutdownTimeout: shutdownTimeout(cmd),
 
 		grpcAddr:  cmd.String("grpc-addr"),
-		grpcCreds: client.GRPCCreds(ctx, cmd),
+		grpcCreds: grpcClientCreds(ctx, cmd),
+
+		states:            states,
+		returnToAllowlist: allowlist,
+
+		pages:     pages,
+		startPage: cmd.Bool("oauth-start-page"),
 
-		redirectURL: redirectURL(cmd.String("webhook-addr")),
+		redirectURL: redirectURL(webhookAddr),
 		fallbackURL: cmd.String("fallback-url"),
-	}
+	}, nil
 }
 
 // redirectURL normalizes the --webhook-addr flag value and returns the
@@ -69,9 +116,10 @@ func redirectURL(webhookAddr string) string {
 	return fmt.Sprintf("https://%s/callback", webhookAddr)
 }
 
-// run starts an HTTP server for OAuth webhooks.
-// This is blocking, to keep the Thrippy server running.
-func (s *httpServer) run() error {
+// run starts an HTTP server for OAuth webhooks. This is blocking, to keep the
+// Thrippy server running until the context is canceled. It then stops the
+// server gracefully, i.e. it waits for in-flight OAuth exchanges to complete.
+func (s *httpServer) run(ctx context.Context) error {
 	http.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -79,27 +127,43 @@ func (s *httpServer) run() error {
 	http.HandleFunc("GET /callback", s.oauthExchangeHandler)
 	http.HandleFunc("GET /start", s.oauthStartHandler)
 	http.HandleFunc("POST /start", s.oauthStartHandler)
-	http.HandleFunc("GET /success", successHandler)
+	http.HandleFunc("GET /success", s.successHandler)
 
 	server := &http.Server{
 		Addr:         net.JoinHostPort("", strconv.Itoa(s.httpPort)),
+		Handler:      securityHeaders(http.DefaultServeMux, s.tlsConfig != nil),
+		TLSConfig:    s.tlsConfig,
 		ReadTimeout:  timeout,
 		WriteTimeout: timeout,
 	}
 
-	slog.Info(fmt.Sprintf("HTTP server listening on port %d", s.httpPort))
+	scheme := "HTTP"
+	if s.tlsConfig != nil {
+		scheme = "HTTPS"
+	}
+	slog.Info(fmt.Sprintf("%s server listening on port %d", scheme, s.httpPort))
 	if s.redirectURL != "" {
 		slog.Info("OAuth callback URL: " + s.redirectURL)
 	} else {
 		slog.Warn("OAuth callback URL: not set")
 	}
-	err := server.ListenAndServe()
-	if err != nil {
+	errs := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			errs <- server.ListenAndServeTLS("", "") // Certs are provided by the TLS config.
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
 		slog.Error("HTTP server error", slog.Any("error", err))
 		return err
+	case <-ctx.Done():
+		slog.Info("shutting down HTTP server")
+		return shutdownHTTP(server, "HTTP server", s.shutdownTimeout)
 	}
-
-	return nil
 }
 
 // oauthStartHandler starts a 3-legged OAuth 2.0 flow by redirecting the client
@@ -109,53 +173,120 @@ func (s *httpServer) oauthStartHandler(w http.ResponseWriter, r *http.Request) {
 	l := slog.With(slog.String("http_method", r.Method), slog.String("url_path", r.URL.EscapedPath()))
 	l.Info("received HTTP request")
 
-	// Extract the link ID and nonce parameters from the request's query or body.
+	// Extract the link ID and start URL signature parameters from the request's query or body.
 	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
 	if err := r.ParseForm(); err != nil {
 		l.Warn("bad request: form parsing error", slog.Any("error", err))
-		htmlResponse(w, http.StatusBadRequest, "Form parsing error")
+		s.htmlResponse(w, http.StatusBadRequest, "Form parsing error")
 		return
 	}
 
 	id := r.FormValue("id")
 	if id == "" {
 		l.Warn("bad request: missing ID parameter")
-		htmlResponse(w, http.StatusBadRequest, "Missing ID parameter")
+		s.htmlResponse(w, http.StatusBadRequest, "Missing ID parameter")
 		return
 	}
 
 	l = l.With(slog.String("link_id", id))
 	if _, err := shortuuid.DefaultEncoder.Decode(id); err != nil {
 		l.Warn("bad request: invalid ID parameter", slog.Any("error", err))
-		htmlResponse(w, http.StatusBadRequest, "Invalid ID parameter")
+		s.htmlResponse(w, http.StatusBadRequest, "Invalid ID parameter")
 		return
 	}
 
-	nonce := r.FormValue("nonce")
-	if nonce == "" {
-		l.Warn("bad request: missing nonce parameter")
-		htmlResponse(w, http.StatusBadRequest, "Missing nonce parameter")
+	if r.FormValue("expires") == "" || r.FormValue("sig") == "" {
+		l.Warn("bad request: missing expires or sig parameter")
+		s.htmlResponse(w, http.StatusBadRequest, "Missing expires or sig parameter")
 		return
 	}
 
-	if _, err := shortuuid.DefaultEncoder.Decode(nonce); err != nil {
-		l.Warn("forbidden: invalid nonce parameter", slog.Any("error", err))
-		htmlResponse(w, http.StatusForbidden, "Invalid nonce parameter")
+	// Signed parameters (including the optional namespace and scopes to add), verified below.
+	params, sig, err := oauth.ParseStartParams(r.Form)
+	if err != nil {
+		l.Warn("bad request: invalid expires parameter", slog.Any("error", err))
+		s.htmlResponse(w, http.StatusBadRequest, "Invalid expires parameter")
 		return
 	}
 
-	// Get the OAuth config corresponding to the link ID, and verify the nonce.
-	ctx := logger.WithContext(r.Context(), l)
-	o := s.checkNonceParam(ctx, w, id, nonce)
+	// Optional secrets namespace of the link (instead of the server's default one).
+	ns := r.FormValue("namespace")
+	if ns != "" {
+		l = l.With(slog.String("namespace", ns))
+		if err := secrets.ValidateNamespace(ns); err != nil {
+			l.Warn("bad request: invalid namespace parameter", slog.Any("error", err))
+			s.htmlResponse(w, http.StatusBadRequest, "Invalid namespace parameter")
+			return
+		}
+	}
+
+	memo := r.FormValue("memo")
+	if len(memo) > maxMemoLen {
+		l.Warn("bad request: memo parameter too long", slog.Int("length", len(memo)))
+		s.htmlResponse(w, http.StatusBadRequest, "Memo parameter too long")
+		return
+	}
+
+	// Get the OAuth config corresponding to the link ID, and verify that the
+	// start URL was signed with the link's nonce, and that it didn't expire.
+	ctx := client.WithNamespace(logger.WithContext(r.Context(), l), ns)
+	var verr error
+	t, o := s.checkNonce(ctx, id, func(nonce string) bool {
+		verr = params.Verify(nonce, sig, time.Now())
+		return verr == nil
+	}, func(status int, _, msg string) {
+		if errors.Is(verr, oauth.ErrStartURLExpired) {
+			msg = "This authorization link has expired, please request a new one"
+		}
+		s.htmlResponse(w, status, msg)
+	})
 	if o == nil {
 		return
 	}
 
-	// Redirect based on the OAuth config, using its nonce as the state parameter,
-	// with an optional (short, opaque, but not secret) memo from the caller.
+	// Optional scopes to add to the link's OAuth config (see "thrippy add-scopes"):
+	// request them in this flow, but save them only if it's completed successfully.
+	if len(params.Scopes) > 0 || len(params.UserScopes) > 0 {
+		if err := intlinks.AddScopesByTemplate(o, links.Templates[t], params.Scopes, params.UserScopes); err != nil {
+			l.Warn("bad request: invalid scopes to add", slog.Any("error", err))
+			s.htmlResponse(w, http.StatusBadRequest, "Invalid scopes to add")
+			return
+		}
+	}
+
+	// Optional URL to return the user to when the flow ends, instead of the
+	// static success page or an error page. It must be explicitly allowed.
+	returnTo := r.FormValue("return_to")
+	if returnTo != "" {
+		if err := s.checkReturnTo(o, returnTo); err != nil {
+			l.Warn("bad request: invalid return_to parameter", slog.Any("error", err), slog.String("return_to", returnTo))
+			s.htmlResponse(w, http.StatusBadRequest, "Invalid return_to parameter")
+			return
+		}
+	}
+
+	// Redirect based on the OAuth config, with a time-limited and single-use state
+	// parameter, signed with the link's nonce, which describes this flow, including
+	// an optional (short, opaque, but not secret) memo from the caller.
+	state := s.states.encode(oauthState{
+		namespace: ns, linkID: id, template: t, memo: memo, returnTo: returnTo,
+		scopes: params.Scopes, userScopes: params.UserScopes,
+	}, o.Nonce)
+
 	o.Config.RedirectURL = s.redirectURL
-	state := constructStateParam(id, nonce, r.FormValue("memo"))
-	http.Redirect(w, r, o.AuthCodeURL(state), http.StatusFound)
+	authURL := o.AuthCodeURL(state)
+
+	// Optional: let the user see what they're about to authorize, before leaving Thrippy.
+	if s.startPage {
+		s.pages.render(w, http.StatusOK, startPage, pageData{
+			Title: "Authorization", Header: "Authorization", Message: "Continue to authorize access",
+			Template: t, LinkID: id, Memo: memo, AuthURL: authURL,
+		})
+		l.Debug("rendered start page", slog.String("url", o.Config.Endpoint.AuthURL))
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
 	l.Debug("redirected HTTP request", slog.String("url", o.Config.Endpoint.AuthURL))
 }
 
@@ -169,7 +300,7 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
 	if err := r.ParseForm(); err != nil {
 		l.Warn("bad request: form parsing error", slog.Any("error", err))
-		htmlResponse(w, http.StatusBadRequest, "Form parsing error")
+		s.htmlResponse(w, http.StatusBadRequest, "Form parsing error")
 		return
 	}
 
@@ -180,9 +311,9 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 		errParam = r.FormValue("error")
 	}
 	if errParam != "" {
-		errParam = html.EscapeString(errParam)
+		st := s.verifiedState(logger.WithContext(r.Context(), l), r.FormValue("state"))
 		l.Warn("OAuth error: " + errParam)
-		htmlResponse(w, http.StatusBadRequest, errParam)
+		s.flowFailed(w, r, st, http.StatusBadRequest, providerErrorCode(r.FormValue("error")), errParam)
 		return
 	}
 
@@ -196,36 +327,56 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 			http.Redirect(w, r, s.fallbackURL, http.StatusFound)
 			return
 		}
-		htmlResponse(w, http.StatusForbidden, "Missing OAuth state parameter")
+		s.htmlResponse(w, http.StatusForbidden, "Missing OAuth state parameter")
 		return
 	}
 
-	// Parse the state parameter.
-	id, nonce, memo, err := parseStateParam(state)
-	l = l.With(slog.String("link_id", id))
-	if memo != "" {
-		l = l.With(slog.String("memo", memo))
-	}
+	// Decode the flow's state parameter. It's not trusted until it's verified below.
+	st, err := s.states.decode(state)
 	if err != nil {
-		l.Warn("bad request: invalid state parameter", slog.Any("error", err))
-		htmlResponse(w, http.StatusBadRequest, "Invalid state parameter")
+		l.Warn("forbidden: invalid state parameter", slog.Any("error", err))
+		s.htmlResponse(w, http.StatusForbidden, "Invalid state parameter")
 		return
 	}
 
-	// Get the OAuth config corresponding to the link ID, and verify the nonce.
-	ctx := logger.WithContext(r.Context(), l)
-	o := s.checkNonceParam(ctx, w, id, nonce)
+	id, ns := st.linkID, st.namespace
+	l = l.With(slog.String("link_id", id))
+	if ns != "" {
+		l = l.With(slog.String("namespace", ns))
+	}
+	if st.memo != "" {
+		l = l.With(slog.String("memo", st.memo))
+	}
+
+	// Get the OAuth config corresponding to the link ID, and verify that the state
+	// parameter was signed with its nonce, i.e. that the nonce wasn't rotated since
+	// the flow started (by the completion of this flow or another one). Until then,
+	// failures can't be reported to the flow's return URL, which isn't trusted yet.
+	ctx := client.WithNamespace(logger.WithContext(r.Context(), l), ns)
+	var verr error
+	t, o := s.checkNonce(ctx, id, func(nonce string) bool {
+		verr = s.states.verify(state, nonce)
+		return verr == nil || errors.Is(verr, errStateExpired)
+	}, func(status int, _, msg string) {
+		s.htmlResponse(w, status, msg)
+	})
 	if o == nil {
 		return
 	}
 
+	if verr != nil {
+		l.Warn("forbidden: expired OAuth flow", slog.Time("created", st.created))
+		s.flowFailed(w, r, st, http.StatusForbidden, errCodeExpired, "This authorization link has expired, please start again")
+		return
+	}
+
 	// Special case: requests to install GitHub apps by users who are
 	// not authorized to approve them can't continue. For more details, see:
 	// https://docs.github.com/en/apps/using-github-apps/installing-a-github-app-from-a-third-party#requirements-to-install-a-github-app
 	setupAction := r.FormValue("setup_action")
 	if setupAction == "request" {
 		l.Warn("GitHub app installation requested by user who can't approve it")
-		htmlResponse(w, http.StatusForbidden, "Installation must be approved by an organization owner")
+		s.flowFailed(w, r, st, http.StatusForbidden, errCodeApprovalRequired, "Installation must be approved by an organization owner")
 		return
 	}
 
@@ -237,15 +388,15 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 		l.Debug("successful GitHub app installation")
 
 		// Check the app installation, extract metadata with and about it, and save them.
-		ctx := logger.WithContext(r.Context(), l)
+		ctx := client.WithNamespace(logger.WithContext(r.Context(), l), ns)
 		u := github.APIBaseURL(github.AuthBaseURL(o))
 		if err := client.AddGitHubCreds(ctx, s.grpcAddr, s.grpcCreds, id, installID, u); err != nil {
-			htmlResponse(w, http.StatusInternalServerError, "&nbsp;")
+			s.flowFailed(w, r, st, http.StatusInternalServerError, errCodeInternal, "")
 			return
 		}
 
 		l.Debug("checked and saved the GitHub installation")
-		http.Redirect(w, r, "/success", http.StatusFound)
+		s.flowSucceeded(w, r, st)
 		return
 	}
 
@@ -254,7 +405,7 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 	code := r.FormValue("code")
 	if code == "" {
 		l.Warn("forbidden: missing OAuth code parameter", slog.Any("query", r.URL.Query()))
-		htmlResponse(w, http.StatusForbidden, "Missing OAuth code parameter")
+		s.flowFailed(w, r, st, http.StatusForbidden, errCodeMissingCode, "Missing OAuth code parameter")
 		return
 	}
 
@@ -262,113 +413,142 @@ func (s *httpServer) oauthExchangeHandler(w http.ResponseWriter, r *http.Request
 	token, err := o.Exchange(ctx, code)
 	if err != nil {
 		l.Warn("OAuth code exchange error", slog.Any("error", err))
-		htmlResponse(w, http.StatusForbidden, "OAuth code exchange error")
+		s.flowFailed(w, r, st, http.StatusForbidden, errCodeExchangeFailed, "OAuth code exchange error")
 		return
 	}
 	l.Debug("successful OAuth token exchange")
 
-	// Check the token, extract metadata with and about it, and save them.
-	if err := client.SetOAuthCreds(ctx, s.grpcAddr, s.grpcCreds, id, token); err != nil {
-		htmlResponse(w, http.StatusInternalServerError, "&nbsp;")
+	// Check the token, extract metadata with and about it, and save them
+	// (including non-standard details of the token, based on the link's template).
+	extras := links.Templates[t].TokenExtras(token)
+	ctx = client.WithAddedScopes(ctx, st.scopes, st.userScopes)
+	if err := client.SetOAuthCreds(ctx, s.grpcAddr, s.grpcCreds, id, token, extras); err != nil {
+		s.flowFailed(w, r, st, http.StatusInternalServerError, errCodeInternal, "")
 		return
 	}
 
 	l.Debug("checked and saved OAuth token")
-	http.Redirect(w, r, "/success", http.StatusFound)
+	s.flowSucceeded(w, r, st)
 }
 
-func (s *httpServer) checkNonceParam(ctx context.Context, w http.ResponseWriter, id, nonce string) *oauth.Config {
+// checkNonce returns the template name and OAuth config of the given link, if its nonce
+// passes the given check. Otherwise, it reports the failure with the given function and
+// returns nil.
+func (s *httpServer) checkNonce(ctx context.Context, id string, check func(nonce string) bool,
+	fail func(status int, code, msg string),
+) (string, *oauth.Config) {
 	l := logger.FromContext(ctx)
 
-	o, err := client.LinkOAuthConfig(ctx, s.grpcAddr, s.grpcCreds, id)
+	t, o, err := client.LinkTemplateAndOAuthConfig(ctx, s.grpcAddr, s.grpcCreds, id)
 	if err != nil {
-		htmlResponse(w, http.StatusInternalServerError, "&nbsp;")
-		return nil
+		fail(http.StatusInternalServerError, errCodeInternal, "")
+		return "", nil
 	}
 
 	if o == nil {
 		l.Warn("forbidden: link not found")
-		htmlResponse(w, http.StatusForbidden, "Invalid state parameter")
-		return nil
+		fail(http.StatusForbidden, errCodeInvalidLink, "Invalid state parameter")
+		return "", nil
 	}
 
-	if subtle.ConstantTimeCompare([]byte(nonce), []byte(o.Nonce)) != 1 {
-		l.Warn("forbidden: invalid nonce parameter")
-		htmlResponse(w, http.StatusForbidden, "Invalid state parameter")
-		return nil
+	if o.Nonce == "" || !check(o.Nonce) {
+		l.Warn("forbidden: invalid or expired nonce")
+		fail(http.StatusForbidden, errCodeInvalidLink, "Invalid state parameter")
+		return "", nil
 	}
 
-	return o
-}
-
-// successHandler is a trivial webhook which merely reports the success of
-// a 3-legged OAuth 2.0 flow. The [oauthExchangeHandler] webhook redirects
-// the user to this handler to cosmetically clean up the URL in the browser.
-func successHandler(w http.ResponseWriter, _ *http.Request) {
-	htmlResponse(w, http.StatusOK, "You may now close this browser tab")
+	return t, o
 }
 
-type htmlResponseParams struct {
-	Title  string
-	Header string
-	Msg    string
-}
-
-var htmlResponseTempl = template.Must(template.New("response").Parse(`<!DOCTYPE html>
-<html>
-<head>
-	<title>{{.Title}}</title>
-</head>
-<body>
-	<h1>{{.Header}}</h1>
-	<p>{{.Msg}}</p>
-</body>
-</html>
-`))
-
-func htmlResponse(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(status)
-
-	title := "Success"
-	header := "Success!"
-	if status >= http.StatusBadRequest {
-		title = "Error"
-		header = fmt.Sprintf("%d %s", status, http.StatusText(status))
+// verifiedState returns the decoded state parameter of a flow, if it was signed
+// with the current nonce of its link (even if it's expired). Otherwise, it
+// returns an empty state, which doesn't have a return URL, for example.
+func (s *httpServer) verifiedState(ctx context.Context, state string) oauthState {
+	st, err := s.states.decode(state)
+	if err != nil {
+		return oauthState{}
 	}
 
-	if !strings.HasSuffix(msg, ".") {
-		msg += "."
+	ctx = client.WithNamespace(ctx, st.namespace)
+	_, o := s.checkNonce(ctx, st.linkID, func(nonce string) bool {
+		err := s.states.verify(state, nonce)
+		return err == nil || errors.Is(err, errStateExpired)
+	}, func(int, string, string) {})
+	if o == nil {
+		return oauthState{}
 	}
 
-	_ = htmlResponseTempl.Execute(w, htmlResponseParams{Title: title, Header: header, Msg: msg})
+	return st
 }
 
-func constructStateParam(id, nonce, memo string) string {
-	state := fmt.Sprintf("%s_%s", id, nonce)
-	if memo != "" {
-		state += "_" + memo
+// flowSucceeded redirects the user to the flow's return URL, if there
+// is one, or to the [httpServer.successHandler] webhook.
+func (s *httpServer) flowSucceeded(w http.ResponseWriter, r *http.Request, st oauthState) {
+	if st.returnTo == "" {
+		q := url.Values{}
+		q.Set("link_id", st.linkID)
+		if st.template != "" {
+			q.Set("template", st.template)
+		}
+		if st.memo != "" {
+			q.Set("memo", st.memo)
+		}
+		http.Redirect(w, r, "/success?"+q.Encode(), http.StatusFound)
+		return
 	}
-	return state
+	http.Redirect(w, r, returnToURL(st.returnTo, st, ""), http.StatusFound)
 }
 
-func parseStateParam(state string) (id, nonce, memo string, err error) {
-	s := strings.SplitN(state, "_", 3)
-	for i := len(s); i < 3; i++ {
-		s = append(s, "")
+// flowFailed redirects the user to the flow's return URL with an
+// error code, if there is one, or responds with an HTML error page.
+func (s *httpServer) flowFailed(w http.ResponseWriter, r *http.Request, st oauthState, status int, code, msg string) {
+	if st.returnTo == "" {
+		s.renderPage(w, status, pageData{Message: msg, Template: st.template, ErrorCategory: code, LinkID: st.linkID, Memo: st.memo})
+		return
 	}
+	http.Redirect(w, r, returnToURL(st.returnTo, st, code), http.StatusFound)
+}
 
-	id, nonce, memo = s[0], s[1], s[2]
-	if id == "" || nonce == "" {
-		err = errors.New("incomplete state parameter")
-		return id, nonce, memo, err
+// successHandler is a trivial webhook which merely reports the success of
+// a 3-legged OAuth 2.0 flow. The [httpServer.oauthExchangeHandler] webhook
+// redirects the user to this handler to cosmetically clean up the URL in the
+// browser. The query parameters are used only for display purposes, so they
+// are sanity-checked but not trusted.
+func (s *httpServer) successHandler(w http.ResponseWriter, r *http.Request) {
+	d := pageData{Message: "You may now close this browser tab"}
+	if id := r.FormValue("link_id"); id != "" {
+		if _, err := shortuuid.DefaultEncoder.Decode(id); err == nil {
+			d.LinkID = id
+		}
 	}
-	if _, err = shortuuid.DefaultEncoder.Decode(id); err != nil {
-		return id, nonce, memo, err
+	if t := r.FormValue("template"); t != "" {
+		if _, ok := links.Templates[t]; ok {
+			d.Template = t
+		}
 	}
-	if _, err = shortuuid.DefaultEncoder.Decode(nonce); err != nil {
-		return id, nonce, memo, err
+	if memo := r.FormValue("memo"); len(memo) <= maxMemoLen {
+		d.Memo = memo
 	}
 
-	return id, nonce, memo, nil
+	s.renderPage(w, http.StatusOK, d)
+}
+
+// htmlResponse responds with the success page or the error
+// page (depending on the status code), with a generic message.
+func (s *httpServer) htmlResponse(w http.ResponseWriter, status int, msg string) {
+	s.renderPage(w, status, pageData{Message: msg})
+}
+
+// renderPage responds with the success page or the error page, depending on the
+// status code. Error pages without a specific error category get a generic one.
+func (s *httpServer) renderPage(w http.ResponseWriter, status int, d pageData) {
+	if status < http.StatusBadRequest {
+		s.pages.render(w, status, successPage, d)
+		return
+	}
+
+	if d.ErrorCategory == "" {
+		d.ErrorCategory = errorCategory(status)
+	}
+	s.pages.render(w, status, errorPage, d)
 }
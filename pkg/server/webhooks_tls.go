@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// webhookTLSConfig returns the TLS configuration of the HTTP webhook server,
+// based on CLI flags, or nil if it should serve plain HTTP (e.g. behind an
+// HTTP tunnel or a reverse proxy which terminates TLS). TLS certs may be
+// static files (reloaded when they change, like the gRPC server's), or
+// obtained and renewed automatically from an ACME CA (e.g. Let's Encrypt).
+func webhookTLSConfig(ctx context.Context, cmd *cli.Command) (*tls.Config, error) {
+	certPath := cmd.String("webhook-tls-cert")
+	keyPath := cmd.String("webhook-tls-key")
+	domains := acmeDomains(cmd.StringSlice("webhook-acme-domains"))
+
+	switch {
+	case len(domains) > 0 && (certPath != "" || keyPath != ""):
+		return nil, errors.New("webhook TLS: specify either cert files or ACME domains, not both")
+
+	case certPath != "" || keyPath != "":
+		if certPath == "" || keyPath == "" {
+			return nil, errors.New("webhook TLS: both a cert file and a private key file are required")
+		}
+		r, err := newCertReloader(certPath, keyPath, "")
+		if err != nil {
+			return nil, err
+		}
+		go r.watch(ctx)
+
+		slog.Info("using HTTP server with TLS", slog.String("cert", certPath), slog.String("key", keyPath))
+		return r.serverConfig(), nil
+
+	case len(domains) > 0:
+		return acmeTLSConfig(cmd, domains)
+
+	default:
+		return nil, nil
+	}
+}
+
+// acmeDomains normalizes the values of the "webhook-acme-domains" flag, which
+// may also be a single comma-separated string (in environment variables).
+func acmeDomains(values []string) []string {
+	var domains []string
+	for _, v := range values {
+		for d := range strings.SplitSeq(v, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				domains = append(domains, d)
+			}
+		}
+	}
+	return domains
+}
+
+// acmeTLSConfig uses the ACME TLS-ALPN-01 challenge, so the webhook server
+// must be reachable on port 443 of all the given domains. Certs and the ACME
+// account key are stored in a cache directory, to reuse them after restarts
+// (and avoid the CA's rate limits).
+func acmeTLSConfig(cmd *cli.Command, domains []string) (*tls.Config, error) {
+	dir := cmd.String("webhook-acme-cache-dir")
+	if dir == "" {
+		return nil, errors.New("webhook TLS: ACME requires a cache directory")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      cmd.String("webhook-acme-email"),
+	}
+	if u := cmd.String("webhook-acme-directory"); u != "" {
+		m.Client = &acme.Client{DirectoryURL: u}
+	}
+
+	slog.Info("using HTTP server with ACME TLS certs", slog.Any("domains", domains), slog.String("cache_dir", dir))
+
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg, nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/crypto/acme"
+)
+
+func webhookTLSCommand(certPath, keyPath string, domains []string, cacheDir string) *cli.Command {
+	return &cli.Command{Flags: []cli.Flag{
+		&cli.StringFlag{Name: "webhook-tls-cert", Value: certPath},
+		&cli.StringFlag{Name: "webhook-tls-key", Value: keyPath},
+		&cli.StringSliceFlag{Name: "webhook-acme-domains", Value: domains},
+		&cli.StringFlag{Name: "webhook-acme-cache-dir", Value: cacheDir},
+	}}
+}
+
+func TestWebhookTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	writeTestCert(t, certPath, keyPath, "localhost")
+
+	tests := []struct {
+		name string
+		cmd  *cli.Command
+	}{
+		{
+			name: "cert_without_key",
+			cmd:  webhookTLSCommand(certPath, "", nil, ""),
+		},
+		{
+			name: "key_without_cert",
+			cmd:  webhookTLSCommand("", keyPath, nil, ""),
+		},
+		{
+			name: "both_files_and_acme",
+			cmd:  webhookTLSCommand(certPath, keyPath, []string{"example.com"}, dir),
+		},
+		{
+			name: "acme_without_cache_dir",
+			cmd:  webhookTLSCommand("", "", []string{"example.com"}, ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := webhookTLSConfig(t.Context(), tt.cmd); err == nil {
+				t.Error("webhookTLSConfig() error = nil")
+			}
+		})
+	}
+}
+
+func TestWebhookTLSConfigPlainHTTP(t *testing.T) {
+	cfg, err := webhookTLSConfig(t.Context(), webhookTLSCommand("", "", nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != nil {
+		t.Errorf("webhookTLSConfig() = %v, want nil", cfg)
+	}
+}
+
+func TestWebhookTLSConfigStaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	writeTestCert(t, certPath, keyPath, "localhost")
+
+	cfg, err := webhookTLSConfig(t.Context(), webhookTLSCommand(certPath, keyPath, nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	pem, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:    roots,
+		ServerName: "localhost",
+		MinVersion: tls.VersionTLS12,
+	}}}
+	resp, err := hc.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTPS response status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestWebhookTLSConfigACME(t *testing.T) {
+	cmd := webhookTLSCommand("", "", []string{"thrippy.example.com, other.example.com"}, t.TempDir())
+	cfg, err := webhookTLSConfig(t.Context(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(cfg.NextProtos, acme.ALPNProto) {
+		t.Errorf("NextProtos = %v, want %q for TLS-ALPN-01 challenges", cfg.NextProtos, acme.ALPNProto)
+	}
+
+	// Unknown domains are rejected without contacting the ACME CA.
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example.com"}); err == nil {
+		t.Error("GetCertificate(unknown domain) error = nil")
+	}
+}
+
+func TestACMEDomains(t *testing.T) {
+	got := acmeDomains([]string{" A.example.com,b.example.com ", "", "c.example.com"})
+	want := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("acmeDomains() = %v, want %v", got, want)
+	}
+}